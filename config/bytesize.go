@@ -0,0 +1,68 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ByteSize 是可以用 "512KB"、"10MB" 这类字符串配置的字节数，单位按 1024 换算
+// 直接写数字表示字节数
+type ByteSize int64
+
+var byteUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"G", 1 << 30},
+	{"M", 1 << 20},
+	{"K", 1 << 10},
+	{"B", 1},
+}
+
+// Or 在未配置（为 0）时返回默认值
+func (b ByteSize) Or(fallback int64) int64 {
+	if b <= 0 {
+		return fallback
+	}
+	return int64(b)
+}
+
+func (b *ByteSize) UnmarshalText(text []byte) error {
+	s := strings.ToUpper(strings.TrimSpace(string(text)))
+	multiplier := int64(1)
+	for _, unit := range byteUnits {
+		if strings.HasSuffix(s, unit.suffix) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix))
+			multiplier = unit.size
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid byte size: %q", text)
+	}
+	*b = ByteSize(n * float64(multiplier))
+	return nil
+}
+
+// UnmarshalJSON 兼容字符串（"10MB"）和数字（字节数）两种写法
+func (b *ByteSize) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	switch value := v.(type) {
+	case string:
+		return b.UnmarshalText([]byte(value))
+	case float64:
+		*b = ByteSize(value)
+		return nil
+	default:
+		return fmt.Errorf("invalid byte size: %s", data)
+	}
+}
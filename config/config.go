@@ -8,15 +8,187 @@ import (
 )
 
 type RouteConfig struct {
-	Path              string                 `mapstructure:"path" json:"path"`
-	Method            string                 `mapstructure:"method" json:"method"`
-	BackendURL        string                 `mapstructure:"backendUrl" json:"backendUrl"`
-	BackendPath       string                 `mapstructure:"backendPath" json:"backendPath"`
-	BackendMethod     string                 `mapstructure:"backendMethod" json:"backendMethod"`
+	// ID 可选的路由标识；设置后路由按 ID 区分，否则按 method + host + path 区分
+	// 只有附加匹配条件不同的路由需要设置不同的 ID，标识重复的路由只保留第一条
+	ID     string `mapstructure:"id" json:"id,omitempty"`
+	Path   string `mapstructure:"path" json:"path"`
+	Method string `mapstructure:"method" json:"method"`
+	// Priority 显式优先级，数值越大越优先；优先级相同时按路径具体程度决定
+	Priority int `mapstructure:"priority" json:"priority,omitempty"`
+
+	// PathRegex 使用正则匹配完整请求路径（自动加 ^ 和 $），与 Path 互斥
+	// 捕获组可在 BackendPathRewrite 中通过 $1、${name} 引用
+	PathRegex string `mapstructure:"pathRegex" json:"pathRegex,omitempty"`
+
+	// 附加匹配条件，全部满足时路由才会命中
+	// Headers/Query 的值为空表示只要求存在，以 "~" 开头表示正则匹配，否则精确匹配
+	Host        string            `mapstructure:"host" json:"host,omitempty"`               // 支持 *.example.com 通配子域名
+	Headers     map[string]string `mapstructure:"headers" json:"headers,omitempty"`         // Header 名称不区分大小写
+	Query       map[string]string `mapstructure:"query" json:"query,omitempty"`             // 查询参数名区分大小写
+	ContentType string            `mapstructure:"contentType" json:"contentType,omitempty"` // 支持 application/* 通配
+
+	BackendURL string `mapstructure:"backendUrl" json:"backendUrl"`
+	// Upstream 引用 Config.Upstreams 中的命名上游组；Upstreams 为路由内联的多个后端节点
+	// 两者都未设置时使用 BackendURL
+	Upstream       string                `mapstructure:"upstream" json:"upstream,omitempty"`
+	Upstreams      []UpstreamTarget      `mapstructure:"upstreams" json:"upstreams,omitempty"`
+	LoadBalance    *LoadBalanceConfig    `mapstructure:"loadBalance" json:"loadBalance,omitempty"`       // 内联节点的负载均衡策略
+	HealthCheck    *HealthCheckConfig    `mapstructure:"healthCheck" json:"healthCheck,omitempty"`       // 内联节点的健康检查
+	Retry          *RetryConfig          `mapstructure:"retry" json:"retry,omitempty"`                   // 转发失败时的重试策略
+	CircuitBreaker *CircuitBreakerConfig `mapstructure:"circuitBreaker" json:"circuitBreaker,omitempty"` // 熔断器
+	Timeout        *TimeoutConfig        `mapstructure:"timeout" json:"timeout,omitempty"`               // 转发超时，覆盖全局配置
+	BodyMode       string                `mapstructure:"bodyMode" json:"bodyMode,omitempty"`             // auto（默认）、buffered 或 streaming
+	Protocol       string                `mapstructure:"protocol" json:"protocol,omitempty"`             // 后端协议：http1、h2 或 grpc，默认按 scheme 自动选择
+	Limits         *BodyLimits           `mapstructure:"limits" json:"limits,omitempty"`                 // body 大小上限，覆盖全局配置
+	WebSocket      *WebSocketConfig      `mapstructure:"websocket" json:"websocket,omitempty"`           // WebSocket 代理
+	SSE            *SSEConfig            `mapstructure:"sse" json:"sse,omitempty"`                       // Server-Sent Events 转发
+	GRPC           *GRPCTranscodeConfig  `mapstructure:"grpc" json:"grpc,omitempty"`                     // 将 JSON 请求转码为 gRPC 调用
+	Cache          *CacheConfig          `mapstructure:"cache" json:"cache,omitempty"`                   // 响应缓存
+	Coalesce       bool                  `mapstructure:"coalesce" json:"coalesce,omitempty"`             // 合并相同 key 的并发 GET、HEAD 请求
+	Mirror         *MirrorConfig         `mapstructure:"mirror" json:"mirror,omitempty"`                 // 流量镜像
+	Canary         *CanaryConfig         `mapstructure:"canary" json:"canary,omitempty"`                 // 按权重分流到多个后端版本
+	Aggregate      *AggregateConfig      `mapstructure:"aggregate" json:"aggregate,omitempty"`           // 调用多个后端并组装一个响应
+	Respond        *RespondConfig        `mapstructure:"respond" json:"respond,omitempty"`               // 直接返回本地响应，不转发到后端
+	BackendPath    string                `mapstructure:"backendPath" json:"backendPath"`
+	// BackendPathRewrite 后端路径模板，优先于 BackendPath
+	// 支持 $1 / ${1} / ${name} 引用 PathRegex 捕获组，以及 {name} 引用路径参数
+	BackendPathRewrite string `mapstructure:"backendPathRewrite" json:"backendPathRewrite,omitempty"`
+	BackendMethod      string `mapstructure:"backendMethod" json:"backendMethod"`
+	// QueryTransform 转发前改写查询参数，未设置时原样转发客户端的查询参数
+	QueryTransform *QueryTransformConfig `mapstructure:"queryTransform" json:"queryTransform,omitempty"`
+	// RequestHeaders 转发前改写发往后端的请求头，ResponseHeaders 改写返回给客户端的响应头
+	RequestHeaders    *HeaderTransformConfig `mapstructure:"requestHeaders" json:"requestHeaders,omitempty"`
+	ResponseHeaders   *HeaderTransformConfig `mapstructure:"responseHeaders" json:"responseHeaders,omitempty"`
 	RequestTransform  map[string]interface{} `mapstructure:"requestTransform" json:"requestTransform"`
 	ResponseTransform map[string]interface{} `mapstructure:"responseTransform" json:"responseTransform"`
 }
 
+// UpstreamTarget 是上游组中的一个后端节点
+type UpstreamTarget struct {
+	URL    string `mapstructure:"url" json:"url"`
+	Weight int    `mapstructure:"weight" json:"weight,omitempty"` // 权重，默认 1
+}
+
+// LoadBalanceConfig 负载均衡配置
+type LoadBalanceConfig struct {
+	// Strategy 可选 round-robin（默认）、weighted-round-robin、least-connections、
+	// random-two-choices、consistent-hash
+	Strategy string `mapstructure:"strategy" json:"strategy,omitempty"`
+	// HashOn 一致性哈希的取值来源：header、cookie 或 ip（默认）
+	HashOn string `mapstructure:"hashOn" json:"hashOn,omitempty"`
+	// HashKey HashOn 为 header/cookie 时的名称
+	HashKey string `mapstructure:"hashKey" json:"hashKey,omitempty"`
+}
+
+// UpstreamConfig 命名上游组，可被多个路由通过 RouteConfig.Upstream 引用
+type UpstreamConfig struct {
+	Name        string             `mapstructure:"name" json:"name"`
+	Targets     []UpstreamTarget   `mapstructure:"targets" json:"targets"`
+	LoadBalance LoadBalanceConfig  `mapstructure:"loadBalance" json:"loadBalance"`
+	HealthCheck *HealthCheckConfig `mapstructure:"healthCheck" json:"healthCheck,omitempty"`
+}
+
+// HealthCheckConfig 上游节点健康检查配置，主动和被动检查可以同时启用
+type HealthCheckConfig struct {
+	Active  *ActiveHealthCheck  `mapstructure:"active" json:"active,omitempty"`
+	Passive *PassiveHealthCheck `mapstructure:"passive" json:"passive,omitempty"`
+}
+
+// ActiveHealthCheck 定期请求节点的健康检查接口
+type ActiveHealthCheck struct {
+	Path               string   `mapstructure:"path" json:"path"`                                       // 默认 "/"
+	Interval           Duration `mapstructure:"interval" json:"interval,omitempty"`                     // 默认 10s
+	Timeout            Duration `mapstructure:"timeout" json:"timeout,omitempty"`                       // 默认 2s
+	ExpectedStatus     []int    `mapstructure:"expectedStatus" json:"expectedStatus,omitempty"`         // 默认 2xx/3xx
+	HealthyThreshold   int      `mapstructure:"healthyThreshold" json:"healthyThreshold,omitempty"`     // 连续成功多少次恢复，默认 2
+	UnhealthyThreshold int      `mapstructure:"unhealthyThreshold" json:"unhealthyThreshold,omitempty"` // 连续失败多少次摘除，默认 3
+}
+
+// PassiveHealthCheck 根据真实流量的结果摘除节点
+type PassiveHealthCheck struct {
+	MaxFailures   int      `mapstructure:"maxFailures" json:"maxFailures,omitempty"`     // 连续连接错误或 5xx 多少次摘除，默认 5
+	EjectDuration Duration `mapstructure:"ejectDuration" json:"ejectDuration,omitempty"` // 摘除时长，到期后自动恢复，默认 30s
+}
+
+// RetryConfig 转发重试策略
+type RetryConfig struct {
+	// Attempts 最大尝试次数（包含首次请求），默认 3
+	Attempts int `mapstructure:"attempts" json:"attempts,omitempty"`
+	// RetryOn 可重试的失败类型：connect-failure、timeout、5xx 或具体状态码（如 "503"）
+	// 默认 connect-failure 和 timeout
+	RetryOn []string `mapstructure:"retryOn" json:"retryOn,omitempty"`
+	// Methods 允许重试的 HTTP 方法，默认只重试幂等方法（GET、HEAD、OPTIONS、PUT、DELETE、TRACE）
+	Methods []string `mapstructure:"methods" json:"methods,omitempty"`
+	// Backoff 首次重试前的基础等待时间，之后指数增长并加入随机抖动，默认 25ms
+	Backoff Duration `mapstructure:"backoff" json:"backoff,omitempty"`
+	// MaxBackoff 单次等待时间上限，默认 1s
+	MaxBackoff Duration `mapstructure:"maxBackoff" json:"maxBackoff,omitempty"`
+	// BudgetRatio 重试预算：10 秒窗口内重试次数不超过请求数的该比例，默认 0.2
+	BudgetRatio float64 `mapstructure:"budgetRatio" json:"budgetRatio,omitempty"`
+	// MinRetries 每个窗口内不受比例限制的最少重试次数，默认 10
+	MinRetries int `mapstructure:"minRetries" json:"minRetries,omitempty"`
+}
+
+// CircuitBreakerConfig 熔断器配置
+// 统计窗口内请求数达到 MinRequests 后，失败率或慢调用比例超过阈值即熔断；
+// 熔断 OpenDuration 后进入半开状态，放行 HalfOpenRequests 个探测请求，全部成功则恢复
+type CircuitBreakerConfig struct {
+	ErrorRate        float64         `mapstructure:"errorRate" json:"errorRate,omitempty"`               // 失败率阈值（0~1），连接错误和 5xx 计为失败，默认 0.5
+	SlowCallDuration Duration        `mapstructure:"slowCallDuration" json:"slowCallDuration,omitempty"` // 超过该耗时计为慢调用，不设置则不统计慢调用
+	SlowCallRate     float64         `mapstructure:"slowCallRate" json:"slowCallRate,omitempty"`         // 慢调用比例阈值（0~1），默认 0.5
+	MinRequests      int             `mapstructure:"minRequests" json:"minRequests,omitempty"`           // 统计窗口内的最少请求数，默认 20
+	Window           Duration        `mapstructure:"window" json:"window,omitempty"`                     // 统计窗口，默认 10s
+	OpenDuration     Duration        `mapstructure:"openDuration" json:"openDuration,omitempty"`         // 熔断持续时间，默认 30s
+	HalfOpenRequests int             `mapstructure:"halfOpenRequests" json:"halfOpenRequests,omitempty"` // 半开状态的探测请求数，默认 3
+	Fallback         *FallbackConfig `mapstructure:"fallback" json:"fallback,omitempty"`                 // 熔断时的降级行为，不设置时返回 503
+}
+
+// FallbackConfig 熔断降级配置，Upstream、Hook 和静态响应按此顺序生效
+type FallbackConfig struct {
+	Upstream string            `mapstructure:"upstream" json:"upstream,omitempty"` // 改为转发到该命名上游组
+	Hook     bool              `mapstructure:"hook" json:"hook,omitempty"`         // 执行 OnCircuitOpen Hook 生成响应
+	Status   int               `mapstructure:"status" json:"status,omitempty"`     // 静态响应状态码，默认 503
+	Body     string            `mapstructure:"body" json:"body,omitempty"`         // 静态响应体
+	Headers  map[string]string `mapstructure:"headers" json:"headers,omitempty"`   // 静态响应头
+}
+
+// QueryTransformConfig 查询参数转换，按 Remove、Rename、Set 的顺序执行
+type QueryTransformConfig struct {
+	// Forward 是否转发客户端的查询参数，默认 true；为 false 时只发送 Set 中的参数
+	Forward *bool `mapstructure:"forward" json:"forward,omitempty"`
+	// Remove 删除的参数名
+	Remove []string `mapstructure:"remove" json:"remove,omitempty"`
+	// Rename 参数改名，旧名 -> 新名
+	Rename map[string]string `mapstructure:"rename" json:"rename,omitempty"`
+	// Set 新增或覆盖参数，值支持 "$.xxx" 取客户端请求体、"@ctx.xxx" 取上下文，其余为固定值
+	// 值为数组时生成多个同名参数，值为空时不设置该参数
+	Set map[string]interface{} `mapstructure:"set" json:"set,omitempty"`
+}
+
+// HeaderTransformConfig Header 改写，按 Remove、Rename、Set、Append 的顺序执行，Header 名称不区分大小写
+type HeaderTransformConfig struct {
+	// Remove 删除的 Header
+	Remove []string `mapstructure:"remove" json:"remove,omitempty"`
+	// Rename Header 改名，旧名 -> 新名，保留所有值
+	Rename map[string]string `mapstructure:"rename" json:"rename,omitempty"`
+	// Set 新增或覆盖 Header，值的语法与 QueryTransformConfig.Set 相同；
+	// 请求头的 "$.xxx" 取客户端请求体，响应头的 "$.xxx" 取后端响应体
+	Set map[string]interface{} `mapstructure:"set" json:"set,omitempty"`
+	// Append 在已有值之后追加，值的语法与 Set 相同
+	Append map[string]interface{} `mapstructure:"append" json:"append,omitempty"`
+}
+
+// Key 返回路由的唯一标识，用于重复检测、更新和删除
+func (r *RouteConfig) Key() string {
+	if r.ID != "" {
+		return "id:" + r.ID
+	}
+	if r.PathRegex != "" {
+		return r.Method + " " + r.Host + "~" + r.PathRegex
+	}
+	return r.Method + " " + r.Host + r.Path
+}
+
 // DeepCopy 返回 RouteConfig 的深拷贝
 // 使用 JSON 序列化/反序列化方式，确保 map 字段也被深拷贝
 // 这样可以避免并发修改导致的 panic
@@ -44,7 +216,196 @@ type Config struct {
 	Port       string
 	BackendURL string
 	AuthToken  string
+	Server     ServerConfig
+	Timeout    TimeoutConfig // 转发超时的全局默认值，路由可单独覆盖
+	Limits     BodyLimits    // 缓冲模式下请求体和响应体大小的全局上限，路由可单独覆盖
 	Routes     []RouteConfig
+	Upstreams  []UpstreamConfig
+	Cache      CacheStoreConfig // 响应缓存的存储配置
+	// TrustedProxies 受信任的前置代理（IP 或 CIDR），来自这些地址的 X-Forwarded-* 和 Forwarded 会被保留并追加
+	TrustedProxies []string
+}
+
+// 请求体和响应体的处理方式
+const (
+	BodyModeAuto      = "auto"      // 默认：路由没有需要读取 body 的转换、Hook 和重试时使用流式转发
+	BodyModeBuffered  = "buffered"  // 完整读入内存，可以被转换和 Hook 修改
+	BodyModeStreaming = "streaming" // 边读边转发，Hook 中 requestBody 和 responseBody 为空
+)
+
+// 后端协议
+const (
+	ProtocolAuto  = ""      // 默认：https 后端通过 ALPN 协商 HTTP/2，http 后端使用 HTTP/1.1
+	ProtocolHTTP1 = "http1" // 只使用 HTTP/1.1
+	ProtocolH2    = "h2"    // 只使用 HTTP/2：https 后端为 HTTP/2 over TLS，http 后端为 h2c
+	ProtocolGRPC  = "grpc"  // gRPC：HTTP/2 + 流式转发 + trailers，遵循 grpc-timeout
+)
+
+// BodyLimits 缓冲模式下的 body 大小上限，为 0 时使用默认值 10MB
+type BodyLimits struct {
+	MaxRequestBody  ByteSize `mapstructure:"maxRequestBody" json:"maxRequestBody,omitempty"`   // 超过时返回 413
+	MaxResponseBody ByteSize `mapstructure:"maxResponseBody" json:"maxResponseBody,omitempty"` // 超过时返回 502
+}
+
+// WebSocketConfig WebSocket 代理配置
+// 启用后，路由收到 Upgrade: websocket 握手时接管连接，在客户端和后端之间双向转发帧
+type WebSocketConfig struct {
+	Enabled bool `mapstructure:"enabled" json:"enabled"`
+	// MessageHook 为每条消息执行 OnWebSocketMessage Hook，可以检查、修改或丢弃消息
+	// 开启后网关需要解析帧，握手时会去掉 Sec-WebSocket-Extensions，不协商压缩
+	MessageHook    bool     `mapstructure:"messageHook" json:"messageHook,omitempty"`
+	MaxMessageSize ByteSize `mapstructure:"maxMessageSize" json:"maxMessageSize,omitempty"` // 开启 MessageHook 时单条消息的上限，默认 1MB
+}
+
+// SSEConfig Server-Sent Events 转发配置
+// 启用后路由使用流式转发，每个事件到达后立即 flush 给客户端，不执行 responseTransform
+type SSEConfig struct {
+	Enabled bool `mapstructure:"enabled" json:"enabled"`
+	// IdleTimeout 超过该时间没有收到后端数据时断开，默认 5m；启用后不受 timeout.total 限制
+	IdleTimeout Duration `mapstructure:"idleTimeout" json:"idleTimeout,omitempty"`
+	// EventTransform 对每个事件的 data（JSON）执行 DSL 转换，可以通过 @ctx.event.name、@ctx.event.id 访问事件字段
+	EventTransform map[string]interface{} `mapstructure:"eventTransform" json:"eventTransform,omitempty"`
+	// MaxEventSize eventTransform 逐个事件解析时单个事件的大小上限，默认 1MB；超过时断开连接
+	MaxEventSize ByteSize `mapstructure:"maxEventSize" json:"maxEventSize,omitempty"`
+}
+
+// GRPCTranscodeConfig REST 转 gRPC 的配置
+// 请求体（经过 requestTransform 后）按方法的输入类型转为 protobuf 调用后端，
+// 响应转为 JSON 后再执行 responseTransform
+type GRPCTranscodeConfig struct {
+	// DescriptorSet protoc --include_imports --descriptor_set_out 生成的描述文件路径
+	DescriptorSet string `mapstructure:"descriptorSet" json:"descriptorSet"`
+	Service       string `mapstructure:"service" json:"service"` // 完整服务名，如 helloworld.Greeter
+	Method        string `mapstructure:"method" json:"method"`   // 方法名，只支持一元调用
+}
+
+// CacheConfig 路由的响应缓存配置，只缓存 GET 和 HEAD 请求，启用后路由使用缓冲转发
+// 缓存的是后端响应，命中时 AfterForward 等 Hook 和 responseTransform 仍然执行
+type CacheConfig struct {
+	Enabled bool `mapstructure:"enabled" json:"enabled"`
+	// TTL 后端响应没有 s-maxage、max-age 或 Expires 时的缓存时间，默认 60s
+	TTL Duration `mapstructure:"ttl" json:"ttl,omitempty"`
+	// KeyHeaders 参与缓存 key 的请求头；方法、Host、路径和查询参数总是参与
+	KeyHeaders []string `mapstructure:"keyHeaders" json:"keyHeaders,omitempty"`
+	// KeyContext 参与缓存 key 的上下文值，如 "@ctx.tenantId"
+	KeyContext []string `mapstructure:"keyContext" json:"keyContext,omitempty"`
+	// StaleWhileRevalidate 过期后仍可返回旧响应并在后台刷新的时间，后端的 stale-while-revalidate 优先
+	StaleWhileRevalidate Duration `mapstructure:"staleWhileRevalidate" json:"staleWhileRevalidate,omitempty"`
+	// StaleIfError 后端出错（转发失败或 5xx）时仍可返回旧响应的时间，后端的 stale-if-error 优先
+	StaleIfError Duration `mapstructure:"staleIfError" json:"staleIfError,omitempty"`
+	// Statuses 可缓存的状态码，默认 200、203、204、300、301、404、405、410、414、501
+	Statuses []int `mapstructure:"statuses" json:"statuses,omitempty"`
+}
+
+// MirrorConfig 流量镜像：把转发给后端的请求（经过 Hook 和转换之后）异步复制一份发送到另一个上游，
+// 镜像的响应被丢弃，不影响主请求的延迟和结果；启用后路由使用缓冲转发
+type MirrorConfig struct {
+	Enabled bool `mapstructure:"enabled" json:"enabled"`
+	// Upstream 镜像到该命名上游组；未设置时使用 BackendURL
+	Upstream   string `mapstructure:"upstream" json:"upstream,omitempty"`
+	BackendURL string `mapstructure:"backendUrl" json:"backendUrl,omitempty"`
+	// Percentage 镜像的请求比例，0-100，默认 100
+	Percentage float64 `mapstructure:"percentage" json:"percentage,omitempty"`
+	// Timeout 镜像请求的总超时，默认使用路由的超时配置
+	Timeout Duration `mapstructure:"timeout" json:"timeout,omitempty"`
+	// Diff 比较主请求和镜像请求的状态码和响应体，不一致时记录下来，通过管理接口查看
+	Diff bool `mapstructure:"diff" json:"diff,omitempty"`
+}
+
+// CanaryConfig 按权重把路由的流量分给多个后端版本（灰度发布），权重可以通过管理接口实时调整
+type CanaryConfig struct {
+	Variants []CanaryVariant `mapstructure:"variants" json:"variants"`
+	// StickyOn 粘性的取值来源：header、cookie 或 context；同一个值总是命中同一个版本（权重不变时）
+	// 未设置时每个请求按权重随机选择
+	StickyOn string `mapstructure:"stickyOn" json:"stickyOn,omitempty"`
+	// StickyKey StickyOn 为 header/cookie 时的名称，为 context 时的表达式，如 "@ctx.consumer.id"
+	StickyKey string `mapstructure:"stickyKey" json:"stickyKey,omitempty"`
+}
+
+// CanaryVariant 路由的一个后端版本，未设置的字段使用路由的配置
+type CanaryVariant struct {
+	Name   string `mapstructure:"name" json:"name"`
+	Weight int    `mapstructure:"weight" json:"weight"` // 相对权重，为 0 时不分配流量
+	// Upstream 命名上游组，优先于 BackendURL；两者都未设置时使用路由的后端
+	Upstream          string                 `mapstructure:"upstream" json:"upstream,omitempty"`
+	BackendURL        string                 `mapstructure:"backendUrl" json:"backendUrl,omitempty"`
+	BackendPath       string                 `mapstructure:"backendPath" json:"backendPath,omitempty"`
+	RequestTransform  map[string]interface{} `mapstructure:"requestTransform" json:"requestTransform,omitempty"`
+	ResponseTransform map[string]interface{} `mapstructure:"responseTransform" json:"responseTransform,omitempty"`
+}
+
+// AggregateConfig 聚合路由：并行（或按依赖顺序）调用多个后端，组装成一个响应
+// 组装的响应体是以调用名为 key 的 JSON 对象，值为各调用的响应体，可以再用 responseTransform 改写
+type AggregateConfig struct {
+	Calls []AggregateCall `mapstructure:"calls" json:"calls"`
+}
+
+// 子调用失败时的处理方式
+const (
+	AggregateOnErrorFail    = "fail"    // 整个请求失败（默认）
+	AggregateOnErrorOmit    = "omit"    // 响应中不包含该调用
+	AggregateOnErrorDefault = "default" // 使用 Default 作为该调用的响应体
+)
+
+// AggregateCall 聚合路由中的一次后端调用
+// Path、Query、Headers、Body 中的表达式可以用 "$.xxx" 取客户端请求体，用 "@ctx.calls.<name>.body.xxx" 取依赖调用的结果
+type AggregateCall struct {
+	Name   string `mapstructure:"name" json:"name"`
+	Method string `mapstructure:"method" json:"method,omitempty"` // 默认 GET
+	// Upstream 命名上游组，优先于 BackendURL；两者都未设置时使用路由的后端
+	Upstream   string `mapstructure:"upstream" json:"upstream,omitempty"`
+	BackendURL string `mapstructure:"backendUrl" json:"backendUrl,omitempty"`
+	// Path 后端路径，{name} 引用路径参数，{@ctx.xxx} / {$.xxx} 引用表达式的值（作为一个路径段，不能包含 /、?、#）
+	Path    string                 `mapstructure:"path" json:"path"`
+	Query   map[string]interface{} `mapstructure:"query" json:"query,omitempty"`     // 查询参数，值的语法与 queryTransform.set 相同
+	Headers map[string]interface{} `mapstructure:"headers" json:"headers,omitempty"` // 在客户端请求头基础上设置的 Header
+	Body    map[string]interface{} `mapstructure:"body" json:"body,omitempty"`       // 请求体模板，语法与 requestTransform 相同
+	// DependsOn 依赖的调用，全部结束后才开始该调用；没有依赖的调用并行执行
+	DependsOn []string `mapstructure:"dependsOn" json:"dependsOn,omitempty"`
+	Timeout   Duration `mapstructure:"timeout" json:"timeout,omitempty"` // 调用的总超时，默认使用路由的超时配置
+	// OnError 转发失败或返回非 2xx 时的处理方式：fail（默认）、omit 或 default
+	OnError string      `mapstructure:"onError" json:"onError,omitempty"`
+	Default interface{} `mapstructure:"default" json:"default,omitempty"`
+}
+
+// RespondConfig 路由直接返回的本地响应：固定内容、由 DSL 生成的 JSON 或重定向
+// 本地响应与后端响应一样经过 AfterForward Hook、responseTransform 和 responseHeaders
+type RespondConfig struct {
+	// Status 状态码，默认 200，重定向默认 302
+	Status int `mapstructure:"status" json:"status,omitempty"`
+	// Headers 响应头，值的语法与 requestHeaders.set 相同
+	Headers map[string]interface{} `mapstructure:"headers" json:"headers,omitempty"`
+	// Body 固定的响应体
+	Body string `mapstructure:"body" json:"body,omitempty"`
+	// Template 由请求生成 JSON 响应体的模板，语法与 requestTransform 相同，"$.xxx" 取客户端请求体
+	Template map[string]interface{} `mapstructure:"template" json:"template,omitempty"`
+	// Redirect 重定向地址，{name} 引用路径参数，{@ctx.xxx} / {$.xxx} 引用表达式的值
+	Redirect string `mapstructure:"redirect" json:"redirect,omitempty"`
+	// KeepQuery 重定向时带上客户端的查询参数
+	KeepQuery bool `mapstructure:"keepQuery" json:"keepQuery,omitempty"`
+}
+
+// CacheStoreConfig 响应缓存的内存存储，所有路由共享
+type CacheStoreConfig struct {
+	MaxSize      ByteSize `mapstructure:"maxSize" json:"maxSize,omitempty"`           // 总大小上限，默认 64MB，超过时淘汰最久未使用的条目
+	MaxEntrySize ByteSize `mapstructure:"maxEntrySize" json:"maxEntrySize,omitempty"` // 单个响应体的上限，默认 1MB，超过时不缓存
+}
+
+// ServerConfig 网关监听端的超时配置，为 0 表示不限制
+type ServerConfig struct {
+	ReadTimeout       Duration `mapstructure:"readTimeout" json:"readTimeout,omitempty"`             // 读取完整请求（含请求体）的超时
+	ReadHeaderTimeout Duration `mapstructure:"readHeaderTimeout" json:"readHeaderTimeout,omitempty"` // 读取请求头的超时，默认 10s
+	WriteTimeout      Duration `mapstructure:"writeTimeout" json:"writeTimeout,omitempty"`           // 写响应的超时，需大于转发的总超时
+	IdleTimeout       Duration `mapstructure:"idleTimeout" json:"idleTimeout,omitempty"`             // keep-alive 连接的空闲超时，默认 120s
+	H2C               bool     `mapstructure:"h2c" json:"h2c,omitempty"`                             // 接受明文 HTTP/2 连接，gRPC 客户端需要开启
+}
+
+// TimeoutConfig 转发到后端的超时配置，未设置的字段使用全局配置或默认值
+type TimeoutConfig struct {
+	Connect        Duration `mapstructure:"connect" json:"connect,omitempty"`               // 建立 TCP 连接，默认 5s
+	TLSHandshake   Duration `mapstructure:"tlsHandshake" json:"tlsHandshake,omitempty"`     // TLS 握手，默认 5s
+	ResponseHeader Duration `mapstructure:"responseHeader" json:"responseHeader,omitempty"` // 发送请求后等待响应头，默认 30s
+	Total          Duration `mapstructure:"total" json:"total,omitempty"`                   // 单次尝试的总耗时（含读取响应体），默认 60s，gRPC 路由未设置时不限制；重试时每次尝试重新计时
 }
 
 func Load() *Config {
@@ -67,10 +428,31 @@ func Load() *Config {
 	cfg.Port = viper.GetString("port")
 	cfg.BackendURL = viper.GetString("backendURL")
 	cfg.AuthToken = viper.GetString("authToken")
+	cfg.TrustedProxies = viper.GetStringSlice("trustedProxies")
+
+	if err := viper.UnmarshalKey("server", &cfg.Server, decodeHook()); err != nil {
+		log.Printf("Warning: failed to parse server config: %v", err)
+	}
+
+	if err := viper.UnmarshalKey("timeout", &cfg.Timeout, decodeHook()); err != nil {
+		log.Printf("Warning: failed to parse timeout config: %v", err)
+	}
+
+	if err := viper.UnmarshalKey("cache", &cfg.Cache, decodeHook()); err != nil {
+		log.Printf("Warning: failed to parse cache config: %v", err)
+	}
 
-	if err := viper.UnmarshalKey("routes", &cfg.Routes); err != nil {
+	if err := viper.UnmarshalKey("limits", &cfg.Limits, decodeHook()); err != nil {
+		log.Printf("Warning: failed to parse limits config: %v", err)
+	}
+
+	if err := viper.UnmarshalKey("routes", &cfg.Routes, decodeHook()); err != nil {
 		log.Printf("Warning: failed to parse routes: %v", err)
 	}
 
+	if err := viper.UnmarshalKey("upstreams", &cfg.Upstreams, decodeHook()); err != nil {
+		log.Printf("Warning: failed to parse upstreams: %v", err)
+	}
+
 	return &cfg
 }
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/viper"
+)
+
+// Duration 是可以用 "500ms"、"10s" 这类字符串配置的时长
+// 同时支持 YAML（viper）和管理接口的 JSON
+type Duration time.Duration
+
+// Std 返回标准库的 time.Duration
+func (d Duration) Std() time.Duration {
+	return time.Duration(d)
+}
+
+// Or 在未配置（为 0）时返回默认值
+func (d Duration) Or(fallback time.Duration) time.Duration {
+	if d <= 0 {
+		return fallback
+	}
+	return time.Duration(d)
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// UnmarshalJSON 兼容字符串（"10s"）和数字（毫秒）两种写法
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	switch value := v.(type) {
+	case string:
+		return d.UnmarshalText([]byte(value))
+	case float64:
+		*d = Duration(time.Duration(value) * time.Millisecond)
+		return nil
+	default:
+		return fmt.Errorf("invalid duration: %s", data)
+	}
+}
+
+// decodeHook 在 viper 默认 hook 的基础上增加 TextUnmarshaler 支持，用于解析 Duration
+func decodeHook() viper.DecoderConfigOption {
+	return viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		mapstructure.TextUnmarshallerHookFunc(),
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+	))
+}
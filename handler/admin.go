@@ -2,11 +2,14 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/ruke318/gateway/config"
 	"github.com/ruke318/gateway/hook"
+	"github.com/ruke318/gateway/proxy"
 	"github.com/ruke318/gateway/router"
 )
 
@@ -14,13 +17,15 @@ import (
 type AdminHandler struct {
 	router      *router.Router
 	hookManager *hook.Manager
+	forwarder   *proxy.Forwarder
 	adminToken  string // 管理 API 的访问 Token
 }
 
-func NewAdminHandler(router *router.Router, hookManager *hook.Manager, adminToken string) *AdminHandler {
+func NewAdminHandler(router *router.Router, hookManager *hook.Manager, forwarder *proxy.Forwarder, adminToken string) *AdminHandler {
 	return &AdminHandler{
 		router:      router,
 		hookManager: hookManager,
+		forwarder:   forwarder,
 		adminToken:  adminToken,
 	}
 }
@@ -44,6 +49,40 @@ func (h *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		h.handleUpdateRoute(w, r)
 	case "/admin/routes/delete":
 		h.handleDeleteRoute(w, r)
+	case "/admin/routes/conflicts":
+		h.handleRouteConflicts(w, r)
+	case "/admin/routes/explain":
+		h.handleExplainRoute(w, r)
+
+	// 上游管理
+	case "/admin/upstreams":
+		h.handleUpstreams(w, r)
+
+	// 熔断器管理
+	case "/admin/breakers":
+		h.handleBreakers(w, r)
+	case "/admin/breakers/trip":
+		h.handleTripBreaker(w, r)
+	case "/admin/breakers/reset":
+		h.handleResetBreaker(w, r)
+
+	// 响应缓存管理
+	case "/admin/cache":
+		h.handleCache(w, r)
+	case "/admin/cache/purge":
+		h.handlePurgeCache(w, r)
+
+	// 流量镜像管理
+	case "/admin/mirror":
+		h.handleMirror(w, r)
+	case "/admin/mirror/clear":
+		h.handleClearMirrorDiffs(w, r)
+
+	// 灰度发布管理
+	case "/admin/canary":
+		h.handleCanary(w, r)
+	case "/admin/canary/weights":
+		h.handleCanaryWeights(w, r)
 
 	// Hook 管理
 	case "/admin/hooks/update":
@@ -63,8 +102,10 @@ type RouteRequest struct {
 }
 
 type DeleteRouteRequest struct {
+	ID     string `json:"id"` // 设置了 ID 的路由按 ID 删除
 	Path   string `json:"path"`
 	Method string `json:"method"`
+	Host   string `json:"host"` // 带 host 条件的路由需要同时提供 host
 }
 
 func (h *AdminHandler) handleRoutes(w http.ResponseWriter, r *http.Request) {
@@ -94,7 +135,7 @@ func (h *AdminHandler) handleAddRoute(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := h.router.AddRoute(req.Route); err != nil {
-		http.Error(w, fmt.Sprintf("failed to add route: %v", err), http.StatusConflict)
+		http.Error(w, fmt.Sprintf("failed to add route: %v", err), routeErrorStatus(err))
 		return
 	}
 
@@ -118,7 +159,7 @@ func (h *AdminHandler) handleUpdateRoute(w http.ResponseWriter, r *http.Request)
 	}
 
 	if err := h.router.UpdateRoute(req.Route); err != nil {
-		http.Error(w, fmt.Sprintf("failed to update route: %v", err), http.StatusNotFound)
+		http.Error(w, fmt.Sprintf("failed to update route: %v", err), routeErrorStatus(err))
 		return
 	}
 
@@ -141,8 +182,9 @@ func (h *AdminHandler) handleDeleteRoute(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if err := h.router.DeleteRoute(req.Path, req.Method); err != nil {
-		http.Error(w, fmt.Sprintf("failed to delete route: %v", err), http.StatusNotFound)
+	route := config.RouteConfig{ID: req.ID, Path: req.Path, Method: req.Method, Host: req.Host}
+	if err := h.router.RemoveRoute(route); err != nil {
+		http.Error(w, fmt.Sprintf("failed to delete route: %v", err), routeErrorStatus(err))
 		return
 	}
 
@@ -153,6 +195,364 @@ func (h *AdminHandler) handleDeleteRoute(w http.ResponseWriter, r *http.Request)
 	})
 }
 
+func (h *AdminHandler) handleRouteConflicts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	conflicts := h.router.Conflicts()
+	if conflicts == nil {
+		conflicts = []router.Conflict{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"data":    conflicts,
+	})
+}
+
+// handleExplainRoute 模拟一次请求，列出所有能匹配的路由以及最终命中的路由
+// 查询参数：method、path（可带查询串）、host，以及可重复的 header=Name:Value
+func (h *AdminHandler) handleExplainRoute(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	method := query.Get("method")
+	if method == "" {
+		method = http.MethodGet
+	}
+	probe, err := http.NewRequest(method, query.Get("path"), nil)
+	if err != nil || probe.URL.Path == "" {
+		http.Error(w, "invalid request: path is required", http.StatusBadRequest)
+		return
+	}
+	probe.Host = query.Get("host")
+	for _, header := range query["header"] {
+		name, value, ok := strings.Cut(header, ":")
+		if !ok {
+			http.Error(w, fmt.Sprintf("invalid header: %s", header), http.StatusBadRequest)
+			return
+		}
+		probe.Header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+
+	candidates := h.router.Explain(probe)
+	if candidates == nil {
+		candidates = []router.MatchCandidate{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"data":    candidates,
+	})
+}
+
+// routeErrorStatus 将路由管理错误映射为 HTTP 状态码
+func routeErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, router.ErrRouteExists):
+		return http.StatusConflict
+	case errors.Is(err, router.ErrRouteNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, router.ErrInvalidRoute):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// 上游管理接口
+
+func (h *AdminHandler) handleUpstreams(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"data":    h.forwarder.UpstreamStatuses(),
+	})
+}
+
+// 熔断器管理接口
+
+type BreakerRequest struct {
+	Route string `json:"route"` // 路由 Key，见 GET /admin/breakers 或 /admin/routes/explain
+}
+
+func (h *AdminHandler) handleBreakers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"data":    h.forwarder.BreakerStatuses(),
+	})
+}
+
+func (h *AdminHandler) handleTripBreaker(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req BreakerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if !h.routeExists(req.Route) {
+		http.Error(w, fmt.Sprintf("route not found: %s", req.Route), http.StatusNotFound)
+		return
+	}
+
+	h.forwarder.TripBreaker(req.Route)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "circuit breaker tripped",
+	})
+}
+
+func (h *AdminHandler) handleResetBreaker(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req BreakerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.forwarder.ResetBreaker(req.Route); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "circuit breaker reset",
+	})
+}
+
+func (h *AdminHandler) routeExists(key string) bool {
+	for _, route := range h.router.GetAllRoutes() {
+		if route.Key() == key {
+			return true
+		}
+	}
+	return false
+}
+
+// 响应缓存管理接口
+
+type PurgeCacheRequest struct {
+	Key   string `json:"key"`   // 按缓存 key 删除，见 GET /admin/cache
+	Route string `json:"route"` // 按路由 Key 删除该路由的所有条目
+	All   bool   `json:"all"`   // 清空缓存
+}
+
+func (h *AdminHandler) handleCache(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"data": map[string]interface{}{
+			"stats":   h.forwarder.CacheStats(),
+			"entries": h.forwarder.CacheEntries(r.URL.Query().Get("route")),
+		},
+	})
+}
+
+func (h *AdminHandler) handlePurgeCache(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req PurgeCacheRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if req.Key == "" && req.Route == "" && !req.All {
+		http.Error(w, "key, route or all is required", http.StatusBadRequest)
+		return
+	}
+
+	purged := h.forwarder.PurgeCache(req.Key, req.Route)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": fmt.Sprintf("%d cache entries purged", purged),
+		"data":    map[string]interface{}{"purged": purged},
+	})
+}
+
+// 流量镜像管理接口
+
+type ClearMirrorDiffsRequest struct {
+	Route string `json:"route"` // 只删除该路由的差异记录，为空时删除全部
+}
+
+func (h *AdminHandler) handleMirror(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"data": map[string]interface{}{
+			"stats": h.forwarder.MirrorStats(),
+			"diffs": h.forwarder.MirrorDiffs(r.URL.Query().Get("route")),
+		},
+	})
+}
+
+func (h *AdminHandler) handleClearMirrorDiffs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ClearMirrorDiffsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	cleared := h.forwarder.ClearMirrorDiffs(req.Route)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": fmt.Sprintf("%d mirror diffs cleared", cleared),
+		"data":    map[string]interface{}{"cleared": cleared},
+	})
+}
+
+// 灰度发布管理接口
+
+type CanaryWeightsRequest struct {
+	Route      string         `json:"route"`      // 路由 Key，见 GET /admin/canary
+	Weights    map[string]int `json:"weights"`    // 版本名到权重，未列出的版本保持不变
+	ResetStats bool           `json:"resetStats"` // 同时清零该路由的版本统计
+}
+
+// CanaryVariantStatus 版本的权重、流量占比和请求统计
+type CanaryVariantStatus struct {
+	Name      string  `json:"name"`
+	Weight    int     `json:"weight"`
+	Share     float64 `json:"share"` // 按权重计算的流量占比，百分比
+	Requests  uint64  `json:"requests"`
+	Errors    uint64  `json:"errors"`
+	ErrorRate float64 `json:"errorRate"`
+}
+
+// CanaryStatus 一条 canary 路由的状态
+type CanaryStatus struct {
+	Route     string                `json:"route"`
+	StickyOn  string                `json:"stickyOn,omitempty"`
+	StickyKey string                `json:"stickyKey,omitempty"`
+	Variants  []CanaryVariantStatus `json:"variants"`
+}
+
+func (h *AdminHandler) handleCanary(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	filter := r.URL.Query().Get("route")
+	statuses := make([]CanaryStatus, 0)
+	for _, route := range h.router.GetAllRoutes() {
+		if route.Canary == nil || (filter != "" && route.Key() != filter) {
+			continue
+		}
+		stats := make(map[string]proxy.VariantStats)
+		for _, s := range h.forwarder.VariantStats(route.Key()) {
+			stats[s.Variant] = s
+		}
+		total := 0
+		for _, v := range route.Canary.Variants {
+			total += v.Weight
+		}
+
+		status := CanaryStatus{Route: route.Key(), StickyOn: route.Canary.StickyOn, StickyKey: route.Canary.StickyKey}
+		for _, v := range route.Canary.Variants {
+			variant := CanaryVariantStatus{
+				Name:      v.Name,
+				Weight:    v.Weight,
+				Requests:  stats[v.Name].Requests,
+				Errors:    stats[v.Name].Errors,
+				ErrorRate: stats[v.Name].ErrorRate,
+			}
+			if total > 0 {
+				variant.Share = float64(v.Weight) * 100 / float64(total)
+			}
+			status.Variants = append(status.Variants, variant)
+		}
+		statuses = append(statuses, status)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"data":    statuses,
+	})
+}
+
+func (h *AdminHandler) handleCanaryWeights(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req CanaryWeightsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if req.Route == "" || len(req.Weights) == 0 {
+		http.Error(w, "route and weights are required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.router.SetCanaryWeights(req.Route, req.Weights); err != nil {
+		http.Error(w, fmt.Sprintf("failed to update canary weights: %v", err), routeErrorStatus(err))
+		return
+	}
+	if req.ResetStats {
+		h.forwarder.ResetVariantStats(req.Route)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "canary weights updated",
+	})
+}
+
 // Hook 管理接口
 
 type UpdateHookRequest struct {
@@ -243,6 +643,12 @@ func parseHookPoint(s string) (hook.HookPoint, error) {
 		return hook.AfterResponseTransform, nil
 	case "OnError":
 		return hook.OnError, nil
+	case "OnRetry":
+		return hook.OnRetry, nil
+	case "OnCircuitOpen":
+		return hook.OnCircuitOpen, nil
+	case "OnWebSocketMessage":
+		return hook.OnWebSocketMessage, nil
 	default:
 		return 0, fmt.Errorf("unknown hook point: %s", s)
 	}
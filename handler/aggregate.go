@@ -0,0 +1,288 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/ruke318/gateway/config"
+	"github.com/ruke318/gateway/hook"
+	"github.com/ruke318/gateway/proxy"
+	"github.com/ruke318/gateway/router"
+)
+
+// aggregateError 聚合路由中 onError 为 fail 的调用失败，整个请求失败
+type aggregateError struct {
+	call string
+	err  error
+}
+
+func (e *aggregateError) Error() string {
+	return fmt.Sprintf("aggregate call %s: %v", e.call, e.err)
+}
+
+func (e *aggregateError) Unwrap() error {
+	return e.err
+}
+
+// aggregateResult 一次调用的结果
+type aggregateResult struct {
+	// value 写入 @ctx.calls.<name>：status、header、body，失败时还有 error
+	value map[string]interface{}
+	// included 是否出现在组装的响应体中，onError 为 omit 的失败调用不出现
+	included bool
+	err      error
+}
+
+// aggregate 按依赖顺序执行聚合路由的调用，没有依赖的调用并行执行
+// 返回的响应体是以调用名为 key 的 JSON 对象，各调用的结果同时写入 ctx.Data["calls"]，供 Hook 和 responseTransform 使用
+func (g *Gateway) aggregate(r *http.Request, route *config.RouteConfig, params map[string]string, ctx *hook.HookContext) (*http.Response, []byte, error) {
+	calls := route.Aggregate.Calls
+	callCtx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	req := r.WithContext(callCtx)
+
+	index := make(map[string]int, len(calls))
+	done := make([]chan struct{}, len(calls))
+	for i, call := range calls {
+		index[call.Name] = i
+		done[i] = make(chan struct{})
+	}
+	results := make([]aggregateResult, len(calls))
+
+	var wg sync.WaitGroup
+	var failOnce sync.Once
+	var failure error
+	for i := range calls {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer close(done[i])
+			call := &calls[i]
+
+			// 依赖的调用结束后才能读取它的结果
+			deps := make(map[string]interface{}, len(call.DependsOn))
+			for _, dep := range call.DependsOn {
+				select {
+				case <-done[index[dep]]:
+				case <-callCtx.Done():
+					return
+				}
+				if value := results[index[dep]].value; value != nil {
+					deps[dep] = value
+				}
+			}
+			if callCtx.Err() != nil {
+				return
+			}
+
+			resp, body, err := g.callAggregate(req, route, call, params, ctx, deps)
+			results[i] = newAggregateResult(call, resp, body, err)
+			if results[i].err != nil {
+				failOnce.Do(func() {
+					failure = &aggregateError{call: call.Name, err: results[i].err}
+					// 其余调用的结果已经没有用处
+					cancel()
+				})
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if failure != nil {
+		return nil, nil, failure
+	}
+	if err := r.Context().Err(); err != nil {
+		return nil, nil, err
+	}
+
+	values := make(map[string]interface{}, len(calls))
+	assembled := make(map[string]interface{}, len(calls))
+	for i, call := range calls {
+		values[call.Name] = results[i].value
+		if results[i].included {
+			assembled[call.Name] = results[i].value["body"]
+		}
+	}
+	ctx.Data["calls"] = values
+
+	body, err := json.Marshal(assembled)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp := &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       http.NoBody,
+		Request:    r,
+	}
+	return resp, body, nil
+}
+
+// callAggregate 计算调用的路径、查询参数、Header 和请求体后转发
+// 表达式中的 @ctx.calls 只包含该调用依赖的调用
+func (g *Gateway) callAggregate(r *http.Request, route *config.RouteConfig, call *config.AggregateCall, params map[string]string, ctx *hook.HookContext, deps map[string]interface{}) (*http.Response, []byte, error) {
+	data := make(map[string]interface{}, len(ctx.Data)+1)
+	for k, v := range ctx.Data {
+		data[k] = v
+	}
+	data["calls"] = deps
+	body := ctx.RequestBody
+
+	path, err := g.expandTemplate(call.Path, pathSegment, params, body, data)
+	if err != nil {
+		return nil, nil, err
+	}
+	forward := false
+	query, err := g.dslTransformer.TransformQuery(nil, &config.QueryTransformConfig{Forward: &forward, Set: call.Query}, body, data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 由 Transport 协商压缩并解压，保证能解析后端的响应体
+	headers := g.requestHeaders(r)
+	headers.Del("Accept-Encoding")
+	headers.Del("Content-Type")
+	var callBody []byte
+	if call.Body != nil {
+		if callBody, err = g.dslTransformer.TransformWithContext(body, call.Body, data); err != nil {
+			return nil, nil, err
+		}
+		headers.Set("Content-Type", "application/json")
+	}
+	if headers, err = g.dslTransformer.TransformHeaders(headers, &config.HeaderTransformConfig{Set: call.Headers}, body, data); err != nil {
+		return nil, nil, err
+	}
+
+	method := call.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	opts := &proxy.ForwardOptions{
+		Method:          strings.ToUpper(method),
+		Path:            path,
+		RawQuery:        query.Encode(),
+		Body:            callBody,
+		Headers:         headers,
+		Request:         r,
+		RouteKey:        route.Key() + "#" + call.Name,
+		Retry:           route.Retry,
+		CircuitBreaker:  route.CircuitBreaker,
+		Protocol:        route.Protocol,
+		Timeout:         route.Timeout,
+		MaxResponseBody: g.maxResponseBody(route),
+	}
+	if call.Timeout > 0 {
+		timeout := config.TimeoutConfig{}
+		if route.Timeout != nil {
+			timeout = *route.Timeout
+		}
+		timeout.Total = call.Timeout
+		opts.Timeout = &timeout
+	}
+	switch {
+	case call.Upstream != "":
+		opts.Upstream, err = g.forwarder.ResolveUpstream(&config.RouteConfig{Upstream: call.Upstream})
+	case call.BackendURL != "":
+		opts.BackendURL = call.BackendURL
+	default:
+		opts.BackendURL = g.router.GetBackendURL(route)
+		opts.Upstream, err = g.forwarder.ResolveUpstream(route)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return g.forwarder.Do(opts)
+}
+
+// newAggregateResult 按调用的 onError 处理失败：非 2xx 的响应也视为失败
+func newAggregateResult(call *config.AggregateCall, resp *http.Response, body []byte, err error) aggregateResult {
+	value := make(map[string]interface{})
+	if resp != nil {
+		header := make(map[string]interface{}, len(resp.Header))
+		for k, v := range resp.Header {
+			if len(v) > 0 {
+				header[k] = v[0]
+			}
+		}
+		value["status"] = resp.StatusCode
+		value["header"] = header
+		value["body"] = parseBody(body)
+		if err == nil && (resp.StatusCode < 200 || resp.StatusCode >= 300) {
+			err = fmt.Errorf("unexpected status %d", resp.StatusCode)
+		}
+	}
+	if err == nil {
+		return aggregateResult{value: value, included: true}
+	}
+
+	value["error"] = err.Error()
+	switch call.OnError {
+	case config.AggregateOnErrorOmit:
+		return aggregateResult{value: value}
+	case config.AggregateOnErrorDefault:
+		value["body"] = call.Default
+		return aggregateResult{value: value, included: true}
+	default:
+		return aggregateResult{err: err}
+	}
+}
+
+// parseBody 解析 JSON 响应体，不是 JSON 时返回字符串
+func parseBody(body []byte) interface{} {
+	if len(body) == 0 {
+		return nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return string(body)
+	}
+	return v
+}
+
+var templatePlaceholder = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// expandTemplate 展开路径或地址模板中的占位符：{@ctx.xxx}、{$.xxx} 为表达式，值经过 encode 处理；其余为路径参数
+func (g *Gateway) expandTemplate(template string, encode func(string) (string, error), params map[string]string, body []byte, data map[string]interface{}) (string, error) {
+	var firstErr error
+	expanded := templatePlaceholder.ReplaceAllStringFunc(template, func(placeholder string) string {
+		expr := placeholder[1 : len(placeholder)-1]
+		if !strings.HasPrefix(expr, "@") && !strings.HasPrefix(expr, "$") {
+			return router.ExpandParams(placeholder, params)
+		}
+		values, err := g.dslTransformer.Values(expr, body, data)
+		if err == nil {
+			var value string
+			if value, err = encode(strings.Join(values, ",")); err == nil {
+				return value
+			}
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		return ""
+	})
+	return expanded, firstErr
+}
+
+// pathSegment 用于调用路径：Forwarder 接收未转义的路径，值原样插入，但不能包含 /、? 或 #，避免改变路径结构
+func pathSegment(value string) (string, error) {
+	if strings.ContainsAny(value, "/?#") || value == "." || value == ".." {
+		return "", fmt.Errorf("value %q cannot be used as a path segment", value)
+	}
+	return value, nil
+}
+
+// escapePath 用于重定向地址等原始 URL，值经过路径转义
+func escapePath(value string) (string, error) {
+	return url.PathEscape(value), nil
+}
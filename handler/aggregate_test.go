@@ -0,0 +1,243 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ruke318/gateway/config"
+)
+
+func decodeJSONBody(t *testing.T, w *httptest.ResponseRecorder) map[string]interface{} {
+	t.Helper()
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Invalid JSON response %q: %v", w.Body.String(), err)
+	}
+	return body
+}
+
+func TestAggregateParallel(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"path":"` + r.URL.Path + `"}`))
+	}))
+	defer backend.Close()
+
+	g := newTestGateway(nil, backend.URL, config.RouteConfig{
+		Path:   "/profile",
+		Method: "GET",
+		Aggregate: &config.AggregateConfig{Calls: []config.AggregateCall{
+			{Name: "user", Path: "/user"},
+			{Name: "orders", Path: "/orders"},
+			{Name: "points", Path: "/points"},
+		}},
+	})
+
+	start := time.Now()
+	w := serve(g, http.MethodGet, "/profile", "")
+	elapsed := time.Since(start)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d %q", w.Code, w.Body.String())
+	}
+	if elapsed >= 250*time.Millisecond {
+		t.Errorf("Independent calls should run in parallel, took %s", elapsed)
+	}
+	body := decodeJSONBody(t, w)
+	for _, name := range []string{"user", "orders", "points"} {
+		call, _ := body[name].(map[string]interface{})
+		if call["path"] != "/"+name {
+			t.Errorf("Unexpected %s result %v", name, body[name])
+		}
+	}
+}
+
+func TestAggregateDependsOn(t *testing.T) {
+	var userDone int64
+	var teamPath string
+	var teamStartedEarly bool
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/users/7":
+			time.Sleep(50 * time.Millisecond)
+			atomic.StoreInt64(&userDone, 1)
+			w.Write([]byte(`{"id":7,"teamId":"core team"}`))
+		case strings.HasPrefix(r.URL.Path, "/teams/"):
+			teamStartedEarly = atomic.LoadInt64(&userDone) == 0
+			teamPath = r.URL.EscapedPath()
+			w.Write([]byte(`{"name":"Core"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer backend.Close()
+
+	g := newTestGateway(nil, backend.URL, config.RouteConfig{
+		Path:   "/profile/{id}",
+		Method: "GET",
+		Aggregate: &config.AggregateConfig{Calls: []config.AggregateCall{
+			// 依赖的调用写在前面也要等待
+			{Name: "team", Path: "/teams/{@ctx.calls.user.body.teamId}", DependsOn: []string{"user"}},
+			{Name: "user", Path: "/users/{id}"},
+		}},
+		ResponseTransform: map[string]interface{}{
+			"id":   "$.user.id",
+			"team": "$.team.name",
+		},
+	})
+
+	w := serve(g, http.MethodGet, "/profile/7", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d %q", w.Code, w.Body.String())
+	}
+	if teamStartedEarly {
+		t.Error("Dependent call started before its dependency finished")
+	}
+	if teamPath != "/teams/core%20team" {
+		t.Errorf("Expected escaped dependent path, got %q", teamPath)
+	}
+	body := decodeJSONBody(t, w)
+	if body["id"] != float64(7) || body["team"] != "Core" {
+		t.Errorf("Unexpected response %v", body)
+	}
+}
+
+func TestAggregateOnError(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/ok" {
+			w.Write([]byte(`{"ok":true}`))
+			return
+		}
+		// 非 2xx 视为失败
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"error":"boom"}`))
+	}))
+	defer backend.Close()
+
+	g := newTestGateway(nil, backend.URL,
+		config.RouteConfig{
+			Path:   "/tolerant",
+			Method: "GET",
+			Aggregate: &config.AggregateConfig{Calls: []config.AggregateCall{
+				{Name: "main", Path: "/ok"},
+				{Name: "ads", Path: "/fail", OnError: config.AggregateOnErrorOmit},
+				{Name: "recommendations", Path: "/fail", OnError: config.AggregateOnErrorDefault, Default: []interface{}{}},
+				{Name: "status", Path: "/ok", DependsOn: []string{"ads"}, Query: map[string]interface{}{"ads": "@ctx.calls.ads.status"}},
+			}},
+		},
+		config.RouteConfig{
+			Path:   "/strict",
+			Method: "GET",
+			Aggregate: &config.AggregateConfig{Calls: []config.AggregateCall{
+				{Name: "main", Path: "/ok"},
+				{Name: "billing", Path: "/fail"},
+			}},
+		},
+	)
+
+	w := serve(g, http.MethodGet, "/tolerant", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d %q", w.Code, w.Body.String())
+	}
+	body := decodeJSONBody(t, w)
+	if _, ok := body["ads"]; ok {
+		t.Errorf("Omitted call should not appear in response, got %v", body["ads"])
+	}
+	if recs, ok := body["recommendations"].([]interface{}); !ok || len(recs) != 0 {
+		t.Errorf("Expected default value for failed call, got %v", body["recommendations"])
+	}
+	if main, _ := body["main"].(map[string]interface{}); main["ok"] != true {
+		t.Errorf("Unexpected main result %v", body["main"])
+	}
+	if _, ok := body["status"]; !ok {
+		t.Error("Call depending on an omitted call should still run")
+	}
+
+	w = serve(g, http.MethodGet, "/strict", "")
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("Expected 502 for failed call, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "Aggregate call billing failed") {
+		t.Errorf("Unexpected error body %q", w.Body.String())
+	}
+}
+
+func TestAggregateFailCancelsSiblings(t *testing.T) {
+	var mu sync.Mutex
+	var slowCancelled, dependentCalled bool
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/fail":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "/slow":
+			select {
+			case <-r.Context().Done():
+				mu.Lock()
+				slowCancelled = true
+				mu.Unlock()
+			case <-time.After(2 * time.Second):
+			}
+		case "/dependent":
+			mu.Lock()
+			dependentCalled = true
+			mu.Unlock()
+		}
+	}))
+	defer backend.Close()
+
+	g := newTestGateway(nil, backend.URL, config.RouteConfig{
+		Path:   "/dashboard",
+		Method: "GET",
+		Aggregate: &config.AggregateConfig{Calls: []config.AggregateCall{
+			{Name: "broken", Path: "/fail"},
+			{Name: "slow", Path: "/slow"},
+			{Name: "dependent", Path: "/dependent", DependsOn: []string{"slow"}},
+		}},
+	})
+
+	start := time.Now()
+	w := serve(g, http.MethodGet, "/dashboard", "")
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("Expected 502, got %d %q", w.Code, w.Body.String())
+	}
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("Failed call should cancel slow siblings, took %s", elapsed)
+	}
+
+	// 后端在连接关闭后才能观察到取消
+	deadline := time.Now().Add(time.Second)
+	for {
+		mu.Lock()
+		cancelled, called := slowCancelled, dependentCalled
+		mu.Unlock()
+		if called {
+			t.Fatal("Call depending on a cancelled call should not run")
+		}
+		if cancelled {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Slow sibling request should be cancelled")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPathSegment(t *testing.T) {
+	if v, err := pathSegment("core team"); err != nil || v != "core team" {
+		t.Errorf("Expected value to be kept, got %q %v", v, err)
+	}
+	for _, value := range []string{"a/b", "../admin", "a?x=1", "a#b", ".."} {
+		if _, err := pathSegment(value); err == nil {
+			t.Errorf("Expected %q to be rejected", value)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/ruke318/gateway/config"
+	"github.com/ruke318/gateway/hook"
+	"github.com/ruke318/gateway/proxy"
+)
+
+func cacheEnabled(route *config.RouteConfig) bool {
+	return route != nil && route.Cache != nil && route.Cache.Enabled
+}
+
+// cacheKey 按路由的缓存配置生成缓存 key，keyContext 中的表达式在 BeforeForward Hook 之后求值
+func (g *Gateway) cacheKey(r *http.Request, cfg *config.CacheConfig, ctx *hook.HookContext) (string, error) {
+	extra := make([]string, 0, len(cfg.KeyContext))
+	for _, expr := range cfg.KeyContext {
+		values, err := g.dslTransformer.Values(expr, nil, ctx.Data)
+		if err != nil {
+			return "", err
+		}
+		extra = append(extra, expr+"="+strings.Join(values, ","))
+	}
+	return proxy.CacheKey(r, cfg.KeyHeaders, extra...), nil
+}
+
+// rewrittenHeaders 返回 requestHeaders 设置、追加或改名得到的请求头，这些请求头的值可能来自上下文，参与请求合并比较
+func rewrittenHeaders(cfg *config.HeaderTransformConfig) []string {
+	if cfg == nil {
+		return nil
+	}
+	names := make([]string, 0, len(cfg.Set)+len(cfg.Append)+len(cfg.Rename))
+	for name := range cfg.Set {
+		names = append(names, name)
+	}
+	for name := range cfg.Append {
+		names = append(names, name)
+	}
+	for _, name := range cfg.Rename {
+		names = append(names, name)
+	}
+	return names
+}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/ruke318/gateway/config"
+	"github.com/ruke318/gateway/hook"
+	"github.com/ruke318/gateway/router"
+)
+
+// pickVariant 按路由的 canary 配置选择版本，在认证之后调用，粘性值可以来自认证 Hook 写入的上下文
+func (g *Gateway) pickVariant(route *config.RouteConfig, r *http.Request, ctx *hook.HookContext) (*config.CanaryVariant, error) {
+	if route == nil || route.Canary == nil {
+		return nil, nil
+	}
+	cfg := route.Canary
+	var sticky string
+	switch cfg.StickyOn {
+	case "header":
+		sticky = r.Header.Get(cfg.StickyKey)
+	case "cookie":
+		if c, err := r.Cookie(cfg.StickyKey); err == nil {
+			sticky = c.Value
+		}
+	case "context":
+		values, err := g.dslTransformer.Values(cfg.StickyKey, nil, ctx.Data)
+		if err != nil {
+			return nil, err
+		}
+		sticky = strings.Join(values, ",")
+	}
+	return router.PickVariant(cfg, sticky), nil
+}
+
+// variantRoute 返回用版本配置覆盖后的路由副本，副本只在本次请求中使用
+func variantRoute(route *config.RouteConfig, v *config.CanaryVariant) *config.RouteConfig {
+	routeCopy := *route
+	if variantBackend(v) {
+		routeCopy.Upstream = v.Upstream
+		routeCopy.Upstreams = nil
+		routeCopy.BackendURL = v.BackendURL
+	}
+	if v.BackendPath != "" {
+		routeCopy.BackendPath = v.BackendPath
+		routeCopy.BackendPathRewrite = ""
+	}
+	if v.RequestTransform != nil {
+		routeCopy.RequestTransform = v.RequestTransform
+	}
+	if v.ResponseTransform != nil {
+		routeCopy.ResponseTransform = v.ResponseTransform
+	}
+	return &routeCopy
+}
+
+// routeKey 返回转发使用的 RouteKey；指定了自己后端的版本使用独立的熔断器和重试预算，
+// 避免灰度版本的故障熔断稳定版本
+func routeKey(route *config.RouteConfig, v *config.CanaryVariant) string {
+	if v != nil && variantBackend(v) {
+		return route.Key() + "#" + v.Name
+	}
+	return route.Key()
+}
+
+// variantBackend 版本是否指定了自己的后端
+func variantBackend(v *config.CanaryVariant) bool {
+	return v.Upstream != "" || v.BackendURL != ""
+}
+
+// variantTransforms 路由的某个版本是否配置了 body 转换
+func variantTransforms(route *config.RouteConfig) bool {
+	if route.Canary == nil {
+		return false
+	}
+	for _, v := range route.Canary.Variants {
+		if len(v.RequestTransform) > 0 || len(v.ResponseTransform) > 0 {
+			return true
+		}
+	}
+	return false
+}
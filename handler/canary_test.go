@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ruke318/gateway/config"
+)
+
+func TestCanaryVariantBreaker(t *testing.T) {
+	stable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("stable"))
+	}))
+	defer stable.Close()
+	canary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(r.Header.Get("X-Backend")))
+	}))
+	defer canary.Close()
+
+	route := config.RouteConfig{
+		Path:           "/orders",
+		Method:         "GET",
+		BackendURL:     stable.URL,
+		CircuitBreaker: &config.CircuitBreakerConfig{ErrorRate: 0.5, MinRequests: 2},
+		RequestHeaders: &config.HeaderTransformConfig{
+			Set: map[string]interface{}{"X-Backend": "@ctx.route.backendUrl"},
+		},
+		Canary: &config.CanaryConfig{Variants: []config.CanaryVariant{
+			{Name: "stable", Weight: 0},
+			{Name: "canary", Weight: 100, BackendURL: canary.URL},
+		}},
+	}
+	g := newTestGateway(nil, stable.URL, route)
+
+	// 上下文中的后端地址是版本的地址
+	w := serve(g, http.MethodGet, "/orders", "")
+	if w.Code != http.StatusInternalServerError || w.Body.String() != canary.URL {
+		t.Fatalf("Expected canary backend %s, got %d %q", canary.URL, w.Code, w.Body.String())
+	}
+	serve(g, http.MethodGet, "/orders", "")
+	if w := serve(g, http.MethodGet, "/orders", ""); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected canary circuit to open, got %d", w.Code)
+	}
+	statuses := g.forwarder.BreakerStatuses()
+	if len(statuses) != 1 || statuses[0].Route != "GET /orders#canary" {
+		t.Fatalf("Expected a breaker for the canary variant only, got %+v", statuses)
+	}
+
+	// 灰度版本熔断不影响稳定版本
+	route.Canary = &config.CanaryConfig{Variants: []config.CanaryVariant{
+		{Name: "stable", Weight: 100},
+		{Name: "canary", Weight: 0, BackendURL: canary.URL},
+	}}
+	if err := g.router.UpdateRoute(route); err != nil {
+		t.Fatalf("UpdateRoute failed: %v", err)
+	}
+	if w := serve(g, http.MethodGet, "/orders", ""); w.Code != http.StatusOK || w.Body.String() != "stable" {
+		t.Errorf("Expected stable variant to be served, got %d %q", w.Code, w.Body.String())
+	}
+
+	// 版本统计仍归属路由
+	for _, s := range g.forwarder.VariantStats("") {
+		if s.Route != "GET /orders" {
+			t.Errorf("Expected variant stats under the route key, got %+v", s)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ruke318/gateway/config"
+	"github.com/ruke318/gateway/hook"
+)
+
+// sessionHook 按 X-Session 请求头把当前用户写入上下文
+type sessionHook struct{}
+
+func (sessionHook) Execute(ctx *hook.HookContext) error {
+	ctx.Data["user"] = "user-" + ctx.RequestHeaders["X-Session"]
+	return nil
+}
+
+func TestCoalesceRewrittenHeaders(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		w.Write([]byte(r.Header.Get("X-User")))
+	}))
+	defer backend.Close()
+
+	hm := hook.NewManager()
+	hm.Register(hook.AfterAuth, sessionHook{})
+	g := newTestGateway(hm, backend.URL, config.RouteConfig{
+		Path:     "/profile",
+		Method:   "GET",
+		Coalesce: true,
+		RequestHeaders: &config.HeaderTransformConfig{
+			Set: map[string]interface{}{"X-User": "@ctx.user"},
+		},
+	})
+
+	// 两个用户的请求只有上下文生成的 X-User 不同，不能合并
+	sessions := []string{"a", "b"}
+	bodies := make([]string, len(sessions))
+	var wg sync.WaitGroup
+	for i, session := range sessions {
+		wg.Add(1)
+		go func(i int, session string) {
+			defer wg.Done()
+			r := httptest.NewRequest(http.MethodGet, "/profile", nil)
+			r.Header.Set("Authorization", "Bearer "+testToken)
+			r.Header.Set("X-Session", session)
+			w := httptest.NewRecorder()
+			g.ServeHTTP(w, r)
+			bodies[i] = w.Body.String()
+		}(i, session)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&calls) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if calls != 2 {
+		t.Errorf("Expected 2 backend calls, got %d", calls)
+	}
+	for i, session := range sessions {
+		if want := "user-" + session; bodies[i] != want {
+			t.Errorf("Session %s: expected body %q, got %q", session, want, bodies[i])
+		}
+	}
+}
@@ -2,8 +2,8 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
 
 	"github.com/ruke318/gateway/config"
@@ -22,6 +22,7 @@ type Gateway struct {
 	errorHandler   *middleware.ErrorMiddleware
 	router         *router.Router
 	dslTransformer *transform.DSLTransformer
+	limits         config.BodyLimits
 }
 
 func NewGateway(hookManager *hook.Manager, forwarder *proxy.Forwarder, auth *middleware.AuthMiddleware, transform *middleware.TransformMiddleware, errorHandler *middleware.ErrorMiddleware, router *router.Router, dslTransformer *transform.DSLTransformer) *Gateway {
@@ -36,6 +37,11 @@ func NewGateway(hookManager *hook.Manager, forwarder *proxy.Forwarder, auth *mid
 	}
 }
 
+// SetBodyLimits 设置缓冲模式下 body 大小的全局上限
+func (g *Gateway) SetBodyLimits(limits config.BodyLimits) {
+	g.limits = limits
+}
+
 func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	ctx := &hook.HookContext{
 		Request:         r,
@@ -50,7 +56,48 @@ func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	body, _ := io.ReadAll(r.Body)
+	var matchedRoute *config.RouteConfig
+	var pathParams map[string]string
+	if g.router != nil {
+		route, params, err := g.router.MatchWithParams(r)
+		if err == nil {
+			matchedRoute = route
+			pathParams = params
+
+			// 转为 map[string]interface{}，便于 DSL 通过 @ctx.route.params.xxx 访问
+			routeParams := make(map[string]interface{}, len(params))
+			for k, v := range params {
+				routeParams[k] = v
+			}
+			ctx.Data["route"] = map[string]interface{}{
+				"id":            route.ID,
+				"path":          route.Path,
+				"method":        route.Method,
+				"backendUrl":    route.BackendURL,
+				"backendPath":   route.BackendPath,
+				"backendMethod": route.BackendMethod,
+				"params":        routeParams,
+			}
+		}
+	}
+
+	// 流式模式和 WebSocket 握手不读取请求体，Hook 和 DSL 中的请求体为空
+	websocket := isWebSocketRoute(matchedRoute, r)
+	streaming := websocket || g.streaming(matchedRoute)
+	var body []byte
+	if !streaming {
+		var err error
+		if body, err = readRequestBody(r.Body, g.maxRequestBody(matchedRoute)); err != nil {
+			ctx.Error = err
+			g.errorHandler.Handle(ctx)
+			if errors.Is(err, errRequestTooLarge) {
+				http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, "Read request error", http.StatusBadRequest)
+			return
+		}
+	}
 	ctx.RequestBody = body
 
 	// 将请求体解析为 JSON 并添加到 ctx.Data，便于在 DSL 中访问
@@ -68,27 +115,50 @@ func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		"body":   requestBodyData,
 	}
 
-	var matchedRoute *config.RouteConfig
-	if g.router != nil {
-		route, err := g.router.Match(r)
-		if err == nil {
-			matchedRoute = route
-			ctx.Data["route"] = map[string]interface{}{
-				"path":          route.Path,
-				"method":        route.Method,
-				"backendUrl":    route.BackendURL,
-				"backendPath":   route.BackendPath,
-				"backendMethod": route.BackendMethod,
-			}
-		}
-	}
-
 	if err := g.auth.Handle(ctx); err != nil {
 		ctx.Error = err
 		g.errorHandler.Handle(ctx)
+		if proxy.IsGRPCRequest(r) {
+			proxy.WriteGRPCStatus(w, proxy.GRPCUnauthenticated, "Unauthorized")
+			return
+		}
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
+	if writeHookResponse(w, ctx) {
+		return
+	}
+
+	if websocket {
+		g.serveWebSocket(w, r, ctx, matchedRoute, pathParams)
+		return
+	}
+
+	// canary 路由按权重选择版本，之后的转换和转发使用版本覆盖后的配置
+	// 未指定后端的版本仍用原路由解析上游，复用路由的负载均衡器和健康检查
+	upstreamRoute := matchedRoute
+	variant, variantErr := g.pickVariant(matchedRoute, r, ctx)
+	if variantErr != nil {
+		ctx.Error = variantErr
+		g.errorHandler.Handle(ctx)
+		http.Error(w, fmt.Sprintf("Canary error: %v", variantErr), http.StatusInternalServerError)
+		return
+	}
+	if variant != nil {
+		matchedRoute = variantRoute(matchedRoute, variant)
+		if variantBackend(variant) {
+			upstreamRoute = matchedRoute
+		}
+		// Hook 可能替换了 context.data，route 不存在时重新创建
+		routeData, ok := ctx.Data["route"].(map[string]interface{})
+		if !ok {
+			routeData = make(map[string]interface{})
+			ctx.Data["route"] = routeData
+		}
+		routeData["variant"] = variant.Name
+		routeData["backendUrl"] = matchedRoute.BackendURL
+		routeData["backendPath"] = matchedRoute.BackendPath
+	}
 
 	if err := g.transform.TransformRequest(ctx); err != nil {
 		ctx.Error = err
@@ -96,6 +166,9 @@ func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Transform error", http.StatusInternalServerError)
 		return
 	}
+	if writeHookResponse(w, ctx) {
+		return
+	}
 
 	if matchedRoute != nil && len(matchedRoute.RequestTransform) > 0 {
 		transformed, err := g.dslTransformer.TransformWithContext(ctx.RequestBody, matchedRoute.RequestTransform, ctx.Data)
@@ -114,26 +187,154 @@ func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Hook error", http.StatusInternalServerError)
 		return
 	}
+	if writeHookResponse(w, ctx) {
+		return
+	}
 
 	var resp *http.Response
 	var respBody []byte
 	var err error
 
-	if matchedRoute != nil {
-		backendURL := g.router.GetBackendURL(matchedRoute)
-		backendPath := g.router.GetBackendPath(matchedRoute, r.URL.Path)
-		backendMethod := g.router.GetBackendMethod(matchedRoute, r.Method)
-		resp, respBody, err = g.forwarder.ForwardWithOptions(backendMethod, backendURL, backendPath, ctx.RequestBody, r.Header)
+	if matchedRoute != nil && matchedRoute.Respond != nil {
+		var respondErr error
+		if resp, respBody, respondErr = g.respond(r, matchedRoute, pathParams, ctx); respondErr != nil {
+			ctx.Error = respondErr
+			g.errorHandler.Handle(ctx)
+			http.Error(w, fmt.Sprintf("Respond error: %v", respondErr), http.StatusInternalServerError)
+			return
+		}
+	} else if matchedRoute != nil && matchedRoute.Aggregate != nil {
+		resp, respBody, err = g.aggregate(r, matchedRoute, pathParams, ctx)
+	} else if matchedRoute != nil {
+		upstream, upstreamErr := g.forwarder.ResolveUpstream(upstreamRoute)
+		if upstreamErr != nil {
+			ctx.Error = upstreamErr
+			g.errorHandler.Handle(ctx)
+			http.Error(w, "Upstream error", http.StatusBadGateway)
+			return
+		}
+		rawQuery := r.URL.RawQuery
+		if matchedRoute.QueryTransform != nil {
+			query, err := g.dslTransformer.TransformQuery(r.URL.Query(), matchedRoute.QueryTransform, body, ctx.Data)
+			if err != nil {
+				ctx.Error = err
+				g.errorHandler.Handle(ctx)
+				http.Error(w, fmt.Sprintf("Query transform error: %v", err), http.StatusInternalServerError)
+				return
+			}
+			rawQuery = query.Encode()
+		}
+		headers, headerErr := g.dslTransformer.TransformHeaders(g.requestHeaders(r), matchedRoute.RequestHeaders, body, ctx.Data)
+		if headerErr != nil {
+			ctx.Error = headerErr
+			g.errorHandler.Handle(ctx)
+			http.Error(w, fmt.Sprintf("Header transform error: %v", headerErr), http.StatusInternalServerError)
+			return
+		}
+
+		opts := &proxy.ForwardOptions{
+			Method:         g.router.GetBackendMethod(matchedRoute, r.Method),
+			BackendURL:     g.router.GetBackendURL(matchedRoute),
+			Path:           g.router.GetBackendPath(matchedRoute, r.URL.Path, pathParams),
+			RawQuery:       rawQuery,
+			Body:           ctx.RequestBody,
+			Headers:        headers,
+			Upstream:       upstream,
+			Request:        r,
+			RouteKey:       routeKey(matchedRoute, variant),
+			Retry:          matchedRoute.Retry,
+			CircuitBreaker: matchedRoute.CircuitBreaker,
+			Protocol:       matchedRoute.Protocol,
+			Timeout:        matchedRoute.Timeout,
+			OnRetry: func(attempt int, reason string) error {
+				ctx.Data["retry"] = map[string]interface{}{
+					"attempt": attempt,
+					"reason":  reason,
+				}
+				return g.hookManager.Execute(hook.OnRetry, ctx)
+			},
+		}
+		if sseEnabled(matchedRoute) {
+			opts.IdleTimeout = matchedRoute.SSE.IdleTimeout.Or(defaultSSEIdleTimeout)
+		}
+		if streaming && r.ContentLength != 0 {
+			opts.BodyReader = r.Body
+			opts.ContentLength = r.ContentLength
+		}
+		opts.MaxResponseBody = g.maxResponseBody(matchedRoute)
+		if matchedRoute.Coalesce {
+			opts.Coalesce = true
+			opts.CoalesceHeaders = rewrittenHeaders(matchedRoute.RequestHeaders)
+		}
+		if cacheEnabled(matchedRoute) {
+			opts.Cache = matchedRoute.Cache
+			if opts.CacheKey, err = g.cacheKey(r, matchedRoute.Cache, ctx); err != nil {
+				ctx.Error = err
+				g.errorHandler.Handle(ctx)
+				http.Error(w, fmt.Sprintf("Cache key error: %v", err), http.StatusInternalServerError)
+				return
+			}
+			if variant != nil {
+				// 不同版本的响应可能不同，分别缓存
+				opts.CacheKey += " variant=" + variant.Name
+			}
+		}
+		if variant != nil {
+			opts.Variant = variant.Name
+		}
+
+		var grpcMethod *proxy.GRPCMethod
+		if matchedRoute.GRPC != nil {
+			if grpcMethod, err = g.forwarder.GRPCMethod(matchedRoute.GRPC); err != nil {
+				ctx.Error = err
+				g.errorHandler.Handle(ctx)
+				http.Error(w, "gRPC method error", http.StatusInternalServerError)
+				return
+			}
+			if err = transcodeRequest(opts, grpcMethod, ctx.RequestBody); err != nil {
+				ctx.Error = err
+				g.errorHandler.Handle(ctx)
+				http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+				return
+			}
+		}
+
+		mirrored := g.startMirror(matchedRoute, opts)
+		resp, respBody, err = g.forward(opts, streaming)
+		mirrored(resp, respBody, err)
+
+		if errors.Is(err, proxy.ErrCircuitOpen) && matchedRoute.CircuitBreaker != nil && matchedRoute.CircuitBreaker.Fallback != nil {
+			fallback := matchedRoute.CircuitBreaker.Fallback
+			if fallback.Upstream == "" {
+				g.writeFallback(w, ctx, matchedRoute, fallback)
+				return
+			}
+			resp, respBody, err = g.forwardFallback(opts, fallback.Upstream, streaming)
+		}
+		if err == nil && grpcMethod != nil {
+			respBody, err = transcodeResponse(resp, respBody, grpcMethod, ctx)
+		}
 	} else {
-		resp, respBody, err = g.forwarder.Forward(r, ctx.RequestBody)
+		resp, respBody, err = g.forwarder.Do(&proxy.ForwardOptions{
+			Method:          r.Method,
+			Path:            r.URL.Path,
+			RawQuery:        r.URL.RawQuery,
+			Body:            ctx.RequestBody,
+			Headers:         g.requestHeaders(r),
+			Request:         r,
+			MaxResponseBody: g.maxResponseBody(nil),
+		})
 	}
 
 	if err != nil {
 		ctx.Error = err
 		g.errorHandler.Handle(ctx)
-		http.Error(w, "Forward error", http.StatusBadGateway)
+		writeForwardError(w, r, err)
 		return
 	}
+	if streaming {
+		defer resp.Body.Close()
+	}
 
 	ctx.Response = resp
 	ctx.ResponseBody = respBody
@@ -155,6 +356,9 @@ func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Hook error", http.StatusInternalServerError)
 		return
 	}
+	if writeHookResponse(w, ctx) {
+		return
+	}
 
 	if err := g.transform.TransformResponse(ctx); err != nil {
 		ctx.Error = err
@@ -162,8 +366,12 @@ func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Transform error", http.StatusInternalServerError)
 		return
 	}
+	if writeHookResponse(w, ctx) {
+		return
+	}
 
-	if matchedRoute != nil && len(matchedRoute.ResponseTransform) > 0 {
+	// 304 没有响应体，不做转换
+	if matchedRoute != nil && len(matchedRoute.ResponseTransform) > 0 && !streaming && resp.StatusCode != http.StatusNotModified {
 		transformed, err := g.dslTransformer.TransformWithContext(ctx.ResponseBody, matchedRoute.ResponseTransform, ctx.Data)
 		if err != nil {
 			ctx.Error = err
@@ -174,9 +382,168 @@ func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		ctx.ResponseBody = transformed
 	}
 
+	if proxy.IsGRPCRequest(r) && resp.StatusCode != http.StatusOK && resp.Header.Get("Grpc-Status") == "" {
+		// 后端（或其前面的代理）返回了非 gRPC 的错误响应，转换为 gRPC 客户端能识别的状态
+		proxy.WriteGRPCStatus(w, proxy.GRPCStatusFromHTTP(resp.StatusCode), http.StatusText(resp.StatusCode))
+		return
+	}
+
+	copyResponseHeaders(w.Header(), resp.Header)
+	if !streaming {
+		// 缓冲模式下响应体可能被 Hook 或 DSL 改写，由 net/http 重新计算长度
+		w.Header().Del("Content-Length")
+	}
+	if matchedRoute != nil && matchedRoute.ResponseHeaders != nil {
+		headers, err := g.dslTransformer.TransformHeaders(w.Header(), matchedRoute.ResponseHeaders, respBody, ctx.Data)
+		if err != nil {
+			ctx.Error = err
+			g.errorHandler.Handle(ctx)
+			http.Error(w, fmt.Sprintf("Header transform error: %v", err), http.StatusInternalServerError)
+			return
+		}
+		replaceHeaders(w.Header(), headers)
+	}
 	for k, v := range ctx.ResponseHeaders {
 		w.Header().Set(k, v)
 	}
 	w.WriteHeader(resp.StatusCode)
+	if streaming {
+		if sseEnabled(matchedRoute) && len(matchedRoute.SSE.EventTransform) > 0 && proxy.IsEventStream(resp.Header) {
+			if err := g.copyEvents(w, resp.Body, ctx, matchedRoute.SSE); errors.Is(err, proxy.ErrEventTooLarge) {
+				// 响应头已经发出，中断连接，避免客户端把截断的流当作正常结束
+				ctx.Error = err
+				g.errorHandler.Handle(ctx)
+				panic(http.ErrAbortHandler)
+			}
+		} else {
+			copyStream(w, resp.Body)
+		}
+	} else {
+		w.Write(ctx.ResponseBody)
+	}
+	// 响应体读完后 resp.Trailer 才有值（如 gRPC 的 grpc-status）
+	copyTrailers(w.Header(), resp.Trailer)
+}
+
+// requestHeaders 返回转发给后端的请求头，去掉网关自身的鉴权凭证
+// 逐跳 Header 和 X-Forwarded-* 由 Forwarder 处理
+func (g *Gateway) requestHeaders(r *http.Request) http.Header {
+	headers := r.Header.Clone()
+	g.auth.RemoveCredentials(headers)
+	return headers
+}
+
+// writeForwardError 根据转发错误的类型返回对应的状态码，gRPC 请求返回对应的 grpc-status
+func writeForwardError(w http.ResponseWriter, r *http.Request, err error) {
+	status, code, message := http.StatusBadGateway, proxy.GRPCUnavailable, "Forward error"
+	var grpcErr *proxy.GRPCError
+	var aggErr *aggregateError
+	switch {
+	case errors.Is(err, proxy.ErrNoAvailableTarget):
+		status, message = http.StatusServiceUnavailable, "No available upstream"
+	case errors.Is(err, proxy.ErrCircuitOpen):
+		status, message = http.StatusServiceUnavailable, "Circuit breaker open"
+	case proxy.IsTimeout(err):
+		status, code, message = http.StatusGatewayTimeout, proxy.GRPCDeadlineExceeded, "Gateway timeout"
+	case errors.Is(err, proxy.ErrResponseTooLarge):
+		message = "Response body too large"
+	case errors.As(err, &aggErr):
+		message = fmt.Sprintf("Aggregate call %s failed", aggErr.call)
+	case errors.As(err, &grpcErr):
+		// REST 转 gRPC 的路由，后端返回了错误状态
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(proxy.HTTPStatusFromGRPC(grpcErr.Code))
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"code":    grpcErr.Code,
+			"message": grpcErr.Message,
+		})
+		return
+	}
+	if proxy.IsGRPCRequest(r) {
+		proxy.WriteGRPCStatus(w, code, message)
+		return
+	}
+	http.Error(w, message, status)
+}
+
+// forward 按 body 处理方式选择缓冲或流式转发
+func (g *Gateway) forward(opts *proxy.ForwardOptions, streaming bool) (*http.Response, []byte, error) {
+	if streaming {
+		resp, err := g.forwarder.DoStream(opts)
+		return resp, nil, err
+	}
+	return g.forwarder.Do(opts)
+}
+
+// forwardFallback 熔断时改为转发到降级上游组，不再重试，不经过熔断器和缓存
+func (g *Gateway) forwardFallback(opts *proxy.ForwardOptions, upstreamName string, streaming bool) (*http.Response, []byte, error) {
+	upstream, err := g.forwarder.ResolveUpstream(&config.RouteConfig{Upstream: upstreamName})
+	if err != nil {
+		return nil, nil, err
+	}
+	fallback := *opts
+	fallback.Upstream = upstream
+	fallback.RouteKey = ""
+	fallback.Retry = nil
+	fallback.CircuitBreaker = nil
+	fallback.OnRetry = nil
+	fallback.Cache = nil
+	fallback.Coalesce = false
+	fallback.Variant = ""
+	return g.forward(&fallback, streaming)
+}
+
+// writeHookResponse 写出 Hook 通过 context.response 设置的响应，没有设置时返回 false
+func writeHookResponse(w http.ResponseWriter, ctx *hook.HookContext) bool {
+	resp := ctx.ShortCircuit
+	if resp == nil {
+		return false
+	}
+	for k, v := range resp.Headers {
+		w.Header().Set(k, v)
+	}
+	w.WriteHeader(resp.Status)
+	w.Write(resp.Body)
+	return true
+}
+
+// writeFallback 熔断时直接返回降级响应
+// 配置了 Hook 时先执行 OnCircuitOpen，脚本可以修改 responseBody、responseHeaders 和 data.circuit.status
+func (g *Gateway) writeFallback(w http.ResponseWriter, ctx *hook.HookContext, route *config.RouteConfig, fallback *config.FallbackConfig) {
+	status := fallback.Status
+	if status == 0 {
+		status = http.StatusServiceUnavailable
+	}
+	ctx.ResponseBody = []byte(fallback.Body)
+	for k, v := range fallback.Headers {
+		ctx.ResponseHeaders[k] = v
+	}
+
+	if fallback.Hook {
+		ctx.Data["circuit"] = map[string]interface{}{
+			"route":  route.Key(),
+			"state":  proxy.BreakerOpen,
+			"status": status,
+		}
+		if err := g.hookManager.Execute(hook.OnCircuitOpen, ctx); err != nil {
+			ctx.Error = err
+			g.errorHandler.Handle(ctx)
+			http.Error(w, "Hook error", http.StatusInternalServerError)
+			return
+		}
+		if circuit, ok := ctx.Data["circuit"].(map[string]interface{}); ok {
+			switch v := circuit["status"].(type) {
+			case int64:
+				status = int(v)
+			case float64:
+				status = int(v)
+			}
+		}
+	}
+
+	for k, v := range ctx.ResponseHeaders {
+		w.Header().Set(k, v)
+	}
+	w.WriteHeader(status)
 	w.Write(ctx.ResponseBody)
 }
@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ruke318/gateway/config"
+	"github.com/ruke318/gateway/hook"
+	"github.com/ruke318/gateway/middleware"
+	"github.com/ruke318/gateway/proxy"
+	"github.com/ruke318/gateway/router"
+	"github.com/ruke318/gateway/transform"
+)
+
+const testToken = "test-token"
+
+func newTestGateway(hookManager *hook.Manager, backendURL string, routes ...config.RouteConfig) *Gateway {
+	if hookManager == nil {
+		hookManager = hook.NewManager()
+	}
+	return NewGateway(
+		hookManager,
+		proxy.NewForwarder(backendURL),
+		middleware.NewAuthMiddleware(hookManager, testToken),
+		middleware.NewTransformMiddleware(hookManager),
+		middleware.NewErrorMiddleware(hookManager),
+		router.NewRouter(routes, backendURL),
+		transform.NewDSLTransformer(),
+	)
+}
+
+// serve 发送带网关凭证的请求
+func serve(g *Gateway, method, target, body string) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	r := httptest.NewRequest(method, target, reader)
+	r.Header.Set("Authorization", "Bearer "+testToken)
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, r)
+	return w
+}
+
+func TestHookShortCircuit(t *testing.T) {
+	var hits int64
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&hits, 1)
+		w.Write([]byte("backend"))
+	}))
+	defer backend.Close()
+
+	tests := []struct {
+		name  string
+		point hook.HookPoint
+		token bool
+	}{
+		// BeforeAuth 设置响应时不校验凭证
+		{name: "BeforeAuth", point: hook.BeforeAuth},
+		{name: "AfterAuth", point: hook.AfterAuth, token: true},
+		{name: "BeforeForward", point: hook.BeforeForward, token: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hm := hook.NewManager()
+			hm.RegisterScriptString(tt.point, `context.response = {status: 403, headers: {"X-Denied": "hook"}, body: {error: "denied"}}`)
+			g := newTestGateway(hm, backend.URL, config.RouteConfig{Path: "/orders", Method: "GET"})
+
+			r := httptest.NewRequest(http.MethodGet, "/orders", nil)
+			if tt.token {
+				r.Header.Set("Authorization", "Bearer "+testToken)
+			}
+			w := httptest.NewRecorder()
+			g.ServeHTTP(w, r)
+
+			if w.Code != http.StatusForbidden {
+				t.Errorf("Expected 403, got %d %q", w.Code, w.Body.String())
+			}
+			if w.Header().Get("X-Denied") != "hook" || w.Header().Get("Content-Type") != "application/json" {
+				t.Errorf("Unexpected headers %v", w.Header())
+			}
+			if w.Body.String() != `{"error":"denied"}` {
+				t.Errorf("Unexpected body %q", w.Body.String())
+			}
+			if n := atomic.LoadInt64(&hits); n != 0 {
+				t.Errorf("Backend should not be called, got %d requests", n)
+			}
+		})
+	}
+
+	// 没有设置响应时仍然校验凭证
+	hm := hook.NewManager()
+	hm.RegisterScriptString(hook.BeforeAuth, `context.data.checked = true`)
+	g := newTestGateway(hm, backend.URL, config.RouteConfig{Path: "/orders", Method: "GET"})
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/orders", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without response from hook, got %d", w.Code)
+	}
+}
+
+func TestHookResponseIgnoredOnRetry(t *testing.T) {
+	var hits int64
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&hits, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("backend"))
+	}))
+	defer backend.Close()
+
+	hm := hook.NewManager()
+	hm.RegisterScriptString(hook.OnRetry, `context.response = {status: 418, body: "stale"}`)
+	hm.RegisterScriptString(hook.AfterForward, `context.responseHeaders["X-After-Forward"] = "1"`)
+	g := newTestGateway(hm, backend.URL, config.RouteConfig{
+		Path:   "/orders",
+		Method: "GET",
+		Retry:  &config.RetryConfig{Attempts: 2, RetryOn: []string{"503"}, Backoff: config.Duration(1)},
+	})
+
+	w := serve(g, http.MethodGet, "/orders", "")
+	if w.Code != http.StatusOK || w.Body.String() != "backend" {
+		t.Errorf("Expected backend response, got %d %q", w.Code, w.Body.String())
+	}
+	if n := atomic.LoadInt64(&hits); n != 2 {
+		t.Errorf("Expected 2 backend requests, got %d", n)
+	}
+	// OnRetry 设置的响应不会跳过之后的 Hook
+	if w.Header().Get("X-After-Forward") != "1" {
+		t.Error("Expected AfterForward hook to run")
+	}
+}
@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/ruke318/gateway/config"
+	"github.com/ruke318/gateway/proxy"
+)
+
+func mirrorEnabled(route *config.RouteConfig) bool {
+	return route != nil && route.Mirror != nil && route.Mirror.Enabled
+}
+
+// startMirror 按路由的镜像配置在后台发送镜像请求，返回的函数在主请求结束后调用
+// 未启用镜像或镜像上游不存在时返回的函数什么也不做，镜像上游不存在只记录日志，不影响主请求
+func (g *Gateway) startMirror(route *config.RouteConfig, opts *proxy.ForwardOptions) func(*http.Response, []byte, error) {
+	if !mirrorEnabled(route) {
+		return func(*http.Response, []byte, error) {}
+	}
+	cfg := route.Mirror
+	upstream, err := g.forwarder.ResolveUpstream(&config.RouteConfig{Upstream: cfg.Upstream})
+	if err != nil {
+		log.Printf("[mirror] %s: %v", route.Key(), err)
+		return func(*http.Response, []byte, error) {}
+	}
+	return g.forwarder.Mirror(opts, upstream, cfg)
+}
@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/ruke318/gateway/config"
+	"github.com/ruke318/gateway/hook"
+)
+
+// respond 生成路由配置的本地响应，不访问后端
+// 返回的响应与后端响应一样交给 AfterForward Hook 和 responseTransform 处理
+func (g *Gateway) respond(r *http.Request, route *config.RouteConfig, params map[string]string, ctx *hook.HookContext) (*http.Response, []byte, error) {
+	cfg := route.Respond
+	body := ctx.RequestBody
+	headers := make(http.Header)
+	var respBody []byte
+	status := cfg.Status
+
+	switch {
+	case cfg.Redirect != "":
+		location, err := g.expandTemplate(cfg.Redirect, escapePath, params, body, ctx.Data)
+		if err != nil {
+			return nil, nil, err
+		}
+		if cfg.KeepQuery && r.URL.RawQuery != "" {
+			if strings.Contains(location, "?") {
+				location += "&" + r.URL.RawQuery
+			} else {
+				location += "?" + r.URL.RawQuery
+			}
+		}
+		headers.Set("Location", location)
+		if status == 0 {
+			status = http.StatusFound
+		}
+	case cfg.Template != nil:
+		transformed, err := g.dslTransformer.TransformWithContext(body, cfg.Template, ctx.Data)
+		if err != nil {
+			return nil, nil, err
+		}
+		respBody = transformed
+		headers.Set("Content-Type", "application/json")
+	default:
+		respBody = []byte(cfg.Body)
+	}
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	headers, err := g.dslTransformer.TransformHeaders(headers, &config.HeaderTransformConfig{Set: cfg.Headers}, body, ctx.Data)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp := &http.Response{
+		Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode: status,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     headers,
+		Body:       http.NoBody,
+		Request:    r,
+	}
+	return resp, respBody, nil
+}
@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/ruke318/gateway/config"
+)
+
+func TestRespond(t *testing.T) {
+	g := newTestGateway(nil, "http://127.0.0.1:1",
+		config.RouteConfig{
+			Path:   "/health",
+			Method: "GET",
+			Respond: &config.RespondConfig{
+				Status:  http.StatusAccepted,
+				Headers: map[string]interface{}{"Content-Type": "text/plain", "X-Route": "@ctx.request.path"},
+				Body:    "ok",
+			},
+		},
+		config.RouteConfig{Path: "/empty", Method: "GET", Respond: &config.RespondConfig{}},
+		config.RouteConfig{
+			Path:   "/orders",
+			Method: "POST",
+			Respond: &config.RespondConfig{
+				Status: http.StatusCreated,
+				Template: map[string]interface{}{
+					"user":   "@ctx.request.body.user",
+					"items":  "$.items",
+					"status": "created",
+				},
+			},
+		},
+	)
+
+	w := serve(g, http.MethodGet, "/health", "")
+	if w.Code != http.StatusAccepted || w.Body.String() != "ok" {
+		t.Errorf("Unexpected fixed response %d %q", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Content-Type") != "text/plain" || w.Header().Get("X-Route") != "/health" {
+		t.Errorf("Unexpected headers %v", w.Header())
+	}
+
+	w = serve(g, http.MethodGet, "/empty", "")
+	if w.Code != http.StatusOK || w.Body.Len() != 0 {
+		t.Errorf("Expected empty 200 by default, got %d %q", w.Code, w.Body.String())
+	}
+
+	w = serve(g, http.MethodPost, "/orders", `{"user":"u1","items":[1,2]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d %q", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Expected JSON content type, got %q", w.Header().Get("Content-Type"))
+	}
+	body := decodeJSONBody(t, w)
+	items, _ := body["items"].([]interface{})
+	if body["user"] != "u1" || len(items) != 2 || body["status"] != "created" {
+		t.Errorf("Unexpected template response %v", body)
+	}
+}
+
+func TestRespondRedirect(t *testing.T) {
+	g := newTestGateway(nil, "http://127.0.0.1:1",
+		config.RouteConfig{
+			Path:    "/v1/users/{id}",
+			Method:  "GET",
+			Respond: &config.RespondConfig{Redirect: "/v2/users/{id}?via={@ctx.request.method}", KeepQuery: true, Status: http.StatusMovedPermanently},
+		},
+		config.RouteConfig{
+			Path:    "/docs/{page}",
+			Method:  "GET",
+			Respond: &config.RespondConfig{Redirect: "https://docs.example.com/{page}", KeepQuery: true},
+		},
+		config.RouteConfig{
+			Path:    "/search",
+			Method:  "POST",
+			Respond: &config.RespondConfig{Redirect: "/find/{$.term}"},
+		},
+	)
+
+	tests := []struct {
+		method, target, body string
+		status               int
+		location             string
+	}{
+		// 模板中已有 ? 时用 & 追加客户端的查询参数
+		{http.MethodGet, "/v1/users/7?lang=zh&page=2", "", http.StatusMovedPermanently, "/v2/users/7?via=GET&lang=zh&page=2"},
+		{http.MethodGet, "/docs/intro?v=3", "", http.StatusFound, "https://docs.example.com/intro?v=3"},
+		{http.MethodGet, "/docs/intro", "", http.StatusFound, "https://docs.example.com/intro"},
+		// 表达式的值经过路径转义
+		{http.MethodPost, "/search?ignored=1", `{"term":"a b/c"}`, http.StatusFound, "/find/a%20b%2Fc"},
+	}
+	for _, tt := range tests {
+		w := serve(g, tt.method, tt.target, tt.body)
+		if w.Code != tt.status {
+			t.Errorf("%s: expected %d, got %d", tt.target, tt.status, w.Code)
+		}
+		if got := w.Header().Get("Location"); got != tt.location {
+			t.Errorf("%s: expected location %q, got %q", tt.target, tt.location, got)
+		}
+		if w.Body.Len() != 0 {
+			t.Errorf("%s: redirect should have empty body, got %q", tt.target, w.Body.String())
+		}
+	}
+}
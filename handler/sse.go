@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/ruke318/gateway/config"
+	"github.com/ruke318/gateway/hook"
+	"github.com/ruke318/gateway/proxy"
+)
+
+// SSE 默认的空闲超时
+const defaultSSEIdleTimeout = 5 * time.Minute
+
+func sseEnabled(route *config.RouteConfig) bool {
+	return route != nil && route.SSE != nil && route.SSE.Enabled
+}
+
+// copyEvents 逐个事件转发 SSE 响应，每个事件写完后立即 flush
+// 配置了 eventTransform 时对 JSON 格式的 data 执行 DSL 转换；心跳等非 JSON 事件原样转发
+// 转换失败时执行 OnError Hook 并原样转发该事件；事件超过 maxEventSize 时返回 proxy.ErrEventTooLarge
+func (g *Gateway) copyEvents(w http.ResponseWriter, body io.Reader, ctx *hook.HookContext, cfg *config.SSEConfig) error {
+	flusher, _ := w.(http.Flusher)
+	transform := cfg.EventTransform
+	reader := proxy.NewEventReaderSize(body, int64(cfg.MaxEventSize))
+	for {
+		event, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if data, ok := event.Data(); ok && len(transform) > 0 && json.Valid([]byte(data)) {
+			ctx.Data["event"] = map[string]interface{}{
+				"name": event.Name(),
+				"id":   event.ID(),
+			}
+			transformed, err := g.dslTransformer.TransformWithContext([]byte(data), transform, ctx.Data)
+			if err != nil {
+				ctx.Error = err
+				g.errorHandler.Handle(ctx)
+			} else {
+				event.SetData(string(transformed))
+			}
+		}
+
+		if _, err := event.WriteTo(w); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ruke318/gateway/config"
+	"github.com/ruke318/gateway/hook"
+)
+
+type countingHook struct {
+	calls int
+}
+
+func (h *countingHook) Execute(ctx *hook.HookContext) error {
+	h.calls++
+	return nil
+}
+
+func TestSSEEventTransformSkipsNonJSON(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(": keep-alive\n\n" +
+			"event: ping\ndata: heartbeat\n\n" +
+			"event: price\ndata: {\"symbol\":\"ABC\",\"price\":10}\n\n" +
+			"data: plain text\n\n"))
+	}))
+	defer backend.Close()
+
+	hm := hook.NewManager()
+	onError := &countingHook{}
+	hm.Register(hook.OnError, onError)
+	g := newTestGateway(hm, backend.URL, config.RouteConfig{
+		Path:   "/events",
+		Method: "GET",
+		SSE: &config.SSEConfig{
+			Enabled:        true,
+			EventTransform: map[string]interface{}{"s": "$.symbol", "event": "@ctx.event.name"},
+		},
+	})
+
+	w := serve(g, http.MethodGet, "/events", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d %q", w.Code, w.Body.String())
+	}
+	body := w.Body.String()
+	for _, want := range []string{"data: heartbeat\n", `data: {"event":"price","s":"ABC"}` + "\n", "data: plain text\n"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected stream to contain %q, got %q", want, body)
+		}
+	}
+	if onError.calls != 0 {
+		t.Errorf("Non-JSON events should not run the OnError hook, got %d calls", onError.calls)
+	}
+}
+
+func TestSSEEventTooLarge(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"n\":1}\n\n"))
+		// 没有换行的超长数据
+		w.Write([]byte("data: " + strings.Repeat("x", 4096)))
+	}))
+	defer backend.Close()
+
+	hm := hook.NewManager()
+	onError := &countingHook{}
+	hm.Register(hook.OnError, onError)
+	g := newTestGateway(hm, backend.URL, config.RouteConfig{
+		Path:   "/events",
+		Method: "GET",
+		SSE: &config.SSEConfig{
+			Enabled:        true,
+			EventTransform: map[string]interface{}{"n": "$.n"},
+			MaxEventSize:   1024,
+		},
+	})
+	server := httptest.NewServer(g)
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/events", nil)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err == nil {
+		t.Errorf("Oversized event should abort the stream, got %q", body)
+	}
+	if !strings.Contains(string(body), `data: {"n":1}`) {
+		t.Errorf("Events before the oversized one should be forwarded, got %q", body)
+	}
+	// 等待处理请求的 goroutine 结束后再读取计数
+	server.Close()
+	if onError.calls != 1 {
+		t.Errorf("Expected the OnError hook to run once, got %d calls", onError.calls)
+	}
+}
@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/ruke318/gateway/config"
+	"github.com/ruke318/gateway/proxy"
+)
+
+// 缓冲模式下 body 大小的默认上限
+const defaultMaxBodySize = 10 << 20
+
+var errRequestTooLarge = errors.New("request body too large")
+
+// streaming 判断路由是否使用流式转发，启用 SSE 的路由和 gRPC 路由总是流式转发，REST 转 gRPC 的路由、聚合路由和本地响应路由总是缓冲
+// auto 模式下，只有在 DSL 转换、Header 改写、Hook、重试和缓存都不需要读取 body 时才使用流式转发
+func (g *Gateway) streaming(route *config.RouteConfig) bool {
+	if route == nil || route.GRPC != nil || route.Aggregate != nil || route.Respond != nil {
+		return false
+	}
+	if sseEnabled(route) || route.Protocol == config.ProtocolGRPC {
+		return true
+	}
+	switch route.BodyMode {
+	case config.BodyModeStreaming:
+		return true
+	case config.BodyModeBuffered:
+		return false
+	}
+
+	if len(route.RequestTransform) > 0 || len(route.ResponseTransform) > 0 || route.Retry != nil || cacheEnabled(route) || route.Coalesce || mirrorEnabled(route) || variantTransforms(route) {
+		return false
+	}
+	if route.QueryTransform != nil && readsBody(route.QueryTransform.Set) {
+		return false
+	}
+	for _, cfg := range []*config.HeaderTransformConfig{route.RequestHeaders, route.ResponseHeaders} {
+		if cfg != nil && (readsBody(cfg.Set) || readsBody(cfg.Append)) {
+			return false
+		}
+	}
+	if route.Canary != nil && route.Canary.StickyOn == "context" && readsBodyExpr(route.Canary.StickyKey) {
+		return false
+	}
+	return !g.hookManager.HasHooks()
+}
+
+// readsBody 判断表达式中是否有需要读取 body 的 "$.xxx" 或 "@ctx.request.body"
+func readsBody(exprs map[string]interface{}) bool {
+	for _, expr := range exprs {
+		if readsBodyExpr(expr) {
+			return true
+		}
+	}
+	return false
+}
+
+// readsBodyExpr 判断单个表达式是否需要读取 body，嵌套的对象和数组逐项检查
+// 引用整个 "@ctx.request" 时同样会读到请求体
+func readsBodyExpr(expr interface{}) bool {
+	switch v := expr.(type) {
+	case string:
+		return strings.HasPrefix(v, "$.") || v == "@ctx.request" || v == "@ctx.request.body" || strings.HasPrefix(v, "@ctx.request.body.")
+	case map[string]interface{}:
+		return readsBody(v)
+	case []interface{}:
+		for _, item := range v {
+			if readsBodyExpr(item) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (g *Gateway) maxRequestBody(route *config.RouteConfig) int64 {
+	if route != nil && route.Limits != nil && route.Limits.MaxRequestBody > 0 {
+		return int64(route.Limits.MaxRequestBody)
+	}
+	return g.limits.MaxRequestBody.Or(defaultMaxBodySize)
+}
+
+func (g *Gateway) maxResponseBody(route *config.RouteConfig) int64 {
+	if route != nil && route.Limits != nil && route.Limits.MaxResponseBody > 0 {
+		return int64(route.Limits.MaxResponseBody)
+	}
+	return g.limits.MaxResponseBody.Or(defaultMaxBodySize)
+}
+
+// readRequestBody 读取请求体，超过 max 时返回 errRequestTooLarge
+func readRequestBody(body io.Reader, max int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(body, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > max {
+		return nil, fmt.Errorf("%w: exceeds %d bytes", errRequestTooLarge, max)
+	}
+	return data, nil
+}
+
+// copyResponseHeaders 将后端响应头（保留多值，如多个 Set-Cookie）复制到客户端响应，去掉逐跳 Header
+func copyResponseHeaders(dst, src http.Header) {
+	for k, v := range src {
+		dst[k] = append([]string(nil), v...)
+	}
+	proxy.RemoveHopHeaders(dst)
+}
+
+// replaceHeaders 用 src 替换 dst 的全部内容
+func replaceHeaders(dst, src http.Header) {
+	for k := range dst {
+		delete(dst, k)
+	}
+	for k, v := range src {
+		dst[k] = v
+	}
+}
+
+// copyTrailers 在响应体写完后设置 trailers
+// 使用 http.TrailerPrefix，不需要在写响应头之前声明 Trailer
+func copyTrailers(dst, trailer http.Header) {
+	for k, v := range trailer {
+		dst[http.TrailerPrefix+k] = append([]string(nil), v...)
+	}
+}
+
+// copyStream 边读边写响应体，每次写入后立即 flush，保证分块传输的数据及时到达客户端
+func copyStream(w http.ResponseWriter, body io.Reader) error {
+	flusher, _ := w.(http.Flusher)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			if _, writeErr := w.Write(buf[:n]); writeErr != nil {
+				return writeErr
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
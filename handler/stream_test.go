@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ruke318/gateway/config"
+)
+
+func TestStreamingAutoMode(t *testing.T) {
+	g := newTestGateway(nil, "http://localhost:9090")
+	headers := func(expr interface{}) *config.HeaderTransformConfig {
+		return &config.HeaderTransformConfig{Set: map[string]interface{}{"X-Value": expr}}
+	}
+
+	tests := []struct {
+		name      string
+		route     config.RouteConfig
+		streaming bool
+	}{
+		{name: "plain", route: config.RouteConfig{}, streaming: true},
+		{name: "context header", route: config.RouteConfig{RequestHeaders: headers("@ctx.route.id")}, streaming: true},
+		{name: "jsonpath header", route: config.RouteConfig{RequestHeaders: headers("$.name")}, streaming: false},
+		{name: "context body header", route: config.RouteConfig{RequestHeaders: headers("@ctx.request.body.name")}, streaming: false},
+		{name: "whole request", route: config.RouteConfig{ResponseHeaders: headers("@ctx.request")}, streaming: false},
+		{name: "nested append", route: config.RouteConfig{RequestHeaders: &config.HeaderTransformConfig{
+			Append: map[string]interface{}{"X-Tags": []interface{}{"fixed", "@ctx.request.body.tag"}},
+		}}, streaming: false},
+		{name: "context body query", route: config.RouteConfig{QueryTransform: &config.QueryTransformConfig{
+			Set: map[string]interface{}{"name": "@ctx.request.body"},
+		}}, streaming: false},
+		{name: "context sticky key", route: config.RouteConfig{Canary: &config.CanaryConfig{
+			StickyOn: "context", StickyKey: "@ctx.request.body.user",
+			Variants: []config.CanaryVariant{{Name: "stable", Weight: 1}},
+		}}, streaming: false},
+		{name: "header sticky key", route: config.RouteConfig{Canary: &config.CanaryConfig{
+			StickyOn: "header", StickyKey: "X-User",
+			Variants: []config.CanaryVariant{{Name: "stable", Weight: 1}},
+		}}, streaming: true},
+	}
+	for _, tt := range tests {
+		if got := g.streaming(&tt.route); got != tt.streaming {
+			t.Errorf("%s: expected streaming %v, got %v", tt.name, tt.streaming, got)
+		}
+	}
+}
+
+func TestContextBodyHeader(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write([]byte(r.Header.Get("X-Name") + " " + string(body)))
+	}))
+	defer backend.Close()
+
+	g := newTestGateway(nil, backend.URL, config.RouteConfig{
+		Path:   "/users",
+		Method: "POST",
+		RequestHeaders: &config.HeaderTransformConfig{
+			Set: map[string]interface{}{"X-Name": "@ctx.request.body.name"},
+		},
+	})
+
+	// auto 模式下引用请求体的路由改为缓冲转发，请求体仍然原样发给后端
+	w := serve(g, http.MethodPost, "/users", `{"name":"alice"}`)
+	if want := `alice {"name":"alice"}`; w.Body.String() != want {
+		t.Errorf("Expected %q, got %q", want, w.Body.String())
+	}
+}
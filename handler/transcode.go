@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/ruke318/gateway/config"
+	"github.com/ruke318/gateway/hook"
+	"github.com/ruke318/gateway/proxy"
+)
+
+// transcodeRequest 将 JSON 请求体转为 gRPC 调用，路径和查询参数由 gRPC 方法决定
+func transcodeRequest(opts *proxy.ForwardOptions, method *proxy.GRPCMethod, body []byte) error {
+	grpcBody, err := method.EncodeRequest(body)
+	if err != nil {
+		return err
+	}
+	opts.Method = http.MethodPost
+	opts.Path = method.Path()
+	opts.RawQuery = ""
+	opts.Body = grpcBody
+	opts.Headers = proxy.GRPCRequestHeaders(opts.Headers)
+	opts.Protocol = config.ProtocolH2
+	return nil
+}
+
+// transcodeResponse 将 gRPC 响应转为 JSON；后端返回错误状态时返回 *proxy.GRPCError
+func transcodeResponse(resp *http.Response, body []byte, method *proxy.GRPCMethod, ctx *hook.HookContext) ([]byte, error) {
+	data, err := method.DecodeResponse(resp, body)
+	if err != nil {
+		return nil, err
+	}
+
+	// 之后的 Hook、响应转换看到的是普通 JSON 响应，gRPC 的响应头和 trailers 不返回给客户端
+	header := make(http.Header, len(resp.Header))
+	for k, v := range resp.Header {
+		header[k] = v
+	}
+	for _, k := range []string{"Content-Length", "Grpc-Status", "Grpc-Message", "Grpc-Encoding", "Grpc-Accept-Encoding"} {
+		header.Del(k)
+	}
+	header.Set("Content-Type", "application/json")
+	resp.Header = header
+	resp.Trailer = nil
+	if _, ok := ctx.ResponseHeaders["Content-Type"]; !ok {
+		ctx.ResponseHeaders["Content-Type"] = "application/json"
+	}
+	return data, nil
+}
@@ -0,0 +1,209 @@
+package handler
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/ruke318/gateway/config"
+	"github.com/ruke318/gateway/hook"
+	"github.com/ruke318/gateway/proxy"
+)
+
+// 开启 MessageHook 时单条消息的默认上限
+const defaultMaxWebSocketMessage = 1 << 20
+
+// isWebSocketRoute 判断请求是否为启用了 WebSocket 代理的路由上的握手请求
+func isWebSocketRoute(route *config.RouteConfig, r *http.Request) bool {
+	return route != nil && route.WebSocket != nil && route.WebSocket.Enabled && proxy.IsWebSocketUpgrade(r)
+}
+
+// serveWebSocket 将握手转发到后端，后端同意升级后接管客户端连接并双向转发帧
+// 调用前已完成鉴权；握手阶段执行 BeforeForward Hook，不做 body 转换和重试
+func (g *Gateway) serveWebSocket(w http.ResponseWriter, r *http.Request, ctx *hook.HookContext, route *config.RouteConfig, params map[string]string) {
+	if err := g.hookManager.Execute(hook.BeforeForward, ctx); err != nil {
+		ctx.Error = err
+		g.errorHandler.Handle(ctx)
+		http.Error(w, "Hook error", http.StatusInternalServerError)
+		return
+	}
+	if writeHookResponse(w, ctx) {
+		return
+	}
+
+	upstream, err := g.forwarder.ResolveUpstream(route)
+	if err != nil {
+		ctx.Error = err
+		g.errorHandler.Handle(ctx)
+		http.Error(w, "Upstream error", http.StatusBadGateway)
+		return
+	}
+	rawQuery := r.URL.RawQuery
+	if route.QueryTransform != nil {
+		query, err := g.dslTransformer.TransformQuery(r.URL.Query(), route.QueryTransform, nil, ctx.Data)
+		if err != nil {
+			ctx.Error = err
+			g.errorHandler.Handle(ctx)
+			http.Error(w, fmt.Sprintf("Query transform error: %v", err), http.StatusInternalServerError)
+			return
+		}
+		rawQuery = query.Encode()
+	}
+
+	headers, err := g.dslTransformer.TransformHeaders(g.requestHeaders(r), route.RequestHeaders, nil, ctx.Data)
+	if err != nil {
+		ctx.Error = err
+		g.errorHandler.Handle(ctx)
+		http.Error(w, fmt.Sprintf("Header transform error: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if route.WebSocket.MessageHook {
+		// 网关需要解析帧内容，不能让两端协商出压缩等扩展
+		headers.Del("Sec-WebSocket-Extensions")
+	}
+
+	backend, err := g.forwarder.DialUpgrade(&proxy.ForwardOptions{
+		Method:         r.Method,
+		BackendURL:     g.router.GetBackendURL(route),
+		Path:           g.router.GetBackendPath(route, r.URL.Path, params),
+		RawQuery:       rawQuery,
+		Headers:        headers,
+		Upstream:       upstream,
+		Request:        r,
+		RouteKey:       route.Key(),
+		CircuitBreaker: route.CircuitBreaker,
+		Timeout:        route.Timeout,
+	})
+	if err != nil {
+		ctx.Error = err
+		g.errorHandler.Handle(ctx)
+		writeForwardError(w, r, err)
+		return
+	}
+	defer backend.Close()
+
+	resp := backend.Response
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		// 后端拒绝升级，按普通响应返回给客户端
+		defer resp.Body.Close()
+		copyResponseHeaders(w.Header(), resp.Header)
+		for k, v := range ctx.ResponseHeaders {
+			w.Header().Set(k, v)
+		}
+		w.WriteHeader(resp.StatusCode)
+		copyStream(w, resp.Body)
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "WebSocket not supported", http.StatusInternalServerError)
+		return
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		ctx.Error = err
+		g.errorHandler.Handle(ctx)
+		return
+	}
+	defer conn.Close()
+	// 升级后的连接是长连接，不受 server 的读写超时限制
+	conn.SetDeadline(time.Time{})
+
+	if err := writeSwitchingProtocols(rw.Writer, resp); err != nil {
+		return
+	}
+
+	client := &hijackedConn{Reader: rw.Reader, Conn: conn}
+	var filter proxy.WebSocketFilter
+	if route.WebSocket.MessageHook {
+		filter = g.webSocketFilter(ctx)
+	}
+	maxMessageSize := route.WebSocket.MaxMessageSize.Or(defaultMaxWebSocketMessage)
+	if err := proxy.RelayWebSocket(client, backend, filter, maxMessageSize); err != nil {
+		ctx.Error = err
+		g.errorHandler.Handle(ctx)
+	}
+}
+
+// webSocketFilter 为每条消息执行 OnWebSocketMessage Hook
+// 脚本通过 data.websocket 读取 direction（client 或 server）、type（text 或 binary）和 message，
+// 可以修改 message，或设置 drop 为 true 丢弃该消息；Hook 出错时关闭连接
+func (g *Gateway) webSocketFilter(ctx *hook.HookContext) proxy.WebSocketFilter {
+	return func(msg *proxy.WebSocketMessage) (bool, error) {
+		direction := "server"
+		if msg.FromClient {
+			direction = "client"
+		}
+		messageType := "binary"
+		if msg.Text {
+			messageType = "text"
+		}
+		message := string(msg.Data)
+
+		// 两个方向的消息并发处理，每条消息使用独立的上下文，避免共享 map
+		msgCtx := &hook.HookContext{
+			Request:         ctx.Request,
+			RequestHeaders:  copyStringMap(ctx.RequestHeaders),
+			ResponseHeaders: copyStringMap(ctx.ResponseHeaders),
+			Data:            make(map[string]interface{}, len(ctx.Data)+1),
+		}
+		for k, v := range ctx.Data {
+			msgCtx.Data[k] = v
+		}
+		msgCtx.Data["websocket"] = map[string]interface{}{
+			"direction": direction,
+			"type":      messageType,
+			"message":   message,
+		}
+
+		if err := g.hookManager.Execute(hook.OnWebSocketMessage, msgCtx); err != nil {
+			return false, err
+		}
+
+		ws, _ := msgCtx.Data["websocket"].(map[string]interface{})
+		if drop, _ := ws["drop"].(bool); drop {
+			return false, nil
+		}
+		// 只在脚本修改了内容时替换，避免二进制消息经过字符串转换后失真
+		if m, ok := ws["message"].(string); ok && m != message {
+			msg.Data = []byte(m)
+		}
+		return true, nil
+	}
+}
+
+// writeSwitchingProtocols 将后端的 101 响应头原样返回给客户端
+func writeSwitchingProtocols(w *bufio.Writer, resp *http.Response) error {
+	if _, err := fmt.Fprintf(w, "HTTP/1.1 %s\r\n", resp.Status); err != nil {
+		return err
+	}
+	if err := resp.Header.Write(w); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, "\r\n"); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// hijackedConn 从 Hijack 返回的缓冲读取器读取，避免丢失握手后客户端已经发送的数据
+type hijackedConn struct {
+	*bufio.Reader
+	net.Conn
+}
+
+func (c *hijackedConn) Read(p []byte) (int, error) {
+	return c.Reader.Read(p)
+}
+
+func copyStringMap(m map[string]string) map[string]string {
+	copy := make(map[string]string, len(m))
+	for k, v := range m {
+		copy[k] = v
+	}
+	return copy
+}
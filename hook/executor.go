@@ -1,8 +1,11 @@
 package hook
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
+	"strings"
+	"sync"
 
 	"github.com/dop251/goja"
 )
@@ -10,6 +13,7 @@ import (
 type JSExecutor struct {
 	vm     *goja.Runtime
 	script string
+	mu     sync.Mutex // goja.Runtime 不能并发使用
 }
 
 func NewJSExecutor(script string) *JSExecutor {
@@ -40,6 +44,9 @@ func NewJSExecutor(script string) *JSExecutor {
 }
 
 func (e *JSExecutor) Execute(ctx *HookContext) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
 	e.vm.Set("context", map[string]interface{}{
 		"requestBody":     string(ctx.RequestBody),
 		"responseBody":    string(ctx.ResponseBody),
@@ -79,7 +86,65 @@ func (e *JSExecutor) Execute(ctx *HookContext) error {
 		if data, ok := resultMap["data"].(map[string]interface{}); ok {
 			ctx.Data = data
 		}
+		if response, ok := resultMap["response"]; ok && response != nil {
+			resp, err := parseHookResponse(response)
+			if err != nil {
+				return err
+			}
+			ctx.ShortCircuit = resp
+		}
 	}
 
 	return nil
 }
+
+// parseHookResponse 解析脚本设置的 context.response = {status, headers, body}
+// status 默认 200；body 不是字符串时编码为 JSON，未指定 Content-Type 时设为 application/json
+func parseHookResponse(v interface{}) (*HookResponse, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("context.response must be an object")
+	}
+	resp := &HookResponse{Status: 200, Headers: make(map[string]string)}
+	switch status := m["status"].(type) {
+	case nil:
+	case int64:
+		resp.Status = int(status)
+	case float64:
+		resp.Status = int(status)
+	default:
+		return nil, fmt.Errorf("invalid context.response status: %v", status)
+	}
+	if resp.Status < 100 || resp.Status > 599 {
+		return nil, fmt.Errorf("invalid context.response status: %d", resp.Status)
+	}
+	if headers, ok := m["headers"].(map[string]interface{}); ok {
+		for k, v := range headers {
+			resp.Headers[k] = fmt.Sprint(v)
+		}
+	}
+	switch body := m["body"].(type) {
+	case nil:
+	case string:
+		resp.Body = []byte(body)
+	default:
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid context.response body: %w", err)
+		}
+		resp.Body = data
+		if !hasHeader(resp.Headers, "Content-Type") {
+			resp.Headers["Content-Type"] = "application/json"
+		}
+	}
+	return resp, nil
+}
+
+func hasHeader(headers map[string]string, name string) bool {
+	for k := range headers {
+		if strings.EqualFold(k, name) {
+			return true
+		}
+	}
+	return false
+}
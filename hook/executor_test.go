@@ -0,0 +1,169 @@
+package hook
+
+import (
+	"net/http"
+	"testing"
+)
+
+func newTestContext() *HookContext {
+	return &HookContext{
+		Request:         &http.Request{Header: http.Header{}},
+		RequestHeaders:  map[string]string{},
+		ResponseHeaders: map[string]string{},
+		Data:            map[string]interface{}{},
+	}
+}
+
+func TestHookResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  string
+		status  int
+		headers map[string]string
+		body    string
+		err     bool
+	}{
+		{name: "default status", script: `context.response = {body: "ok"}`, status: 200, body: "ok"},
+		{name: "status", script: `context.response = {status: 403}`, status: 403},
+		{name: "float status", script: `context.response = {status: 503.0}`, status: 503},
+		{
+			name:    "header values",
+			script:  `context.response = {status: 503, headers: {"Retry-After": 30, "X-Flag": true}, body: "down"}`,
+			status:  503,
+			headers: map[string]string{"Retry-After": "30", "X-Flag": "true"},
+			body:    "down",
+		},
+		{
+			name:    "object body",
+			script:  `context.response = {body: {items: [1, 2], total: 2}}`,
+			status:  200,
+			headers: map[string]string{"Content-Type": "application/json"},
+			body:    `{"items":[1,2],"total":2}`,
+		},
+		{
+			name:    "object body keeps content type",
+			script:  `context.response = {headers: {"content-type": "application/problem+json"}, body: {error: "denied"}}`,
+			status:  200,
+			headers: map[string]string{"content-type": "application/problem+json"},
+			body:    `{"error":"denied"}`,
+		},
+		{name: "status too small", script: `context.response = {status: 42}`, err: true},
+		{name: "status too large", script: `context.response = {status: 600}`, err: true},
+		{name: "status not a number", script: `context.response = {status: "ok"}`, err: true},
+		{name: "not an object", script: `context.response = "denied"`, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := newTestContext()
+			err := NewJSExecutor(tt.script).Execute(ctx)
+			if tt.err {
+				if err == nil {
+					t.Errorf("Expected error, got response %+v", ctx.ShortCircuit)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Execute failed: %v", err)
+			}
+			resp := ctx.ShortCircuit
+			if resp == nil {
+				t.Fatal("Expected response to be set")
+			}
+			if resp.Status != tt.status {
+				t.Errorf("Expected status %d, got %d", tt.status, resp.Status)
+			}
+			if len(resp.Headers) != len(tt.headers) {
+				t.Errorf("Expected headers %v, got %v", tt.headers, resp.Headers)
+			}
+			for k, v := range tt.headers {
+				if resp.Headers[k] != v {
+					t.Errorf("Expected header %s=%q, got %q", k, v, resp.Headers[k])
+				}
+			}
+			if string(resp.Body) != tt.body {
+				t.Errorf("Expected body %q, got %q", tt.body, resp.Body)
+			}
+		})
+	}
+}
+
+func TestHookWithoutResponse(t *testing.T) {
+	ctx := newTestContext()
+	if err := NewJSExecutor(`context.data.user = "u1"`).Execute(ctx); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if ctx.ShortCircuit != nil {
+		t.Errorf("Expected no response, got %+v", ctx.ShortCircuit)
+	}
+}
+
+type countingHook struct {
+	calls int
+}
+
+func (h *countingHook) Execute(ctx *HookContext) error {
+	h.calls++
+	return nil
+}
+
+func TestManagerStopsAfterResponse(t *testing.T) {
+	m := NewManager()
+	first := &countingHook{}
+	later := &countingHook{}
+	m.Register(BeforeForward, first)
+	m.RegisterScriptString(BeforeForward, `context.response = {status: 418}`)
+	m.Register(BeforeForward, later)
+	m.Register(AfterForward, later)
+
+	ctx := newTestContext()
+	if err := m.Execute(BeforeForward, ctx); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if first.calls != 1 || later.calls != 0 {
+		t.Errorf("Expected hooks after the response to be skipped, got first=%d later=%d", first.calls, later.calls)
+	}
+	if ctx.ShortCircuit == nil || ctx.ShortCircuit.Status != 418 {
+		t.Fatalf("Expected response 418, got %+v", ctx.ShortCircuit)
+	}
+
+	// 之后的节点也不再执行
+	if err := m.Execute(AfterForward, ctx); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if later.calls != 0 {
+		t.Errorf("Expected AfterForward hooks to be skipped, got %d calls", later.calls)
+	}
+}
+
+func TestManagerIgnoresResponseAtOtherPoints(t *testing.T) {
+	for _, point := range []HookPoint{OnError, OnRetry, OnCircuitOpen, OnWebSocketMessage} {
+		m := NewManager()
+		later := &countingHook{}
+		m.RegisterScriptString(point, `context.response = {status: 503}`)
+		m.Register(point, later)
+		m.Register(BeforeForward, later)
+
+		ctx := newTestContext()
+		if err := m.Execute(point, ctx); err != nil {
+			t.Fatalf("Execute failed: %v", err)
+		}
+		if ctx.ShortCircuit != nil {
+			t.Errorf("Point %d: expected response to be ignored, got %+v", point, ctx.ShortCircuit)
+		}
+		if err := m.Execute(BeforeForward, ctx); err != nil {
+			t.Fatalf("Execute failed: %v", err)
+		}
+		if later.calls != 2 {
+			t.Errorf("Point %d: expected later hooks to run, got %d calls", point, later.calls)
+		}
+	}
+}
+
+func TestCanRespond(t *testing.T) {
+	for point := BeforeAuth; point <= OnWebSocketMessage; point++ {
+		want := point <= AfterResponseTransform
+		if point.CanRespond() != want {
+			t.Errorf("Point %d: expected CanRespond %v", point, want)
+		}
+	}
+}
@@ -61,12 +61,34 @@ func (m *Manager) GetHookCount(point HookPoint) int {
 	return len(m.hooks[point])
 }
 
+// HasHooks 判断是否注册了任意 Hook
+func (m *Manager) HasHooks() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, hooks := range m.hooks {
+		if len(hooks) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
 func (m *Manager) Execute(point HookPoint, ctx *HookContext) error {
 	m.mu.RLock()
 	hooks := m.hooks[point]
 	m.mu.RUnlock()
 
+	respond := point.CanRespond()
+	if !respond {
+		// 网关不会在这些节点之后检查 context.response，保留原来的值，避免后续节点误用
+		prev := ctx.ShortCircuit
+		defer func() { ctx.ShortCircuit = prev }()
+	}
 	for _, hook := range hooks {
+		// 已经有 Hook 设置了响应，后面的 Hook 不再执行
+		if respond && ctx.ShortCircuit != nil {
+			return nil
+		}
 		if err := hook.Execute(ctx); err != nil {
 			return err
 		}
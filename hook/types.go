@@ -14,8 +14,22 @@ const (
 	BeforeResponseTransform
 	AfterResponseTransform
 	OnError
+	OnRetry
+	OnCircuitOpen
+	OnWebSocketMessage
 )
 
+// CanRespond 该节点的 Hook 能否通过 context.response 直接返回响应
+// 只有请求处理流程中的节点可以；OnError、OnRetry、OnCircuitOpen、OnWebSocketMessage 设置的 context.response 会被忽略
+func (p HookPoint) CanRespond() bool {
+	switch p {
+	case BeforeAuth, AfterAuth, BeforeRequestTransform, AfterRequestTransform,
+		BeforeForward, AfterForward, BeforeResponseTransform, AfterResponseTransform:
+		return true
+	}
+	return false
+}
+
 type HookContext struct {
 	Request        *http.Request
 	Response       *http.Response
@@ -25,6 +39,15 @@ type HookContext struct {
 	ResponseHeaders map[string]string
 	Error          error
 	Data           map[string]interface{}
+	// ShortCircuit Hook 通过 context.response 设置的响应，设置后网关不再继续处理，直接返回该响应
+	ShortCircuit   *HookResponse
+}
+
+// HookResponse Hook 生成的响应
+type HookResponse struct {
+	Status  int
+	Headers map[string]string
+	Body    []byte
 }
 
 type Hook interface {
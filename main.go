@@ -3,6 +3,7 @@ package main
 import (
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/ruke318/gateway/config"
 	"github.com/ruke318/gateway/handler"
@@ -11,6 +12,8 @@ import (
 	"github.com/ruke318/gateway/proxy"
 	"github.com/ruke318/gateway/router"
 	"github.com/ruke318/gateway/transform"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 func main() {
@@ -21,25 +24,53 @@ func main() {
 	hookManager.RegisterScript(hook.OnError, "scripts/examples/error.js")
 
 	forwarder := proxy.NewForwarder(cfg.BackendURL)
+	forwarder.SetTimeout(cfg.Timeout)
+	if err := forwarder.SetUpstreams(cfg.Upstreams); err != nil {
+		log.Fatalf("invalid upstreams config: %v", err)
+	}
+	trustedProxies, err := proxy.ParseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		log.Fatalf("invalid trustedProxies config: %v", err)
+	}
+	forwarder.SetTrustedProxies(trustedProxies)
+	forwarder.SetCacheStore(proxy.NewMemoryCacheStore(cfg.Cache.MaxSize.Or(64<<20)), int64(cfg.Cache.MaxEntrySize))
 	auth := middleware.NewAuthMiddleware(hookManager, cfg.AuthToken)
 	transformMiddleware := middleware.NewTransformMiddleware(hookManager)
 	errorHandler := middleware.NewErrorMiddleware(hookManager)
 
 	routerInstance := router.NewRouter(cfg.Routes, cfg.BackendURL)
+	// 路由删除或修改后停止旧的内联上游组的健康检查
+	routerInstance.OnChange(forwarder.PruneInlineUpstreams)
 	dslTransformer := transform.NewDSLTransformer()
 
 	gateway := handler.NewGateway(hookManager, forwarder, auth, transformMiddleware, errorHandler, routerInstance, dslTransformer)
+	gateway.SetBodyLimits(cfg.Limits)
 
 	// 创建管理 API（使用单独的 Token，建议在配置中配置）
-	adminHandler := handler.NewAdminHandler(routerInstance, hookManager, "admin-secret-token")
+	adminHandler := handler.NewAdminHandler(routerInstance, hookManager, forwarder, "admin-secret-token")
 
 	// 注册路由
 	mux := http.NewServeMux()
 	mux.Handle("/admin/", adminHandler) // 管理接口
 	mux.Handle("/", gateway)             // 业务接口
 
+	// gRPC 客户端只使用 HTTP/2，网关未启用 TLS 时需要接受 h2c
+	var rootHandler http.Handler = mux
+	if cfg.Server.H2C {
+		rootHandler = h2c.NewHandler(mux, &http2.Server{IdleTimeout: cfg.Server.IdleTimeout.Or(120 * time.Second)})
+	}
+
+	server := &http.Server{
+		Addr:              cfg.Port,
+		Handler:           rootHandler,
+		ReadTimeout:       cfg.Server.ReadTimeout.Std(),
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout.Or(10 * time.Second),
+		WriteTimeout:      cfg.Server.WriteTimeout.Std(),
+		IdleTimeout:       cfg.Server.IdleTimeout.Or(120 * time.Second),
+	}
+
 	log.Printf("Gateway starting on %s", cfg.Port)
-	if err := http.ListenAndServe(cfg.Port, mux); err != nil {
+	if err := server.ListenAndServe(); err != nil {
 		log.Fatal(err)
 	}
 }
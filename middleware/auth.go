@@ -24,6 +24,10 @@ func (m *AuthMiddleware) Handle(ctx *hook.HookContext) error {
 		fmt.Println("BeforeAuth error", err)
 		return err
 	}
+	// BeforeAuth Hook 已经决定了响应（如自定义的拒绝或维护页面），请求不会到达后端，不再校验凭证
+	if ctx.ShortCircuit != nil {
+		return nil
+	}
 
 	token := ctx.Request.Header.Get("Authorization")
 	if token != "Bearer "+m.authToken {
@@ -37,3 +41,10 @@ func (m *AuthMiddleware) Handle(ctx *hook.HookContext) error {
 
 	return nil
 }
+
+// RemoveCredentials 删除网关自身的鉴权凭证，避免泄露给后端；后端自己的凭证原样保留
+func (m *AuthMiddleware) RemoveCredentials(h http.Header) {
+	if h.Get("Authorization") == "Bearer "+m.authToken {
+		h.Del("Authorization")
+	}
+}
@@ -0,0 +1,219 @@
+package proxy
+
+import (
+	"fmt"
+	"hash/crc32"
+	"math/rand"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ruke318/gateway/config"
+)
+
+// 负载均衡策略
+const (
+	StrategyRoundRobin         = "round-robin"
+	StrategyWeightedRoundRobin = "weighted-round-robin"
+	StrategyLeastConnections   = "least-connections"
+	StrategyRandomTwoChoices   = "random-two-choices"
+	StrategyConsistentHash     = "consistent-hash"
+)
+
+// Balancer 从候选节点中选择一个节点
+// candidates 是当前可用的节点（非空），顺序与上游组配置一致
+type Balancer interface {
+	Pick(req *http.Request, candidates []*Target) *Target
+}
+
+// NewBalancer 根据配置创建负载均衡器，targets 为上游组的全部节点
+func NewBalancer(cfg config.LoadBalanceConfig, targets []*Target) (Balancer, error) {
+	switch cfg.Strategy {
+	case "", StrategyRoundRobin:
+		return &roundRobin{}, nil
+	case StrategyWeightedRoundRobin:
+		return &weightedRoundRobin{current: make(map[*Target]int)}, nil
+	case StrategyLeastConnections:
+		return &leastConnections{}, nil
+	case StrategyRandomTwoChoices:
+		return &randomTwoChoices{rand: rand.New(rand.NewSource(rand.Int63()))}, nil
+	case StrategyConsistentHash:
+		return newConsistentHash(cfg, targets)
+	default:
+		return nil, fmt.Errorf("unknown load balance strategy: %s", cfg.Strategy)
+	}
+}
+
+// roundRobin 轮询
+type roundRobin struct {
+	counter uint64
+}
+
+func (b *roundRobin) Pick(req *http.Request, candidates []*Target) *Target {
+	n := atomic.AddUint64(&b.counter, 1)
+	return candidates[(n-1)%uint64(len(candidates))]
+}
+
+// weightedRoundRobin 平滑加权轮询（与 nginx 相同的算法），避免高权重节点被连续选中
+type weightedRoundRobin struct {
+	mu      sync.Mutex
+	current map[*Target]int
+}
+
+func (b *weightedRoundRobin) Pick(req *http.Request, candidates []*Target) *Target {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var best *Target
+	total := 0
+	for _, t := range candidates {
+		b.current[t] += t.Weight
+		total += t.Weight
+		if best == nil || b.current[t] > b.current[best] {
+			best = t
+		}
+	}
+	b.current[best] -= total
+	return best
+}
+
+// leastConnections 选择进行中请求最少的节点，相同时按权重折算
+type leastConnections struct {
+	rr roundRobin
+}
+
+func (b *leastConnections) Pick(req *http.Request, candidates []*Target) *Target {
+	// 从轮询位置开始遍历，让负载相同的节点轮流被选中
+	offset := int(atomic.AddUint64(&b.rr.counter, 1) % uint64(len(candidates)))
+
+	var best *Target
+	for i := range candidates {
+		t := candidates[(offset+i)%len(candidates)]
+		if best == nil || t.ActiveRequests()*int64(best.Weight) < best.ActiveRequests()*int64(t.Weight) {
+			best = t
+		}
+	}
+	return best
+}
+
+// randomTwoChoices 随机选两个节点，取进行中请求较少的一个
+type randomTwoChoices struct {
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+func (b *randomTwoChoices) Pick(req *http.Request, candidates []*Target) *Target {
+	if len(candidates) == 1 {
+		return candidates[0]
+	}
+
+	b.mu.Lock()
+	i := b.rand.Intn(len(candidates))
+	j := b.rand.Intn(len(candidates) - 1)
+	b.mu.Unlock()
+	if j >= i {
+		j++
+	}
+
+	first, second := candidates[i], candidates[j]
+	if second.ActiveRequests()*int64(first.Weight) < first.ActiveRequests()*int64(second.Weight) {
+		return second
+	}
+	return first
+}
+
+// consistentHash 一致性哈希，相同的 key 总是落到同一节点；节点不可用时顺延到环上的下一个可用节点
+type consistentHash struct {
+	hashOn   string
+	hashKey  string
+	ring     []uint32
+	owners   map[uint32]*Target
+	fallback roundRobin
+}
+
+// 每单位权重的虚拟节点数
+const virtualNodesPerWeight = 100
+
+func newConsistentHash(cfg config.LoadBalanceConfig, targets []*Target) (*consistentHash, error) {
+	hashOn := cfg.HashOn
+	if hashOn == "" {
+		hashOn = "ip"
+	}
+	if hashOn != "ip" && hashOn != "header" && hashOn != "cookie" {
+		return nil, fmt.Errorf("unknown consistent hash source: %s", cfg.HashOn)
+	}
+	if hashOn != "ip" && cfg.HashKey == "" {
+		return nil, fmt.Errorf("consistent hash on %s requires hashKey", hashOn)
+	}
+
+	b := &consistentHash{
+		hashOn:  hashOn,
+		hashKey: cfg.HashKey,
+		owners:  make(map[uint32]*Target),
+	}
+	for _, t := range targets {
+		for i := 0; i < t.Weight*virtualNodesPerWeight; i++ {
+			h := hashString(t.URL + "#" + strconv.Itoa(i))
+			if _, exists := b.owners[h]; exists {
+				continue
+			}
+			b.owners[h] = t
+			b.ring = append(b.ring, h)
+		}
+	}
+	sort.Slice(b.ring, func(i, j int) bool { return b.ring[i] < b.ring[j] })
+	return b, nil
+}
+
+func (b *consistentHash) Pick(req *http.Request, candidates []*Target) *Target {
+	key, ok := b.key(req)
+	if !ok || len(b.ring) == 0 {
+		// 取不到哈希值时退化为轮询
+		return b.fallback.Pick(req, candidates)
+	}
+
+	available := make(map[*Target]bool, len(candidates))
+	for _, t := range candidates {
+		available[t] = true
+	}
+
+	h := hashString(key)
+	start := sort.Search(len(b.ring), func(i int) bool { return b.ring[i] >= h })
+	for i := 0; i < len(b.ring); i++ {
+		t := b.owners[b.ring[(start+i)%len(b.ring)]]
+		if available[t] {
+			return t
+		}
+	}
+	return b.fallback.Pick(req, candidates)
+}
+
+func (b *consistentHash) key(req *http.Request) (string, bool) {
+	if req == nil {
+		return "", false
+	}
+	switch b.hashOn {
+	case "header":
+		v := req.Header.Get(b.hashKey)
+		return v, v != ""
+	case "cookie":
+		c, err := req.Cookie(b.hashKey)
+		if err != nil || c.Value == "" {
+			return "", false
+		}
+		return c.Value, true
+	default:
+		ip := req.RemoteAddr
+		if host, _, err := net.SplitHostPort(ip); err == nil {
+			ip = host
+		}
+		return ip, ip != ""
+	}
+}
+
+func hashString(s string) uint32 {
+	return crc32.ChecksumIEEE([]byte(s))
+}
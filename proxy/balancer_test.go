@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/ruke318/gateway/config"
+)
+
+func newTestUpstream(t *testing.T, lb config.LoadBalanceConfig, targets ...config.UpstreamTarget) *Upstream {
+	t.Helper()
+	u, err := NewUpstream("test", targets, lb, nil)
+	if err != nil {
+		t.Fatalf("NewUpstream failed: %v", err)
+	}
+	return u
+}
+
+func pickCounts(t *testing.T, u *Upstream, req *http.Request, n int) map[string]int {
+	t.Helper()
+	counts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		target, err := u.Select(req)
+		if err != nil {
+			t.Fatalf("Select failed: %v", err)
+		}
+		counts[target.URL]++
+	}
+	return counts
+}
+
+func TestRoundRobin(t *testing.T) {
+	u := newTestUpstream(t, config.LoadBalanceConfig{},
+		config.UpstreamTarget{URL: "a"}, config.UpstreamTarget{URL: "b"}, config.UpstreamTarget{URL: "c"})
+
+	counts := pickCounts(t, u, nil, 30)
+	for _, url := range []string{"a", "b", "c"} {
+		if counts[url] != 10 {
+			t.Errorf("Expected 10 picks for %s, got %d", url, counts[url])
+		}
+	}
+}
+
+func TestWeightedRoundRobin(t *testing.T) {
+	u := newTestUpstream(t, config.LoadBalanceConfig{Strategy: StrategyWeightedRoundRobin},
+		config.UpstreamTarget{URL: "a", Weight: 5}, config.UpstreamTarget{URL: "b", Weight: 1}, config.UpstreamTarget{URL: "c", Weight: 1})
+
+	// 平滑加权轮询：每 7 次中 a 5 次，且不会连续选中 b/c
+	var sequence []string
+	for i := 0; i < 7; i++ {
+		target, _ := u.Select(nil)
+		sequence = append(sequence, target.URL)
+	}
+	counts := map[string]int{}
+	for _, url := range sequence {
+		counts[url]++
+	}
+	if counts["a"] != 5 || counts["b"] != 1 || counts["c"] != 1 {
+		t.Errorf("Unexpected weighted distribution: %v", sequence)
+	}
+}
+
+func TestLeastConnections(t *testing.T) {
+	u := newTestUpstream(t, config.LoadBalanceConfig{Strategy: StrategyLeastConnections},
+		config.UpstreamTarget{URL: "a"}, config.UpstreamTarget{URL: "b"})
+
+	busy := u.Targets()[0]
+	busy.acquire()
+	busy.acquire()
+	defer busy.release()
+	defer busy.release()
+
+	counts := pickCounts(t, u, nil, 10)
+	if counts["b"] != 10 {
+		t.Errorf("Expected idle target to be picked every time, got %v", counts)
+	}
+}
+
+func TestRandomTwoChoices(t *testing.T) {
+	u := newTestUpstream(t, config.LoadBalanceConfig{Strategy: StrategyRandomTwoChoices},
+		config.UpstreamTarget{URL: "a"}, config.UpstreamTarget{URL: "b"})
+
+	u.Targets()[1].acquire()
+	defer u.Targets()[1].release()
+
+	// 只有两个节点时每次都会比较这两个节点
+	counts := pickCounts(t, u, nil, 10)
+	if counts["a"] != 10 {
+		t.Errorf("Expected less loaded target to be picked every time, got %v", counts)
+	}
+}
+
+func TestConsistentHash(t *testing.T) {
+	u := newTestUpstream(t, config.LoadBalanceConfig{Strategy: StrategyConsistentHash, HashOn: "header", HashKey: "X-User-Id"},
+		config.UpstreamTarget{URL: "a"}, config.UpstreamTarget{URL: "b"}, config.UpstreamTarget{URL: "c"})
+
+	seen := map[string]bool{}
+	for _, user := range []string{"u1", "u2", "u3", "u4", "u5", "u6", "u7", "u8"} {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set("X-User-Id", user)
+		counts := pickCounts(t, u, req, 5)
+		if len(counts) != 1 {
+			t.Errorf("Expected user %s to stick to one target, got %v", user, counts)
+		}
+		for url := range counts {
+			seen[url] = true
+		}
+	}
+	if len(seen) < 2 {
+		t.Errorf("Expected keys to spread across targets, got %v", seen)
+	}
+
+	if _, err := NewUpstream("bad", []config.UpstreamTarget{{URL: "a"}}, config.LoadBalanceConfig{Strategy: StrategyConsistentHash, HashOn: "cookie"}, nil); err == nil {
+		t.Error("Expected error when hashKey is missing")
+	}
+}
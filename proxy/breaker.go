@@ -0,0 +1,365 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ruke318/gateway/config"
+)
+
+// ErrCircuitOpen 熔断器处于打开状态，请求未发送到后端
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// 熔断器状态
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// 熔断器默认值
+const (
+	defaultBreakerErrorRate        = 0.5
+	defaultBreakerSlowCallRate     = 0.5
+	defaultBreakerMinRequests      = 20
+	defaultBreakerWindow           = 10 * time.Second
+	defaultBreakerOpenDuration     = 30 * time.Second
+	defaultBreakerHalfOpenRequests = 3
+	breakerBuckets                 = 10
+)
+
+// breakerBucket 是统计窗口中的一个时间片
+type breakerBucket struct {
+	epoch    int64
+	total    int
+	failures int
+	slow     int
+}
+
+// circuitBreaker 是一条路由的熔断器
+// 统计窗口按时间片滚动，过期的时间片在下次写入时清零
+type circuitBreaker struct {
+	mu        sync.Mutex
+	route     string
+	cfg       config.CircuitBreakerConfig
+	signature string
+	// source 最近一次使用的路由配置；路由快照不可变，指针相同时无需重新计算签名
+	source *config.CircuitBreakerConfig
+
+	state    string
+	forced   bool // 手动熔断，不会自动进入半开状态
+	openedAt time.Time
+	buckets  [breakerBuckets]breakerBucket
+
+	probes         int // 半开状态下进行中的探测请求
+	probeSuccesses int
+}
+
+func newCircuitBreaker(route string, cfg *config.CircuitBreakerConfig) *circuitBreaker {
+	cb := &circuitBreaker{route: route, state: BreakerClosed}
+	if cfg != nil {
+		cb.cfg = *cfg
+		cb.signature = breakerSignature(cfg)
+		cb.source = cfg
+	}
+	return cb
+}
+
+func breakerSignature(cfg *config.CircuitBreakerConfig) string {
+	data, _ := json.Marshal(cfg)
+	return string(data)
+}
+
+func (cb *circuitBreaker) window() time.Duration {
+	return cb.cfg.Window.Or(defaultBreakerWindow)
+}
+
+func (cb *circuitBreaker) halfOpenRequests() int {
+	if cb.cfg.HalfOpenRequests > 0 {
+		return cb.cfg.HalfOpenRequests
+	}
+	return defaultBreakerHalfOpenRequests
+}
+
+// allow 判断是否放行请求；半开状态下放行的请求计为探测请求
+func (cb *circuitBreaker) allow() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case BreakerOpen:
+		if cb.forced || time.Since(cb.openedAt) < cb.cfg.OpenDuration.Or(defaultBreakerOpenDuration) {
+			return false
+		}
+		cb.setState(BreakerHalfOpen)
+		cb.probes, cb.probeSuccesses = 0, 0
+		fallthrough
+	case BreakerHalfOpen:
+		if cb.probes >= cb.halfOpenRequests() {
+			return false
+		}
+		cb.probes++
+		return true
+	default:
+		return true
+	}
+}
+
+// record 记录一次放行请求的结果
+func (cb *circuitBreaker) record(err error, status int, elapsed time.Duration) {
+	failed := err != nil || status >= http.StatusInternalServerError
+	slow := cb.cfg.SlowCallDuration > 0 && elapsed >= cb.cfg.SlowCallDuration.Std()
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case BreakerHalfOpen:
+		if failed || slow {
+			cb.open()
+			return
+		}
+		cb.probeSuccesses++
+		if cb.probeSuccesses >= cb.halfOpenRequests() {
+			cb.close()
+		}
+	case BreakerClosed:
+		b := cb.bucket(time.Now())
+		b.total++
+		if failed {
+			b.failures++
+		}
+		if slow {
+			b.slow++
+		}
+		if cb.tripped() {
+			cb.open()
+		}
+	}
+}
+
+// abandon 放行的请求因客户端断开而取消，结果不计入统计；半开状态下归还探测名额
+func (cb *circuitBreaker) abandon() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.state == BreakerHalfOpen && cb.probes > 0 {
+		cb.probes--
+	}
+}
+
+// tripped 判断统计窗口内的失败率或慢调用比例是否超过阈值
+func (cb *circuitBreaker) tripped() bool {
+	total, failures, slow := cb.counts(time.Now())
+	minRequests := cb.cfg.MinRequests
+	if minRequests <= 0 {
+		minRequests = defaultBreakerMinRequests
+	}
+	if total < minRequests {
+		return false
+	}
+
+	errorRate := cb.cfg.ErrorRate
+	if errorRate <= 0 {
+		errorRate = defaultBreakerErrorRate
+	}
+	if float64(failures) >= errorRate*float64(total) {
+		return true
+	}
+	if cb.cfg.SlowCallDuration > 0 {
+		slowRate := cb.cfg.SlowCallRate
+		if slowRate <= 0 {
+			slowRate = defaultBreakerSlowCallRate
+		}
+		return float64(slow) >= slowRate*float64(total)
+	}
+	return false
+}
+
+func (cb *circuitBreaker) bucketWidth() int64 {
+	width := int64(cb.window()) / breakerBuckets
+	if width <= 0 {
+		width = 1
+	}
+	return width
+}
+
+func (cb *circuitBreaker) bucket(now time.Time) *breakerBucket {
+	epoch := now.UnixNano() / cb.bucketWidth()
+	b := &cb.buckets[epoch%breakerBuckets]
+	if b.epoch != epoch {
+		*b = breakerBucket{epoch: epoch}
+	}
+	return b
+}
+
+// counts 汇总统计窗口内的请求数、失败数和慢调用数
+func (cb *circuitBreaker) counts(now time.Time) (total, failures, slow int) {
+	current := now.UnixNano() / cb.bucketWidth()
+	for _, b := range cb.buckets {
+		if current-b.epoch < breakerBuckets {
+			total += b.total
+			failures += b.failures
+			slow += b.slow
+		}
+	}
+	return total, failures, slow
+}
+
+func (cb *circuitBreaker) open() {
+	cb.setState(BreakerOpen)
+	cb.openedAt = time.Now()
+}
+
+func (cb *circuitBreaker) close() {
+	cb.setState(BreakerClosed)
+	cb.forced = false
+	cb.buckets = [breakerBuckets]breakerBucket{}
+}
+
+func (cb *circuitBreaker) setState(state string) {
+	if cb.state != state {
+		log.Printf("[circuit %s] %s -> %s", cb.route, cb.state, state)
+		cb.state = state
+	}
+}
+
+// BreakerStatus 是熔断器的状态快照
+type BreakerStatus struct {
+	Route     string     `json:"route"`
+	State     string     `json:"state"`
+	Forced    bool       `json:"forced"` // 是否为手动熔断
+	Requests  int        `json:"requests"`
+	Failures  int        `json:"failures"`
+	SlowCalls int        `json:"slowCalls"`
+	OpenedAt  *time.Time `json:"openedAt,omitempty"`
+	RetryAt   *time.Time `json:"retryAt,omitempty"` // 预计进入半开状态的时间
+}
+
+func (cb *circuitBreaker) status() BreakerStatus {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	status := BreakerStatus{Route: cb.route, State: cb.state, Forced: cb.forced}
+	status.Requests, status.Failures, status.SlowCalls = cb.counts(time.Now())
+	if cb.state != BreakerClosed {
+		openedAt := cb.openedAt
+		status.OpenedAt = &openedAt
+		if cb.state == BreakerOpen && !cb.forced {
+			retryAt := openedAt.Add(cb.cfg.OpenDuration.Or(defaultBreakerOpenDuration))
+			status.RetryAt = &retryAt
+		}
+	}
+	return status
+}
+
+// breakerRegistry 按路由 Key 管理熔断器
+// 路由的熔断配置变化时重建熔断器，手动熔断状态会保留
+type breakerRegistry struct {
+	mu       sync.RWMutex
+	breakers map[string]*circuitBreaker
+}
+
+// get 返回路由的熔断器；路由未配置熔断且未被手动熔断时返回 nil
+// 每个请求都会调用，配置指针与上次相同时只持有读锁
+func (r *breakerRegistry) get(route string, cfg *config.CircuitBreakerConfig) *circuitBreaker {
+	r.mu.RLock()
+	cb, ok := r.breakers[route]
+	cached := ok && cfg != nil && cb.source == cfg
+	r.mu.RUnlock()
+	if cfg == nil {
+		if ok && cb.signature == "" {
+			return cb
+		}
+		return nil
+	}
+	if cached {
+		return cb
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cb, ok = r.breakers[route]
+	if ok && cb.signature == breakerSignature(cfg) {
+		cb.source = cfg
+		return cb
+	}
+
+	created := newCircuitBreaker(route, cfg)
+	if ok {
+		cb.mu.Lock()
+		if cb.forced {
+			created.state, created.forced, created.openedAt = BreakerOpen, true, cb.openedAt
+		}
+		cb.mu.Unlock()
+	}
+	if r.breakers == nil {
+		r.breakers = make(map[string]*circuitBreaker)
+	}
+	r.breakers[route] = created
+	return created
+}
+
+// TripBreaker 手动熔断路由，直到调用 ResetBreaker
+// 路由未配置熔断器时同样生效，熔断期间请求按未配置降级处理
+func (f *Forwarder) TripBreaker(route string) {
+	r := &f.breakers
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cb, ok := r.breakers[route]
+	if !ok {
+		cb = newCircuitBreaker(route, nil)
+		if r.breakers == nil {
+			r.breakers = make(map[string]*circuitBreaker)
+		}
+		r.breakers[route] = cb
+	}
+	cb.mu.Lock()
+	cb.open()
+	cb.forced = true
+	cb.mu.Unlock()
+}
+
+// ResetBreaker 将路由的熔断器恢复为关闭状态并清空统计
+func (f *Forwarder) ResetBreaker(route string) error {
+	r := &f.breakers
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cb, ok := r.breakers[route]
+	if !ok {
+		return fmt.Errorf("circuit breaker not found: %s", route)
+	}
+	if cb.signature == "" {
+		// 只为手动熔断创建的熔断器，恢复后不再需要
+		delete(r.breakers, route)
+	}
+	cb.mu.Lock()
+	cb.close()
+	cb.mu.Unlock()
+	return nil
+}
+
+// BreakerStatuses 返回所有熔断器的状态，按路由 Key 排序
+func (f *Forwarder) BreakerStatuses() []BreakerStatus {
+	r := &f.breakers
+	r.mu.RLock()
+	breakers := make([]*circuitBreaker, 0, len(r.breakers))
+	for _, cb := range r.breakers {
+		breakers = append(breakers, cb)
+	}
+	r.mu.RUnlock()
+
+	statuses := make([]BreakerStatus, 0, len(breakers))
+	for _, cb := range breakers {
+		statuses = append(statuses, cb.status())
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Route < statuses[j].Route })
+	return statuses
+}
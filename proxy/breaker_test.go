@@ -0,0 +1,261 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ruke318/gateway/config"
+)
+
+func TestCircuitBreakerStates(t *testing.T) {
+	var failing int32 = 1
+	var hits int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	f := NewForwarder("")
+	opts := &ForwardOptions{
+		Method:     http.MethodGet,
+		BackendURL: backend.URL,
+		Path:       "/",
+		RouteKey:   "GET /api",
+		CircuitBreaker: &config.CircuitBreakerConfig{
+			ErrorRate:        0.5,
+			MinRequests:      4,
+			OpenDuration:     config.Duration(50 * time.Millisecond),
+			HalfOpenRequests: 2,
+		},
+	}
+
+	for i := 0; i < 4; i++ {
+		f.Do(opts)
+	}
+	if _, _, err := f.Do(opts); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Expected circuit to open after failures, got %v", err)
+	}
+	if hits != 4 {
+		t.Errorf("Open circuit should not reach backend, got %d hits", hits)
+	}
+
+	// 熔断到期后进入半开，探测失败重新熔断
+	time.Sleep(60 * time.Millisecond)
+	f.Do(opts)
+	if status := f.BreakerStatuses()[0]; status.State != BreakerOpen {
+		t.Fatalf("Failed probe should reopen the circuit, got %s", status.State)
+	}
+
+	// 探测全部成功后恢复
+	atomic.StoreInt32(&failing, 0)
+	time.Sleep(60 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		if _, _, err := f.Do(opts); err != nil {
+			t.Fatalf("Probe %d failed: %v", i, err)
+		}
+	}
+	if status := f.BreakerStatuses()[0]; status.State != BreakerClosed {
+		t.Errorf("Expected circuit to close after successful probes, got %s", status.State)
+	}
+}
+
+func TestCircuitBreakerSlowCalls(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+	}))
+	defer backend.Close()
+
+	f := NewForwarder("")
+	opts := &ForwardOptions{
+		Method:     http.MethodGet,
+		BackendURL: backend.URL,
+		Path:       "/",
+		RouteKey:   "GET /slow",
+		CircuitBreaker: &config.CircuitBreakerConfig{
+			MinRequests:      2,
+			SlowCallDuration: config.Duration(10 * time.Millisecond),
+		},
+	}
+	f.Do(opts)
+	f.Do(opts)
+	if _, _, err := f.Do(opts); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected slow calls to open the circuit, got %v", err)
+	}
+}
+
+func TestManualTripAndReset(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+
+	f := NewForwarder("")
+	opts := &ForwardOptions{Method: http.MethodGet, BackendURL: backend.URL, Path: "/", RouteKey: "GET /manual"}
+
+	f.TripBreaker("GET /manual")
+	if _, _, err := f.Do(opts); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Expected manually tripped route to be rejected, got %v", err)
+	}
+	status := f.BreakerStatuses()[0]
+	if !status.Forced || status.RetryAt != nil {
+		t.Errorf("Manual trip should be forced without retry time, got %+v", status)
+	}
+
+	if err := f.ResetBreaker("GET /manual"); err != nil {
+		t.Fatalf("ResetBreaker failed: %v", err)
+	}
+	if _, _, err := f.Do(opts); err != nil {
+		t.Errorf("Expected request to pass after reset, got %v", err)
+	}
+	if len(f.BreakerStatuses()) != 0 {
+		t.Error("Breaker created only by manual trip should be removed on reset")
+	}
+	if err := f.ResetBreaker("GET /missing"); err == nil {
+		t.Error("Expected error when resetting unknown breaker")
+	}
+}
+
+func TestBreakerReuse(t *testing.T) {
+	var r breakerRegistry
+	cfg := &config.CircuitBreakerConfig{ErrorRate: 0.5}
+	cb := r.get("GET /api", cfg)
+	if cb == nil || r.get("GET /api", cfg) != cb {
+		t.Fatal("Same config should reuse the breaker")
+	}
+
+	// 路由更新后配置指针变化，内容不变时保留原有统计
+	same := *cfg
+	if r.get("GET /api", &same) != cb {
+		t.Error("Equal config should reuse the breaker")
+	}
+	if cb.source != &same {
+		t.Error("Breaker should remember the latest config pointer")
+	}
+
+	changed := &config.CircuitBreakerConfig{ErrorRate: 0.8}
+	if r.get("GET /api", changed) == cb {
+		t.Error("Changed config should rebuild the breaker")
+	}
+	if r.get("GET /api", nil) != nil {
+		t.Error("Route without breaker config should get nil")
+	}
+}
+
+func BenchmarkBreakerGet(b *testing.B) {
+	var r breakerRegistry
+	cfg := &config.CircuitBreakerConfig{ErrorRate: 0.5, MinRequests: 10}
+	r.get("GET /api", cfg)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			r.get("GET /api", cfg)
+		}
+	})
+}
+
+func TestClientCancelNotCounted(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer backend.Close()
+
+	upstream, err := NewUpstream("test", []config.UpstreamTarget{{URL: backend.URL}}, config.LoadBalanceConfig{}, &config.HealthCheckConfig{
+		Passive: &config.PassiveHealthCheck{MaxFailures: 2, EjectDuration: config.Duration(time.Minute)},
+	})
+	if err != nil {
+		t.Fatalf("NewUpstream failed: %v", err)
+	}
+	defer upstream.Close()
+
+	f := NewForwarder("")
+	send := func(opts ForwardOptions, path string, timeout time.Duration) error {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		opts.Method = http.MethodGet
+		opts.Path = path
+		opts.Headers = http.Header{}
+		opts.Request = httptest.NewRequest(http.MethodGet, path, nil).WithContext(ctx)
+		_, _, err := f.Do(&opts)
+		return err
+	}
+	cancelled := func(opts ForwardOptions) {
+		t.Helper()
+		if err := send(opts, "/slow", 10*time.Millisecond); err == nil {
+			t.Fatal("Expected cancelled request to fail")
+		}
+	}
+
+	// 客户端断开不计入熔断
+	closed := ForwardOptions{
+		BackendURL:     backend.URL,
+		RouteKey:       "GET /slow",
+		CircuitBreaker: &config.CircuitBreakerConfig{ErrorRate: 0.5, MinRequests: 2},
+	}
+	for i := 0; i < 4; i++ {
+		cancelled(closed)
+	}
+	if status := f.BreakerStatuses()[0]; status.State != BreakerClosed {
+		t.Errorf("Client cancellations should not open the circuit, got %s", status.State)
+	}
+
+	// 半开状态下断开的探测请求既不恢复也不重新熔断，并归还探测名额
+	halfOpen := ForwardOptions{
+		BackendURL: backend.URL,
+		RouteKey:   "GET /probe",
+		CircuitBreaker: &config.CircuitBreakerConfig{
+			ErrorRate:        0.5,
+			MinRequests:      2,
+			OpenDuration:     config.Duration(20 * time.Millisecond),
+			HalfOpenRequests: 1,
+		},
+	}
+	for i := 0; i < 2; i++ {
+		send(halfOpen, "/fail", time.Second)
+	}
+	time.Sleep(30 * time.Millisecond)
+	cancelled(halfOpen)
+	if status := breakerStatus(f, "GET /probe"); status.State != BreakerHalfOpen {
+		t.Fatalf("Cancelled probe should keep the circuit half-open, got %s", status.State)
+	}
+	if err := send(halfOpen, "/fail", time.Second); errors.Is(err, ErrCircuitOpen) {
+		t.Fatal("Cancelled probe should release its slot")
+	}
+	if status := breakerStatus(f, "GET /probe"); status.State != BreakerOpen {
+		t.Errorf("Failed probe should reopen the circuit, got %s", status.State)
+	}
+
+	// 也不计入被动健康检查，不打断连续失败计数
+	pooled := ForwardOptions{Upstream: upstream}
+	send(pooled, "/fail", time.Second)
+	cancelled(pooled)
+	if !upstream.Targets()[0].Available() {
+		t.Fatal("Client cancellations should not eject the target")
+	}
+	send(pooled, "/fail", time.Second)
+	if upstream.Targets()[0].Available() {
+		t.Error("Client cancellations should not reset the passive failure streak")
+	}
+}
+
+func breakerStatus(f *Forwarder, route string) BreakerStatus {
+	for _, status := range f.BreakerStatuses() {
+		if status.Route == route {
+			return status
+		}
+	}
+	return BreakerStatus{}
+}
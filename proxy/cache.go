@@ -0,0 +1,559 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 缓存结果，通过响应头 X-Cache 返回给客户端
+const (
+	CacheHit         = "HIT"         // 命中新鲜的缓存
+	CacheMiss        = "MISS"        // 未命中，返回后端响应
+	CacheStale       = "STALE"       // 返回过期的缓存（stale-while-revalidate 或 stale-if-error）
+	CacheRevalidated = "REVALIDATED" // 过期的缓存经后端 304 确认后返回
+	CacheBypass      = "BYPASS"      // 客户端要求不使用缓存（Cache-Control: no-store）
+)
+
+const (
+	defaultCacheTTL       = 60 * time.Second
+	defaultCacheSize      = 64 << 20
+	defaultCacheEntrySize = 1 << 20
+)
+
+// 默认可缓存的状态码，见 RFC 9110 15.1
+var defaultCacheStatuses = []int{200, 203, 204, 300, 301, 404, 405, 410, 414, 501}
+
+// responseCache 是 Forwarder 前面的响应缓存
+type responseCache struct {
+	mu           sync.Mutex
+	store        CacheStore
+	maxEntrySize int64
+	// refreshing 正在后台刷新的 key，避免同一条目重复刷新
+	refreshing map[string]bool
+
+	hits, misses, stale, revalidated, bypass uint64
+}
+
+func newResponseCache() *responseCache {
+	return &responseCache{
+		store:        NewMemoryCacheStore(defaultCacheSize),
+		maxEntrySize: defaultCacheEntrySize,
+		refreshing:   make(map[string]bool),
+	}
+}
+
+// SetCacheStore 设置响应缓存的存储和单个响应体的上限，maxEntrySize 为 0 时使用默认值 1MB
+// 替换存储后原有的缓存条目全部失效
+func (f *Forwarder) SetCacheStore(store CacheStore, maxEntrySize int64) {
+	if maxEntrySize <= 0 {
+		maxEntrySize = defaultCacheEntrySize
+	}
+	c := f.cache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.store = store
+	c.maxEntrySize = maxEntrySize
+}
+
+func (c *responseCache) getStore() (CacheStore, int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.store, c.maxEntrySize
+}
+
+// CacheKey 由方法、Host、路径、排序后的查询参数、指定请求头的值和附加值组成缓存 key
+func CacheKey(r *http.Request, headers []string, extra ...string) string {
+	var sb strings.Builder
+	sb.WriteString(r.Method + " " + r.Host + r.URL.Path)
+	if query := r.URL.Query(); len(query) > 0 {
+		sb.WriteString("?" + query.Encode())
+	}
+	for _, name := range headers {
+		name = http.CanonicalHeaderKey(name)
+		sb.WriteString(" " + name + "=" + strings.Join(r.Header.Values(name), ","))
+	}
+	for _, v := range extra {
+		sb.WriteString(" " + v)
+	}
+	return sb.String()
+}
+
+// doCached 在 Do 之前查询缓存：新鲜的条目直接返回；过期的条目在 stale-while-revalidate 时间内直接返回并在后台刷新，
+// 否则向后端发送条件请求重新验证；后端出错时在 stale-if-error 时间内返回过期的条目
+// 客户端的 If-None-Match、If-Modified-Since 由网关根据最终的响应判断，不转发给后端
+func (f *Forwarder) doCached(opts *ForwardOptions) (*http.Response, []byte, error) {
+	method := strings.ToUpper(opts.Method)
+	if method != http.MethodGet && method != http.MethodHead {
+		return f.do(opts, false)
+	}
+	c := f.cache
+	requestCC := parseCacheControl(opts.Headers)
+	if requestCC.has("no-store") {
+		atomic.AddUint64(&c.bypass, 1)
+		resp, body, err := f.do(opts, false)
+		if err == nil {
+			resp.Header.Set("X-Cache", CacheBypass)
+		}
+		return resp, body, err
+	}
+
+	now := time.Now()
+	entry := c.lookup(opts.CacheKey, opts.Headers, now)
+	if entry != nil && !requestCC.has("no-cache") {
+		if now.Before(entry.Expires) {
+			atomic.AddUint64(&c.hits, 1)
+			resp, body := entry.response(CacheHit, now)
+			return clientConditional(opts.Headers, resp, body)
+		}
+		if !entry.MustRevalidate && now.Before(entry.Expires.Add(entry.StaleWhileRevalidate)) {
+			atomic.AddUint64(&c.stale, 1)
+			f.revalidateAsync(opts, entry)
+			resp, body := entry.response(CacheStale, now)
+			return clientConditional(opts.Headers, resp, body)
+		}
+	}
+
+	// 缓存未命中时合并并发的请求，同一时刻只有一个请求回源
+	resp, body, status, err := f.coalesce(opts, func(opts *ForwardOptions) (*http.Response, []byte, string, error) {
+		return f.refresh(opts, entry)
+	})
+	if entry != nil && !entry.MustRevalidate && (err != nil || resp.StatusCode >= http.StatusInternalServerError) {
+		if now.Before(entry.Expires.Add(entry.StaleIfError)) {
+			atomic.AddUint64(&c.stale, 1)
+			log.Printf("[cache] %s: backend failed, serving stale response", opts.CacheKey)
+			resp, body := entry.response(CacheStale, time.Now())
+			return clientConditional(opts.Headers, resp, body)
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if status == CacheRevalidated {
+		atomic.AddUint64(&c.revalidated, 1)
+	} else {
+		atomic.AddUint64(&c.misses, 1)
+	}
+	return clientConditional(opts.Headers, resp, body)
+}
+
+// refresh 向后端请求并更新缓存；entry 带有 ETag 或 Last-Modified 时发送条件请求，后端返回 304 时沿用缓存的响应体
+func (f *Forwarder) refresh(opts *ForwardOptions, entry *CacheEntry) (*http.Response, []byte, string, error) {
+	fetch := *opts
+	fetch.Headers = opts.Headers.Clone()
+	if fetch.Headers == nil {
+		fetch.Headers = make(http.Header)
+	}
+	fetch.Headers.Del("If-None-Match")
+	fetch.Headers.Del("If-Modified-Since")
+	conditional := false
+	if entry != nil {
+		if etag := entry.Header.Get("Etag"); etag != "" {
+			fetch.Headers.Set("If-None-Match", etag)
+			conditional = true
+		}
+		if lastModified := entry.Header.Get("Last-Modified"); lastModified != "" {
+			fetch.Headers.Set("If-Modified-Since", lastModified)
+			conditional = true
+		}
+	}
+
+	resp, body, err := f.do(&fetch, false)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	c := f.cache
+	now := time.Now()
+	if conditional && resp.StatusCode == http.StatusNotModified {
+		updated := entry.revalidate(resp.Header, opts, now)
+		store, _ := c.getStore()
+		store.Set(updated)
+		resp, body = updated.response(CacheRevalidated, now)
+		return resp, body, CacheRevalidated, nil
+	}
+
+	c.save(opts, resp, body, now)
+	resp.Header.Set("X-Cache", CacheMiss)
+	return resp, body, CacheMiss, nil
+}
+
+// revalidateAsync 在后台刷新过期的条目，不受客户端请求结束的影响
+func (f *Forwarder) revalidateAsync(opts *ForwardOptions, entry *CacheEntry) {
+	c := f.cache
+	c.mu.Lock()
+	if c.refreshing[entry.Key] {
+		c.mu.Unlock()
+		return
+	}
+	c.refreshing[entry.Key] = true
+	c.mu.Unlock()
+
+	background := *opts
+	background.OnRetry = nil
+	if opts.Request != nil {
+		background.Request = opts.Request.WithContext(context.Background())
+	}
+	go func() {
+		defer func() {
+			c.mu.Lock()
+			delete(c.refreshing, entry.Key)
+			c.mu.Unlock()
+		}()
+		if _, _, _, err := f.refresh(&background, entry); err != nil {
+			log.Printf("[cache] %s: background revalidation failed: %v", entry.Key, err)
+		}
+	}()
+}
+
+// lookup 按 key 查找条目，响应带 Vary 时再按请求头的值查找对应的变体
+// 超过所有过期窗口且无法重新验证的条目会被删除
+func (c *responseCache) lookup(key string, headers http.Header, now time.Time) *CacheEntry {
+	store, _ := c.getStore()
+	entry, ok := store.Get(key)
+	if ok && len(entry.Vary) > 0 {
+		entry, ok = store.Get(variantKey(key, entry.Vary, headers))
+	}
+	if !ok {
+		return nil
+	}
+	if !entry.usable(now) {
+		store.Delete(entry.Key)
+		return nil
+	}
+	return entry
+}
+
+// save 按后端的 Cache-Control 和路由配置决定是否缓存响应
+func (c *responseCache) save(opts *ForwardOptions, resp *http.Response, body []byte, now time.Time) {
+	store, maxEntrySize := c.getStore()
+	if int64(len(body)) > maxEntrySize || !cacheableStatus(opts, resp.StatusCode) {
+		return
+	}
+	cc := parseCacheControl(resp.Header)
+	if cc.has("no-store") || cc.has("private") || len(resp.Header.Values("Set-Cookie")) > 0 {
+		return
+	}
+	// 带凭证的请求只有后端明确允许时才能放入共享缓存，见 RFC 9111 3.5
+	if opts.Headers.Get("Authorization") != "" && !cc.has("public") && !cc.has("s-maxage") && !cc.has("must-revalidate") {
+		return
+	}
+	vary := varyHeaders(resp.Header)
+	for _, name := range vary {
+		if name == "*" {
+			return
+		}
+	}
+
+	entry := &CacheEntry{
+		Key:    opts.CacheKey,
+		Route:  opts.route(),
+		Status: resp.StatusCode,
+		Header: resp.Header.Clone(),
+		Body:   body,
+	}
+	entry.setLifetime(opts, now)
+	if !entry.usable(now) {
+		return
+	}
+	if len(vary) > 0 {
+		entry.Key = variantKey(opts.CacheKey, vary, opts.Headers)
+		store.Set(&CacheEntry{Key: opts.CacheKey, Route: opts.route(), StoredAt: now, Expires: entry.Expires, Vary: vary})
+	}
+	store.Set(entry)
+}
+
+// setLifetime 按 s-maxage、max-age、Expires、路由 TTL 的顺序计算新鲜时间，并扣除上游缓存的 Age
+func (e *CacheEntry) setLifetime(opts *ForwardOptions, now time.Time) {
+	cc := parseCacheControl(e.Header)
+	ttl := opts.Cache.TTL.Or(defaultCacheTTL)
+	if v, ok := cc.seconds("s-maxage"); ok {
+		ttl = v
+	} else if v, ok := cc.seconds("max-age"); ok {
+		ttl = v
+	} else if expires := e.Header.Get("Expires"); expires != "" {
+		ttl = 0
+		if t, err := http.ParseTime(expires); err == nil {
+			date, err := http.ParseTime(e.Header.Get("Date"))
+			if err != nil {
+				date = now
+			}
+			ttl = t.Sub(date)
+		}
+	}
+	if age, err := strconv.Atoi(e.Header.Get("Age")); err == nil && age > 0 {
+		ttl -= time.Duration(age) * time.Second
+	}
+	if cc.has("no-cache") {
+		ttl = 0
+	}
+
+	e.StoredAt = now
+	e.Expires = now.Add(ttl)
+	e.StaleWhileRevalidate = opts.Cache.StaleWhileRevalidate.Std()
+	if v, ok := cc.seconds("stale-while-revalidate"); ok {
+		e.StaleWhileRevalidate = v
+	}
+	e.StaleIfError = opts.Cache.StaleIfError.Std()
+	if v, ok := cc.seconds("stale-if-error"); ok {
+		e.StaleIfError = v
+	}
+	e.MustRevalidate = cc.has("no-cache") || cc.has("must-revalidate") || cc.has("proxy-revalidate")
+}
+
+// revalidate 用 304 响应的 Header 更新条目，返回新的条目
+func (e *CacheEntry) revalidate(header http.Header, opts *ForwardOptions, now time.Time) *CacheEntry {
+	updated := &CacheEntry{
+		Key:    e.Key,
+		Route:  e.Route,
+		Status: e.Status,
+		Header: e.Header.Clone(),
+		Body:   e.Body,
+	}
+	for k, v := range header {
+		if k == "Content-Length" {
+			continue
+		}
+		updated.Header[k] = append([]string(nil), v...)
+	}
+	updated.setLifetime(opts, now)
+	return updated
+}
+
+// usable 条目是否还能使用：新鲜、在过期窗口内，或可以通过 ETag、Last-Modified 重新验证
+func (e *CacheEntry) usable(now time.Time) bool {
+	if len(e.Vary) > 0 || e.Header.Get("Etag") != "" || e.Header.Get("Last-Modified") != "" {
+		return true
+	}
+	window := e.StaleWhileRevalidate
+	if e.StaleIfError > window {
+		window = e.StaleIfError
+	}
+	if e.MustRevalidate {
+		window = 0
+	}
+	return now.Before(e.Expires.Add(window))
+}
+
+// response 由条目生成响应，Age 为存入（或最近一次重新验证）后经过的秒数
+func (e *CacheEntry) response(status string, now time.Time) (*http.Response, []byte) {
+	header := e.Header.Clone()
+	header.Set("Age", strconv.Itoa(int(now.Sub(e.StoredAt)/time.Second)))
+	header.Set("X-Cache", status)
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.Status, http.StatusText(e.Status)),
+		StatusCode:    e.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          http.NoBody,
+		ContentLength: int64(len(e.Body)),
+	}, e.Body
+}
+
+// clientConditional 客户端的条件请求与响应匹配时返回 304
+func clientConditional(headers http.Header, resp *http.Response, body []byte) (*http.Response, []byte, error) {
+	if resp.StatusCode != http.StatusOK || !notModified(headers, resp.Header) {
+		return resp, body, nil
+	}
+	header := resp.Header.Clone()
+	header.Del("Content-Length")
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", http.StatusNotModified, http.StatusText(http.StatusNotModified)),
+		StatusCode: http.StatusNotModified,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     header,
+		Body:       http.NoBody,
+	}, nil, nil
+}
+
+// notModified 按 RFC 9110 13.1 判断条件请求：有 If-None-Match 时忽略 If-Modified-Since
+func notModified(request, response http.Header) bool {
+	if inm := request.Get("If-None-Match"); inm != "" {
+		etag := strings.TrimPrefix(response.Get("Etag"), "W/")
+		if etag == "" {
+			return false
+		}
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+				return true
+			}
+		}
+		return false
+	}
+	since, err := http.ParseTime(request.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	lastModified, err := http.ParseTime(response.Get("Last-Modified"))
+	return err == nil && !lastModified.After(since)
+}
+
+func cacheableStatus(opts *ForwardOptions, status int) bool {
+	statuses := opts.Cache.Statuses
+	if len(statuses) == 0 {
+		statuses = defaultCacheStatuses
+	}
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// varyHeaders 返回排序后的 Vary 请求头名称
+func varyHeaders(h http.Header) []string {
+	var names []string
+	for _, v := range h.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func variantKey(key string, vary []string, headers http.Header) string {
+	parts := make([]string, len(vary))
+	for i, name := range vary {
+		parts[i] = name + "=" + strings.Join(headers.Values(name), ",")
+	}
+	return key + " vary[" + strings.Join(parts, " ") + "]"
+}
+
+// cacheControl 是解析后的 Cache-Control 指令，指令名为小写
+type cacheControl map[string]string
+
+func parseCacheControl(h http.Header) cacheControl {
+	cc := cacheControl{}
+	for _, v := range h.Values("Cache-Control") {
+		for _, directive := range strings.Split(v, ",") {
+			name, value := strings.TrimSpace(directive), ""
+			if i := strings.IndexByte(name, '='); i >= 0 {
+				name, value = strings.TrimSpace(name[:i]), strings.Trim(strings.TrimSpace(name[i+1:]), `"`)
+			}
+			if name != "" {
+				cc[strings.ToLower(name)] = value
+			}
+		}
+	}
+	return cc
+}
+
+func (cc cacheControl) has(directive string) bool {
+	_, ok := cc[directive]
+	return ok
+}
+
+func (cc cacheControl) seconds(directive string) (time.Duration, bool) {
+	v, ok := cc[directive]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return time.Duration(n) * time.Second, true
+}
+
+// CacheStats 响应缓存的统计
+type CacheStats struct {
+	Entries     int    `json:"entries"`
+	Bytes       int64  `json:"bytes,omitempty"`
+	MaxBytes    int64  `json:"maxBytes,omitempty"`
+	Hits        uint64 `json:"hits"`
+	Misses      uint64 `json:"misses"`
+	Stale       uint64 `json:"stale"`
+	Revalidated uint64 `json:"revalidated"`
+	Bypass      uint64 `json:"bypass"`
+}
+
+// CacheEntryStatus 缓存条目的概要，供管理接口展示
+type CacheEntryStatus struct {
+	Key      string    `json:"key"`
+	Route    string    `json:"route"`
+	Status   int       `json:"status"`
+	Size     int64     `json:"size"`
+	StoredAt time.Time `json:"storedAt"`
+	Expires  time.Time `json:"expires"`
+	Fresh    bool      `json:"fresh"`
+}
+
+// CacheStats 返回缓存统计，使用内存存储时包含占用的字节数
+func (f *Forwarder) CacheStats() CacheStats {
+	c := f.cache
+	store, _ := c.getStore()
+	stats := CacheStats{
+		Hits:        atomic.LoadUint64(&c.hits),
+		Misses:      atomic.LoadUint64(&c.misses),
+		Stale:       atomic.LoadUint64(&c.stale),
+		Revalidated: atomic.LoadUint64(&c.revalidated),
+		Bypass:      atomic.LoadUint64(&c.bypass),
+	}
+	if memory, ok := store.(*MemoryCacheStore); ok {
+		stats.Entries, stats.Bytes, stats.MaxBytes = memory.Usage()
+	} else {
+		store.Range(func(*CacheEntry) bool {
+			stats.Entries++
+			return true
+		})
+	}
+	return stats
+}
+
+// CacheEntries 返回缓存的响应，route 不为空时只返回该路由的条目；Vary 的标记条目不返回
+func (f *Forwarder) CacheEntries(route string) []CacheEntryStatus {
+	store, _ := f.cache.getStore()
+	now := time.Now()
+	entries := []CacheEntryStatus{}
+	store.Range(func(e *CacheEntry) bool {
+		if len(e.Vary) == 0 && (route == "" || e.Route == route) {
+			entries = append(entries, CacheEntryStatus{
+				Key:      e.Key,
+				Route:    e.Route,
+				Status:   e.Status,
+				Size:     e.Size(),
+				StoredAt: e.StoredAt,
+				Expires:  e.Expires,
+				Fresh:    now.Before(e.Expires),
+			})
+		}
+		return true
+	})
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	return entries
+}
+
+// PurgeCache 删除缓存条目并返回删除的数量：key 不为空时删除该 key（包括其 Vary 变体），
+// route 不为空时删除该路由的所有条目，都为空时清空缓存
+func (f *Forwarder) PurgeCache(key, route string) int {
+	store, _ := f.cache.getStore()
+	purged := 0
+	store.Range(func(e *CacheEntry) bool {
+		match := key == "" && route == ""
+		if key != "" {
+			match = e.Key == key || strings.HasPrefix(e.Key, key+" vary[")
+		} else if route != "" {
+			match = e.Route == route
+		}
+		if match && store.Delete(e.Key) && len(e.Vary) == 0 {
+			purged++
+		}
+		return true
+	})
+	return purged
+}
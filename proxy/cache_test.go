@@ -0,0 +1,267 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ruke318/gateway/config"
+)
+
+func cachedGet(t *testing.T, f *Forwarder, cfg *config.CacheConfig, headers http.Header) (*http.Response, string) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/items?b=2&a=1", nil)
+	if headers == nil {
+		headers = http.Header{}
+	}
+	resp, body, err := f.Do(&ForwardOptions{
+		Method:   http.MethodGet,
+		Path:     "/items",
+		Headers:  headers,
+		Request:  req,
+		RouteKey: "GET /items",
+		Cache:    cfg,
+		CacheKey: CacheKey(req, nil),
+	})
+	if err != nil {
+		t.Fatalf("Do failed: %v", err)
+	}
+	return resp, string(body)
+}
+
+func TestCacheHitAndMiss(t *testing.T) {
+	var calls int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		if r.Header.Get("Cache-Control") == "no-store" {
+			w.Header().Set("Cache-Control", "no-store")
+		}
+		fmt.Fprintf(w, "v%d", n)
+	}))
+	defer backend.Close()
+
+	f := NewForwarder(backend.URL)
+	cfg := &config.CacheConfig{Enabled: true, TTL: config.Duration(time.Minute)}
+
+	resp, body := cachedGet(t, f, cfg, nil)
+	if body != "v1" || resp.Header.Get("X-Cache") != CacheMiss {
+		t.Fatalf("Expected miss, got %q %s", body, resp.Header.Get("X-Cache"))
+	}
+	resp, body = cachedGet(t, f, cfg, nil)
+	if body != "v1" || resp.Header.Get("X-Cache") != CacheHit || resp.Header.Get("Age") == "" {
+		t.Fatalf("Expected hit, got %q %v", body, resp.Header)
+	}
+
+	// 客户端 no-store 绕过缓存，也不覆盖已有条目
+	resp, body = cachedGet(t, f, cfg, http.Header{"Cache-Control": {"no-store"}})
+	if body != "v2" || resp.Header.Get("X-Cache") != CacheBypass {
+		t.Fatalf("Expected bypass, got %q %s", body, resp.Header.Get("X-Cache"))
+	}
+	if _, body = cachedGet(t, f, cfg, nil); body != "v1" {
+		t.Errorf("Cached entry should survive bypass, got %q", body)
+	}
+
+	stats := f.CacheStats()
+	if stats.Hits != 2 || stats.Misses != 1 || stats.Bypass != 1 || stats.Entries != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	entries := f.CacheEntries("GET /items")
+	if len(entries) != 1 || entries[0].Key != "GET example.com/items?a=1&b=2" || !entries[0].Fresh {
+		t.Errorf("Unexpected entries %+v", entries)
+	}
+	if n := f.PurgeCache("", "GET /items"); n != 1 {
+		t.Errorf("Expected 1 entry purged, got %d", n)
+	}
+	if _, body = cachedGet(t, f, cfg, nil); body != "v3" {
+		t.Errorf("Expected miss after purge, got %q", body)
+	}
+}
+
+func TestCacheRespectsCacheControl(t *testing.T) {
+	var calls int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		switch r.URL.Query().Get("case") {
+		case "private":
+			w.Header().Set("Cache-Control", "private, max-age=60")
+		case "cookie":
+			w.Header().Set("Set-Cookie", "session=1")
+		case "expired":
+			w.Header().Set("Cache-Control", "max-age=0")
+		case "error":
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		fmt.Fprintf(w, "v%d", n)
+	}))
+	defer backend.Close()
+
+	f := NewForwarder(backend.URL)
+	cfg := &config.CacheConfig{Enabled: true, TTL: config.Duration(time.Minute)}
+	for _, c := range []string{"private", "cookie", "expired", "error"} {
+		req := httptest.NewRequest(http.MethodGet, "/?case="+c, nil)
+		opts := &ForwardOptions{Method: http.MethodGet, Path: "/", RawQuery: req.URL.RawQuery, Headers: http.Header{}, Cache: cfg, CacheKey: CacheKey(req, nil)}
+		_, first, _ := f.Do(opts)
+		_, second, _ := f.Do(opts)
+		if string(first) == string(second) {
+			t.Errorf("Response for case %s should not be cached", c)
+		}
+	}
+
+	// 带 Authorization 的请求只有后端标记 public 时才缓存
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	opts := &ForwardOptions{Method: http.MethodGet, Path: "/", Headers: http.Header{"Authorization": {"Bearer user"}}, Cache: cfg, CacheKey: CacheKey(req, nil)}
+	_, first, _ := f.Do(opts)
+	_, second, _ := f.Do(opts)
+	if string(first) == string(second) {
+		t.Error("Authorized response without public should not be cached")
+	}
+}
+
+func TestCacheVary(t *testing.T) {
+	var calls int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Vary", "Accept-Language")
+		fmt.Fprintf(w, "hello in %s", r.Header.Get("Accept-Language"))
+	}))
+	defer backend.Close()
+
+	f := NewForwarder(backend.URL)
+	cfg := &config.CacheConfig{Enabled: true}
+	for i := 0; i < 2; i++ {
+		for _, lang := range []string{"en", "zh"} {
+			_, body := cachedGet(t, f, cfg, http.Header{"Accept-Language": {lang}})
+			if body != "hello in "+lang {
+				t.Errorf("Expected variant for %s, got %q", lang, body)
+			}
+		}
+	}
+	if calls != 2 {
+		t.Errorf("Expected one backend call per variant, got %d", calls)
+	}
+	if entries := f.CacheEntries(""); len(entries) != 2 {
+		t.Errorf("Expected 2 variants, got %+v", entries)
+	}
+	if n := f.PurgeCache("GET example.com/items?a=1&b=2", ""); n != 2 {
+		t.Errorf("Purging the key should remove all variants, got %d", n)
+	}
+}
+
+func TestCacheRevalidation(t *testing.T) {
+	var calls, notModified int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Etag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			atomic.AddInt32(&notModified, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte("body"))
+	}))
+	defer backend.Close()
+
+	f := NewForwarder(backend.URL)
+	cfg := &config.CacheConfig{Enabled: true}
+	cachedGet(t, f, cfg, nil)
+	resp, body := cachedGet(t, f, cfg, nil)
+	if resp.StatusCode != http.StatusOK || body != "body" || resp.Header.Get("X-Cache") != CacheRevalidated {
+		t.Fatalf("Expected revalidated response, got %d %q %s", resp.StatusCode, body, resp.Header.Get("X-Cache"))
+	}
+	if calls != 2 || notModified != 1 {
+		t.Errorf("Expected conditional request, got %d calls, %d not modified", calls, notModified)
+	}
+
+	// 客户端自己的条件请求由网关判断
+	resp, body = cachedGet(t, f, cfg, http.Header{"If-None-Match": {`W/"v1"`}})
+	if resp.StatusCode != http.StatusNotModified || body != "" || resp.Header.Get("Etag") != `"v1"` {
+		t.Errorf("Expected 304 for matching If-None-Match, got %d %q", resp.StatusCode, body)
+	}
+}
+
+func TestCacheStaleWhileRevalidate(t *testing.T) {
+	var calls int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		w.Header().Set("Cache-Control", "max-age=0, stale-while-revalidate=60")
+		fmt.Fprintf(w, "v%d", n)
+	}))
+	defer backend.Close()
+
+	f := NewForwarder(backend.URL)
+	cfg := &config.CacheConfig{Enabled: true}
+	cachedGet(t, f, cfg, nil)
+	resp, body := cachedGet(t, f, cfg, nil)
+	if body != "v1" || resp.Header.Get("X-Cache") != CacheStale {
+		t.Fatalf("Expected stale response, got %q %s", body, resp.Header.Get("X-Cache"))
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&calls) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	// 等待后台刷新写入缓存
+	time.Sleep(20 * time.Millisecond)
+	if _, body = cachedGet(t, f, cfg, nil); body != "v2" {
+		t.Errorf("Expected refreshed response, got %q", body)
+	}
+}
+
+func TestCacheStaleIfError(t *testing.T) {
+	var fail int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&fail) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Cache-Control", "max-age=0")
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	f := NewForwarder(backend.URL)
+	cfg := &config.CacheConfig{Enabled: true, StaleIfError: config.Duration(time.Minute)}
+	cachedGet(t, f, cfg, nil)
+
+	atomic.StoreInt32(&fail, 1)
+	resp, body := cachedGet(t, f, cfg, nil)
+	if resp.StatusCode != http.StatusOK || body != "ok" || resp.Header.Get("X-Cache") != CacheStale {
+		t.Errorf("Expected stale response on error, got %d %q", resp.StatusCode, body)
+	}
+
+	backend.Close()
+	if resp, body = cachedGet(t, f, cfg, nil); body != "ok" {
+		t.Errorf("Expected stale response when backend is down, got %d %q", resp.StatusCode, body)
+	}
+}
+
+func TestMemoryCacheStoreEviction(t *testing.T) {
+	store := NewMemoryCacheStore(250)
+	for i := 0; i < 3; i++ {
+		store.Set(&CacheEntry{Key: fmt.Sprintf("k%d", i), Body: make([]byte, 98)})
+		if i == 1 {
+			// 访问 k0，使 k1 成为最久未使用的条目
+			store.Get("k0")
+		}
+	}
+	if _, ok := store.Get("k1"); ok {
+		t.Error("Least recently used entry should be evicted")
+	}
+	for _, key := range []string{"k0", "k2"} {
+		if _, ok := store.Get(key); !ok {
+			t.Errorf("Entry %s should be kept", key)
+		}
+	}
+	if entries, bytes, _ := store.Usage(); entries != 2 || bytes != 200 {
+		t.Errorf("Unexpected usage %d entries, %d bytes", entries, bytes)
+	}
+
+	store.Set(&CacheEntry{Key: "huge", Body: make([]byte, 300)})
+	if _, ok := store.Get("huge"); ok {
+		t.Error("Entries larger than the store should not be kept")
+	}
+}
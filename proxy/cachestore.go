@@ -0,0 +1,140 @@
+package proxy
+
+import (
+	"container/list"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// CacheEntry 是一条缓存的后端响应
+type CacheEntry struct {
+	Key    string
+	Route  string // 所属路由的 Key，用于按路由清除
+	Status int
+	Header http.Header
+	Body   []byte
+
+	// StoredAt 存入或最近一次重新验证的时间；Expires 之前为新鲜，之后为过期
+	StoredAt time.Time
+	Expires  time.Time
+	// StaleWhileRevalidate 过期后仍可直接返回并在后台刷新的时间
+	StaleWhileRevalidate time.Duration
+	// StaleIfError 过期后后端出错时仍可返回的时间
+	StaleIfError time.Duration
+	// MustRevalidate 后端要求过期后必须重新验证（no-cache、must-revalidate），不返回过期的响应
+	MustRevalidate bool
+
+	// Vary 不为空时该条目只是标记：实际响应按这些请求头的值分别存储
+	Vary []string
+}
+
+// Size 条目占用的近似字节数
+func (e *CacheEntry) Size() int64 {
+	size := int64(len(e.Key) + len(e.Route) + len(e.Body))
+	for k, v := range e.Header {
+		size += int64(len(k))
+		for _, s := range v {
+			size += int64(len(s))
+		}
+	}
+	for _, v := range e.Vary {
+		size += int64(len(v))
+	}
+	return size
+}
+
+// CacheStore 缓存存储，实现需要并发安全；可以替换为 Redis 等外部存储
+type CacheStore interface {
+	Get(key string) (*CacheEntry, bool)
+	Set(entry *CacheEntry)
+	Delete(key string) bool
+	// Range 遍历所有条目，fn 返回 false 时停止；fn 中可以调用 Delete
+	Range(fn func(entry *CacheEntry) bool)
+}
+
+// MemoryCacheStore 按总字节数限制大小的内存 LRU 存储
+type MemoryCacheStore struct {
+	mu       sync.Mutex
+	maxBytes int64
+	bytes    int64
+	ll       *list.List
+	items    map[string]*list.Element
+}
+
+// NewMemoryCacheStore 创建内存存储，超过 maxBytes 时淘汰最久未使用的条目
+func NewMemoryCacheStore(maxBytes int64) *MemoryCacheStore {
+	return &MemoryCacheStore{
+		maxBytes: maxBytes,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (s *MemoryCacheStore) Get(key string) (*CacheEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.items[key]
+	if !ok {
+		return nil, false
+	}
+	s.ll.MoveToFront(el)
+	return el.Value.(*CacheEntry), true
+}
+
+// Set 存入条目，单个条目超过容量时不存储
+func (s *MemoryCacheStore) Set(entry *CacheEntry) {
+	size := entry.Size()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.items[entry.Key]; ok {
+		s.removeElement(el)
+	}
+	if size > s.maxBytes {
+		return
+	}
+	s.items[entry.Key] = s.ll.PushFront(entry)
+	s.bytes += size
+	for s.bytes > s.maxBytes {
+		s.removeElement(s.ll.Back())
+	}
+}
+
+func (s *MemoryCacheStore) Delete(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.items[key]
+	if ok {
+		s.removeElement(el)
+	}
+	return ok
+}
+
+func (s *MemoryCacheStore) Range(fn func(entry *CacheEntry) bool) {
+	s.mu.Lock()
+	entries := make([]*CacheEntry, 0, s.ll.Len())
+	for el := s.ll.Front(); el != nil; el = el.Next() {
+		entries = append(entries, el.Value.(*CacheEntry))
+	}
+	s.mu.Unlock()
+
+	for _, entry := range entries {
+		if !fn(entry) {
+			return
+		}
+	}
+}
+
+// Usage 返回当前的条目数、占用字节数和容量
+func (s *MemoryCacheStore) Usage() (entries int, bytes, maxBytes int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ll.Len(), s.bytes, s.maxBytes
+}
+
+func (s *MemoryCacheStore) removeElement(el *list.Element) {
+	entry := el.Value.(*CacheEntry)
+	s.ll.Remove(el)
+	delete(s.items, entry.Key)
+	s.bytes -= entry.Size()
+}
@@ -0,0 +1,92 @@
+package proxy
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// VariantStats 路由的一个 canary 版本的请求统计
+type VariantStats struct {
+	Route     string  `json:"route"`
+	Variant   string  `json:"variant"`
+	Requests  uint64  `json:"requests"`
+	Errors    uint64  `json:"errors"`    // 转发失败或后端返回 5xx 的请求
+	ErrorRate float64 `json:"errorRate"` // Errors / Requests
+}
+
+type canaryKey struct {
+	route, variant string
+}
+
+type canaryCounters struct {
+	requests, errors uint64
+}
+
+// canaryRecorder 按路由和版本统计请求数和错误数
+type canaryRecorder struct {
+	mu       sync.Mutex
+	counters map[canaryKey]*canaryCounters
+}
+
+func (r *canaryRecorder) record(opts *ForwardOptions, resp *http.Response, err error) {
+	key := canaryKey{route: opts.route(), variant: opts.Variant}
+	r.mu.Lock()
+	if r.counters == nil {
+		r.counters = make(map[canaryKey]*canaryCounters)
+	}
+	c, ok := r.counters[key]
+	if !ok {
+		c = &canaryCounters{}
+		r.counters[key] = c
+	}
+	r.mu.Unlock()
+
+	atomic.AddUint64(&c.requests, 1)
+	if err != nil || resp.StatusCode >= http.StatusInternalServerError {
+		atomic.AddUint64(&c.errors, 1)
+	}
+}
+
+// VariantStats 返回 canary 版本的统计，route 不为空时只返回该路由的版本
+func (f *Forwarder) VariantStats(route string) []VariantStats {
+	r := &f.canary
+	r.mu.Lock()
+	stats := make([]VariantStats, 0, len(r.counters))
+	for key, c := range r.counters {
+		if route != "" && key.route != route {
+			continue
+		}
+		s := VariantStats{
+			Route:    key.route,
+			Variant:  key.variant,
+			Requests: atomic.LoadUint64(&c.requests),
+			Errors:   atomic.LoadUint64(&c.errors),
+		}
+		if s.Requests > 0 {
+			s.ErrorRate = float64(s.Errors) / float64(s.Requests)
+		}
+		stats = append(stats, s)
+	}
+	r.mu.Unlock()
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Route != stats[j].Route {
+			return stats[i].Route < stats[j].Route
+		}
+		return stats[i].Variant < stats[j].Variant
+	})
+	return stats
+}
+
+// ResetVariantStats 清零路由的 canary 统计，用于调整权重后重新观察错误率
+func (f *Forwarder) ResetVariantStats(route string) {
+	r := &f.canary
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key := range r.counters {
+		if key.route == route {
+			delete(r.counters, key)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestVariantStats(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer backend.Close()
+
+	f := NewForwarder(backend.URL)
+	for _, path := range []string{"/ok", "/ok", "/ok", "/fail"} {
+		f.Do(&ForwardOptions{Method: http.MethodGet, Path: path, Headers: http.Header{}, RouteKey: "GET /orders", Variant: "canary"})
+	}
+	f.Do(&ForwardOptions{Method: http.MethodGet, Path: "/ok", Headers: http.Header{}, RouteKey: "GET /orders", Variant: "stable"})
+	// 未设置版本的请求不统计
+	f.Do(&ForwardOptions{Method: http.MethodGet, Path: "/ok", Headers: http.Header{}, RouteKey: "GET /orders"})
+
+	stats := f.VariantStats("GET /orders")
+	if len(stats) != 2 {
+		t.Fatalf("Expected 2 variants, got %+v", stats)
+	}
+	canary, stable := stats[0], stats[1]
+	if canary.Variant != "canary" || canary.Requests != 4 || canary.Errors != 1 || canary.ErrorRate != 0.25 {
+		t.Errorf("Unexpected canary stats %+v", canary)
+	}
+	if stable.Requests != 1 || stable.Errors != 0 {
+		t.Errorf("Unexpected stable stats %+v", stable)
+	}
+
+	f.ResetVariantStats("GET /orders")
+	if stats := f.VariantStats(""); len(stats) != 0 {
+		t.Errorf("Expected stats to be reset, got %+v", stats)
+	}
+}
@@ -0,0 +1,133 @@
+package proxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// 影响响应内容的请求头，值不同的请求不合并，避免把一个用户的响应返回给另一个用户
+// 路由改写的请求头由 ForwardOptions.CoalesceHeaders 补充
+var coalesceHeaders = []string{"Authorization", "Cookie", "Accept", "Accept-Encoding", "Accept-Language"}
+
+// flightGroup 合并相同 key 的并发请求
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flight
+}
+
+type flight struct {
+	done   chan struct{}
+	resp   *http.Response
+	body   []byte
+	status string
+	err    error
+}
+
+// do 同一时刻相同 key 只执行一次 fn，其余调用等待并共享结果；等待的调用在 ctx 结束时提前返回
+func (g *flightGroup) do(ctx context.Context, key string, fn func() (*http.Response, []byte, string, error)) (*http.Response, []byte, string, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flight)
+	}
+	if call, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.result()
+		case <-ctx.Done():
+			return nil, nil, "", ctx.Err()
+		}
+	}
+	call := &flight{done: make(chan struct{})}
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	func() {
+		defer func() {
+			g.mu.Lock()
+			delete(g.calls, key)
+			g.mu.Unlock()
+			close(call.done)
+		}()
+		call.resp, call.body, call.status, call.err = fn()
+	}()
+	return call.result()
+}
+
+// result 每个调用方得到独立的响应副本，响应体只读共享
+func (c *flight) result() (*http.Response, []byte, string, error) {
+	if c.err != nil {
+		return nil, nil, "", c.err
+	}
+	resp := *c.resp
+	resp.Header = c.resp.Header.Clone()
+	resp.Trailer = c.resp.Trailer.Clone()
+	resp.Body = http.NoBody
+	return &resp, c.body, c.status, nil
+}
+
+// coalesce 开启请求合并时，发往后端的请求相同的 GET、HEAD 请求同时只发送一次，响应分发给所有等待的请求
+// 发往后端的请求不随发起请求的客户端断开而取消，仍受总超时限制
+func (f *Forwarder) coalesce(opts *ForwardOptions, fn func(opts *ForwardOptions) (*http.Response, []byte, string, error)) (*http.Response, []byte, string, error) {
+	method := strings.ToUpper(opts.Method)
+	if !opts.Coalesce || (method != http.MethodGet && method != http.MethodHead) {
+		return fn(opts)
+	}
+
+	key, err := f.coalesceKey(opts)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	shared := *opts
+	if opts.Request != nil {
+		shared.Request = opts.Request.WithContext(context.Background())
+	}
+	return f.flights.do(requestContext(opts.Request), key, func() (*http.Response, []byte, string, error) {
+		return fn(&shared)
+	})
+}
+
+// coalesceKey 由发往后端的请求生成合并 key：方法、目标地址（包含改写后的查询参数）、请求体，
+// 以及 coalesceHeaders 和 CoalesceHeaders 中的请求头；路由用上下文改写的查询参数或请求头不同的请求不会合并
+func (f *Forwarder) coalesceKey(opts *ForwardOptions) (string, error) {
+	base := opts.BackendURL
+	if opts.Upstream != nil {
+		base = "upstream://" + opts.Upstream.Name
+	} else if base == "" {
+		base = f.backendURL
+	}
+	target, err := joinURL(base, opts.Path, opts.RawQuery)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	sb.WriteString(strings.ToUpper(opts.Method) + " " + target)
+	if len(opts.Body) > 0 {
+		sum := sha256.Sum256(opts.Body)
+		sb.WriteString(" body=" + hex.EncodeToString(sum[:]))
+	}
+	names := make(map[string]bool, len(coalesceHeaders)+len(opts.CoalesceHeaders))
+	for _, name := range coalesceHeaders {
+		names[name] = true
+	}
+	for _, name := range opts.CoalesceHeaders {
+		names[http.CanonicalHeaderKey(name)] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	for _, name := range sorted {
+		if values := opts.Headers.Values(name); len(values) > 0 {
+			sb.WriteString(" " + name + "=" + strings.Join(values, ","))
+		}
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,149 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ruke318/gateway/config"
+)
+
+func TestCoalesceConcurrentRequests(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		<-release
+		w.Header().Set("X-Call", fmt.Sprint(n))
+		fmt.Fprintf(w, "v%d %s", n, r.Header.Get("Authorization"))
+	}))
+	defer backend.Close()
+
+	f := NewForwarder(backend.URL)
+	get := func(auth string) (*http.Response, string, error) {
+		req := httptest.NewRequest(http.MethodGet, "/items", nil)
+		headers := http.Header{}
+		if auth != "" {
+			headers.Set("Authorization", auth)
+		}
+		resp, body, err := f.Do(&ForwardOptions{
+			Method:   http.MethodGet,
+			Path:     "/items",
+			Headers:  headers,
+			Request:  req,
+			CacheKey: CacheKey(req, nil),
+			Coalesce: true,
+		})
+		return resp, string(body), err
+	}
+
+	const clients = 20
+	var wg sync.WaitGroup
+	bodies := make([]string, clients)
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, body, err := get("")
+			if err != nil {
+				t.Errorf("Do failed: %v", err)
+				return
+			}
+			// 每个调用方拿到独立的 Header
+			resp.Header.Set("X-Call", "changed")
+			bodies[i] = body
+		}(i)
+	}
+	// 凭证不同的请求不合并
+	wg.Add(1)
+	var authorized string
+	go func() {
+		defer wg.Done()
+		_, authorized, _ = get("Bearer user")
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&calls) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	// 等待其余请求加入进行中的调用
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls != 2 {
+		t.Fatalf("Expected 2 backend calls, got %d", calls)
+	}
+	for _, body := range bodies {
+		if body != bodies[0] {
+			t.Errorf("All coalesced requests should share the response, got %q and %q", bodies[0], body)
+		}
+	}
+	if authorized == bodies[0] || !strings.HasSuffix(authorized, "user") {
+		t.Errorf("Authorized request should not be coalesced, got %q", authorized)
+	}
+
+	// 调用结束后不再共享结果
+	resp, body, err := get("")
+	if err != nil || body == bodies[0] || resp.Header.Get("X-Call") != "3" {
+		t.Errorf("Expected a new backend call, got %q %v", body, err)
+	}
+}
+
+func TestCoalesceCacheMiss(t *testing.T) {
+	var calls int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	f := NewForwarder(backend.URL)
+	cfg := &config.CacheConfig{Enabled: true, TTL: config.Duration(time.Minute)}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodGet, "/items", nil)
+			resp, body, err := f.Do(&ForwardOptions{Method: http.MethodGet, Path: "/items", Headers: http.Header{}, Request: req, Cache: cfg, CacheKey: CacheKey(req, nil), Coalesce: true})
+			if err != nil || string(body) != "ok" || resp.Header.Get("X-Cache") == "" {
+				t.Errorf("Unexpected response %q %v", body, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls != 1 {
+		t.Errorf("Concurrent cache misses should make one backend call, got %d", calls)
+	}
+}
+
+func TestCoalesceSkipsUnsafeMethods(t *testing.T) {
+	var calls int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(50 * time.Millisecond)
+	}))
+	defer backend.Close()
+
+	f := NewForwarder(backend.URL)
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodPost, "/items", nil)
+			f.Do(&ForwardOptions{Method: http.MethodPost, Path: "/items", Headers: http.Header{}, Request: req, CacheKey: CacheKey(req, nil), Coalesce: true})
+		}()
+	}
+	wg.Wait()
+	if calls != 3 {
+		t.Errorf("POST requests should not be coalesced, got %d backend calls", calls)
+	}
+}
@@ -2,47 +2,404 @@ package proxy
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"io"
+	"log"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ruke318/gateway/config"
 )
 
+// ErrResponseTooLarge 缓冲模式下后端响应体超过 MaxResponseBody
+var ErrResponseTooLarge = errors.New("response body too large")
+
 type Forwarder struct {
 	backendURL string
-	client     *http.Client
+	clients    clientPool
+	upstreams  *upstreamRegistry
+	budgets    retryBudgets
+	breakers   breakerRegistry
+	// grpcMethods 缓存 REST 转 gRPC 路由使用的描述文件
+	grpcMethods grpcMethodCache
+
+	headerMu       sync.RWMutex
+	trustedProxies TrustedProxies
+
+	cache   *responseCache
+	flights flightGroup
+	mirrors mirrorRecorder
+	canary  canaryRecorder
 }
 
 func NewForwarder(backendURL string) *Forwarder {
 	return &Forwarder{
 		backendURL: backendURL,
-		client:     &http.Client{},
+		upstreams:  newUpstreamRegistry(),
+		cache:      newResponseCache(),
 	}
 }
 
+// ForwardOptions 描述一次转发到后端的请求
+type ForwardOptions struct {
+	Method     string
+	BackendURL string // 未设置 Upstream 时使用，可以带基础路径；为空时使用默认后端
+	Path       string // 后端路径，可以带查询字符串（来自路径改写）
+	RawQuery   string // 转发的查询字符串，与 Path 中的查询字符串合并
+	Body       []byte
+	// Headers 客户端请求头，转发时去掉逐跳 Header 并追加 X-Forwarded-* 和 Forwarded（需要设置 Request）
+	Headers http.Header
+
+	// BodyReader 流式请求体，设置后忽略 Body；流式请求体无法重放，不会重试
+	BodyReader io.Reader
+	// ContentLength BodyReader 的长度，-1 表示未知（使用分块传输）
+	ContentLength int64
+	// MaxResponseBody Do 读取响应体的上限，超过时返回 ErrResponseTooLarge；为 0 时不限制
+	MaxResponseBody int64
+
+	// Upstream 设置后由负载均衡器选择节点，忽略 BackendURL
+	Upstream *Upstream
+	// Request 原始客户端请求，供一致性哈希等策略读取 Header、Cookie 和客户端 IP
+	Request *http.Request
+
+	// RouteKey 请求所属的路由 Key，相同 Key 的请求共享重试预算和熔断器
+	// canary 版本指定了自己的后端时为 "路由 Key#版本名"，缓存、镜像和版本统计仍归属路由 Key
+	RouteKey string
+	// Retry 重试策略，为 nil 时不重试
+	Retry *config.RetryConfig
+	// CircuitBreaker 熔断配置，为 nil 时只受手动熔断影响
+	CircuitBreaker *config.CircuitBreakerConfig
+	// Protocol 后端协议，取值见 config.Protocol*
+	Protocol string
+	// Timeout 路由的超时配置，未设置的字段使用 SetTimeout 设置的全局配置
+	Timeout *config.TimeoutConfig
+	// IdleTimeout 只对 DoStream 生效：设置后不再限制总耗时，改为读取响应体时超过该时间没有数据则断开
+	// 用于 SSE 这类长时间保持的响应
+	IdleTimeout time.Duration
+	// Cache 响应缓存配置，与 CacheKey 同时设置时 Do 先查询缓存，只对 GET 和 HEAD 生效
+	Cache    *config.CacheConfig
+	CacheKey string
+	// Coalesce 合并发往后端的请求相同的并发 GET、HEAD 请求，只向后端发送一次
+	Coalesce bool
+	// CoalesceHeaders 除凭证和内容协商请求头外，参与请求合并比较的请求头，如路由改写的请求头
+	CoalesceHeaders []string
+	// Variant 请求命中的 canary 版本名，设置后按路由和版本统计请求数和错误数
+	Variant string
+	// OnRetry 在每次重试前调用，attempt 为即将进行的尝试序号（从 2 开始），reason 为重试原因
+	// 返回错误时放弃重试，返回上一次尝试的结果
+	OnRetry func(attempt int, reason string) error
+}
+
 func (f *Forwarder) Forward(req *http.Request, body []byte) (*http.Response, []byte, error) {
-	return f.ForwardWithOptions(req.Method, f.backendURL, req.URL.Path, body, req.Header)
+	return f.Do(&ForwardOptions{
+		Method:     req.Method,
+		BackendURL: f.backendURL,
+		Path:       req.URL.Path,
+		RawQuery:   req.URL.RawQuery,
+		Body:       body,
+		Headers:    req.Header,
+		Request:    req,
+	})
 }
 
 func (f *Forwarder) ForwardWithOptions(method, backendURL, path string, body []byte, headers http.Header) (*http.Response, []byte, error) {
-	url := backendURL + path
-	proxyReq, err := http.NewRequest(method, url, bytes.NewReader(body))
+	return f.Do(&ForwardOptions{
+		Method:     method,
+		BackendURL: backendURL,
+		Path:       path,
+		Body:       body,
+		Headers:    headers,
+	})
+}
+
+// Do 执行一次转发，返回后端响应和完整的响应体
+// 配置了重试策略时，失败的尝试会在退避等待后重新选择节点再次发送；
+// 熔断器打开时首次尝试返回 ErrCircuitOpen，重试过程中熔断则返回上一次尝试的结果
+func (f *Forwarder) Do(opts *ForwardOptions) (resp *http.Response, body []byte, err error) {
+	if opts.Variant != "" {
+		defer func() { f.canary.record(opts, resp, err) }()
+	}
+	if opts.Cache != nil && opts.Cache.Enabled && opts.CacheKey != "" {
+		return f.doCached(opts)
+	}
+	resp, body, _, err = f.coalesce(opts, func(opts *ForwardOptions) (*http.Response, []byte, string, error) {
+		resp, body, err := f.do(opts, false)
+		return resp, body, "", err
+	})
+	return resp, body, err
+}
+
+// DoStream 与 Do 相同，但不读取响应体：返回的 resp.Body 直接读取后端连接，调用方必须关闭
+// 响应体关闭前节点一直计为进行中的请求，总超时覆盖整个响应体的传输
+func (f *Forwarder) DoStream(opts *ForwardOptions) (*http.Response, error) {
+	resp, _, err := f.do(opts, true)
+	if opts.Variant != "" {
+		f.canary.record(opts, resp, err)
+	}
+	return resp, err
+}
+
+func (f *Forwarder) do(opts *ForwardOptions, stream bool) (*http.Response, []byte, error) {
+	breaker := f.breakers.get(opts.RouteKey, opts.CircuitBreaker)
+	policy := newRetryPolicy(opts.Retry)
+	if policy != nil && (opts.BodyReader != nil || !policy.methods[strings.ToUpper(opts.Method)]) {
+		policy = nil
+	}
+	var budget *retryBudget
+	if policy != nil {
+		budget = f.budgets.get(opts.RouteKey)
+		budget.request()
+	}
+
+	var resp *http.Response
+	var respBody []byte
+	var err error
+	for attempt := 1; ; attempt++ {
+		if breaker != nil && !breaker.allow() {
+			if attempt == 1 {
+				return nil, nil, fmt.Errorf("%w: %s", ErrCircuitOpen, opts.RouteKey)
+			}
+			log.Printf("[retry] %s %s: circuit opened, giving up after attempt %d", opts.Method, opts.Path, attempt-1)
+			return resp, respBody, err
+		}
+
+		resp, respBody, err = f.attempt(opts, breaker, stream)
+		// 客户端已断开时不再重试
+		if policy == nil || attempt >= policy.attempts || requestContext(opts.Request).Err() != nil {
+			return resp, respBody, err
+		}
+		reason, retry := policy.reason(resp, err)
+		if !retry {
+			return resp, respBody, err
+		}
+		if !budget.allow(opts.Retry) {
+			log.Printf("[retry] %s %s: retry budget exhausted, giving up after attempt %d (%s)", opts.Method, opts.Path, attempt, reason)
+			return resp, respBody, err
+		}
+		if opts.OnRetry != nil {
+			if hookErr := opts.OnRetry(attempt+1, reason); hookErr != nil {
+				log.Printf("[retry] %s %s: retry cancelled by hook: %v", opts.Method, opts.Path, hookErr)
+				return resp, respBody, err
+			}
+		}
+
+		delay := policy.delay(attempt)
+		log.Printf("[retry] %s %s: attempt %d/%d failed (%s), retrying in %s", opts.Method, opts.Path, attempt, policy.attempts, reason, delay)
+		if !sleepContext(requestContext(opts.Request), delay) {
+			return resp, respBody, err
+		}
+		if stream && resp != nil {
+			resp.Body.Close()
+		}
+	}
+}
+
+// attempt 选择节点并发送一次请求，结果计入被动健康检查和熔断统计
+// 流式请求以收到响应头为准，响应体传输中的错误不计入
+func (f *Forwarder) attempt(opts *ForwardOptions, breaker *circuitBreaker, stream bool) (*http.Response, []byte, error) {
+	start := time.Now()
+	resp, respBody, err := f.sendToUpstream(opts, stream)
+	if breaker != nil {
+		status := 0
+		if resp != nil {
+			status = resp.StatusCode
+		}
+		if canceled(opts.Request, err) {
+			breaker.abandon()
+		} else {
+			breaker.record(upstreamError(err), status, time.Since(start))
+		}
+	}
+	return resp, respBody, err
+}
+
+func (f *Forwarder) sendToUpstream(opts *ForwardOptions, stream bool) (*http.Response, []byte, error) {
+	backendURL := opts.BackendURL
+	if backendURL == "" {
+		backendURL = f.backendURL
+	}
+	var target *Target
+	if opts.Upstream != nil {
+		var err error
+		if target, err = opts.Upstream.Select(opts.Request); err != nil {
+			return nil, nil, err
+		}
+		target.acquire()
+		backendURL = target.URL
+	}
+	report := func(resp *http.Response, err error) {
+		if target == nil || canceled(opts.Request, err) {
+			return
+		}
+		status := 0
+		if resp != nil {
+			status = resp.StatusCode
+		}
+		opts.Upstream.report(target, upstreamError(err), status)
+	}
+	release := func() {
+		if target != nil {
+			target.release()
+		}
+	}
+
+	resp, cancel, err := f.roundTrip(opts, backendURL)
 	if err != nil {
+		report(nil, err)
+		release()
 		return nil, nil, err
 	}
 
-	for k, v := range headers {
-		proxyReq.Header[k] = v
+	if stream {
+		report(resp, nil)
+		if opts.IdleTimeout > 0 {
+			resp.Body = newIdleTimeoutBody(resp.Body, opts.IdleTimeout, cancel)
+		}
+		resp.Body = &streamBody{ReadCloser: resp.Body, done: func() {
+			cancel()
+			release()
+		}}
+		return resp, nil, nil
 	}
 
-	resp, err := f.client.Do(proxyReq)
+	defer release()
+	defer cancel()
+	respBody, err := readBody(resp.Body, opts.MaxResponseBody)
+	resp.Body.Close()
 	if err != nil {
+		report(resp, err)
 		return nil, nil, err
 	}
+	report(resp, nil)
+	return resp, respBody, nil
+}
+
+// upstreamError 过滤不算作后端故障的错误：响应体超限是网关的限制，后端已正常响应
+func upstreamError(err error) error {
+	if errors.Is(err, ErrResponseTooLarge) {
+		return nil
+	}
+	return err
+}
 
-	respBody, err := io.ReadAll(resp.Body)
-	resp.Body.Close()
+// canceled 判断请求是否因客户端断开而失败，这类结果既不是成功也不是失败，不计入健康检查和熔断
+func canceled(req *http.Request, err error) bool {
+	return err != nil && requestContext(req).Err() != nil
+}
+
+// route 返回请求所属的路由 Key，去掉 canary 版本独立熔断时附加的版本名
+func (opts *ForwardOptions) route() string {
+	if opts.Variant == "" {
+		return opts.RouteKey
+	}
+	return strings.TrimSuffix(opts.RouteKey, "#"+opts.Variant)
+}
+
+func requestContext(req *http.Request) context.Context {
+	if req == nil {
+		return context.Background()
+	}
+	return req.Context()
+}
+
+// roundTrip 发送请求并返回响应头，cancel 需要在响应体读取完成后调用
+func (f *Forwarder) roundTrip(opts *ForwardOptions, backendURL string) (*http.Response, context.CancelFunc, error) {
+	// 客户端断开或超过总超时时取消后端请求；设置了空闲超时的流式响应和没有截止时间的 gRPC 调用不限制总耗时
+	timeout := f.clients.resolve(opts.Timeout)
+	deadline := grpcDeadline(opts, timeout.Total.Std())
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if opts.IdleTimeout > 0 || deadline == 0 {
+		ctx, cancel = context.WithCancel(requestContext(opts.Request))
+	} else {
+		ctx, cancel = context.WithTimeout(requestContext(opts.Request), deadline)
+	}
+
+	target, err := joinURL(backendURL, opts.Path, opts.RawQuery)
 	if err != nil {
+		cancel()
 		return nil, nil, err
 	}
 
-	return resp, respBody, nil
+	var body io.Reader = bytes.NewReader(opts.Body)
+	if opts.BodyReader != nil {
+		body = opts.BodyReader
+	}
+	proxyReq, err := http.NewRequestWithContext(ctx, opts.Method, target, body)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	if opts.BodyReader != nil {
+		proxyReq.ContentLength = opts.ContentLength
+	}
+
+	proxyReq.Header = f.outgoingHeaders(opts, false)
+
+	resp, err := f.clients.client(opts.Protocol, timeout).Do(proxyReq)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	return resp, cancel, nil
+}
+
+// readBody 读取响应体，max 大于 0 时超过上限返回 ErrResponseTooLarge
+func readBody(r io.Reader, max int64) ([]byte, error) {
+	if max <= 0 {
+		return io.ReadAll(r)
+	}
+	data, err := io.ReadAll(io.LimitReader(r, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > max {
+		return nil, fmt.Errorf("%w: exceeds %d bytes", ErrResponseTooLarge, max)
+	}
+	return data, nil
+}
+
+// streamBody 在响应体关闭时取消请求 context 并释放节点
+type streamBody struct {
+	io.ReadCloser
+	once sync.Once
+	done func()
+}
+
+func (b *streamBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.done)
+	return err
+}
+
+// joinURL 拼接后端地址、路径和查询字符串
+// backendURL 的基础路径与 path 之间只保留一个 "/"；backendURL、path 和 rawQuery 中的查询字符串依次合并
+func joinURL(backendURL, path, rawQuery string) (string, error) {
+	u, err := url.Parse(backendURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid backend url %q: %w", backendURL, err)
+	}
+
+	pathQuery := ""
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path, pathQuery = path[:i], path[i+1:]
+	}
+	if path != "" {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + strings.TrimPrefix(path, "/")
+		u.RawPath = ""
+	}
+
+	var parts []string
+	for _, q := range []string{u.RawQuery, pathQuery, rawQuery} {
+		if q != "" {
+			parts = append(parts, q)
+		}
+	}
+	u.RawQuery = strings.Join(parts, "&")
+	return u.String(), nil
 }
@@ -0,0 +1,53 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestJoinURL(t *testing.T) {
+	tests := []struct {
+		backendURL string
+		path       string
+		rawQuery   string
+		expected   string
+	}{
+		{"http://backend", "/api/users", "", "http://backend/api/users"},
+		{"http://backend/", "/api/users", "", "http://backend/api/users"},
+		{"http://backend/base", "/api/users", "", "http://backend/base/api/users"},
+		{"http://backend/base/", "api/users/", "", "http://backend/base/api/users/"},
+		{"http://backend/base", "", "", "http://backend/base"},
+		{"http://backend", "/search", "q=phone&page=2", "http://backend/search?q=phone&page=2"},
+		{"http://backend?key=1", "/v2/items?sort=asc", "page=2", "http://backend/v2/items?key=1&sort=asc&page=2"},
+		{"http://backend", "/files/my report.pdf", "", "http://backend/files/my%20report.pdf"},
+	}
+
+	for _, tt := range tests {
+		got, err := joinURL(tt.backendURL, tt.path, tt.rawQuery)
+		if err != nil {
+			t.Errorf("joinURL(%q, %q, %q) failed: %v", tt.backendURL, tt.path, tt.rawQuery, err)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("joinURL(%q, %q, %q) = %q, want %q", tt.backendURL, tt.path, tt.rawQuery, got, tt.expected)
+		}
+	}
+}
+
+func TestForwardPreservesQuery(t *testing.T) {
+	var received string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.URL.RequestURI()
+	}))
+	defer backend.Close()
+
+	f := NewForwarder(backend.URL + "/base/")
+	req := httptest.NewRequest(http.MethodGet, "/api/users?id=1&tag=a&tag=b", nil)
+	if _, _, err := f.Forward(req, nil); err != nil {
+		t.Fatalf("Forward failed: %v", err)
+	}
+	if received != "/base/api/users?id=1&tag=a&tag=b" {
+		t.Errorf("Expected query to be forwarded, backend received %s", received)
+	}
+}
@@ -0,0 +1,121 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ruke318/gateway/config"
+)
+
+// gRPC 状态码，见 https://grpc.github.io/grpc/core/md_doc_statuscodes.html
+const (
+	GRPCOK                 = 0
+	GRPCCanceled           = 1
+	GRPCUnknown            = 2
+	GRPCInvalidArgument    = 3
+	GRPCDeadlineExceeded   = 4
+	GRPCNotFound           = 5
+	GRPCAlreadyExists      = 6
+	GRPCPermissionDenied   = 7
+	GRPCResourceExhausted  = 8
+	GRPCFailedPrecondition = 9
+	GRPCAborted            = 10
+	GRPCOutOfRange         = 11
+	GRPCUnimplemented      = 12
+	GRPCInternal           = 13
+	GRPCUnavailable        = 14
+	GRPCUnauthenticated    = 16
+)
+
+// IsGRPCRequest 判断请求是否为 gRPC 调用（Content-Type 为 application/grpc 或 application/grpc+proto 等）
+func IsGRPCRequest(r *http.Request) bool {
+	contentType := r.Header.Get("Content-Type")
+	return contentType == "application/grpc" || strings.HasPrefix(contentType, "application/grpc+") || strings.HasPrefix(contentType, "application/grpc;")
+}
+
+// GRPCStatusFromHTTP 按 gRPC 规范将没有 grpc-status 的 HTTP 错误响应映射为 gRPC 状态码
+func GRPCStatusFromHTTP(status int) int {
+	switch status {
+	case http.StatusBadRequest:
+		return GRPCInternal
+	case http.StatusUnauthorized:
+		return GRPCUnauthenticated
+	case http.StatusForbidden:
+		return GRPCPermissionDenied
+	case http.StatusNotFound:
+		return GRPCUnimplemented
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return GRPCUnavailable
+	default:
+		return GRPCUnknown
+	}
+}
+
+// WriteGRPCStatus 以 Trailers-Only 形式返回 gRPC 错误：HTTP 200，状态放在响应头中
+func WriteGRPCStatus(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	if message != "" {
+		w.Header().Set("Grpc-Message", encodeGRPCMessage(message))
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// encodeGRPCMessage 按规范对 grpc-message 做百分号编码
+func encodeGRPCMessage(msg string) string {
+	var sb strings.Builder
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		if c >= ' ' && c <= '~' && c != '%' {
+			sb.WriteByte(c)
+		} else {
+			fmt.Fprintf(&sb, "%%%02X", c)
+		}
+	}
+	return sb.String()
+}
+
+// parseGRPCTimeout 解析 grpc-timeout 请求头，如 "100m"、"5S"
+func parseGRPCTimeout(s string) (time.Duration, bool) {
+	if len(s) < 2 || len(s) > 9 {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(s[:len(s)-1], 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	units := map[byte]time.Duration{
+		'H': time.Hour,
+		'M': time.Minute,
+		'S': time.Second,
+		'm': time.Millisecond,
+		'u': time.Microsecond,
+		'n': time.Nanosecond,
+	}
+	unit, ok := units[s[len(s)-1]]
+	if !ok {
+		return 0, false
+	}
+	return time.Duration(n) * unit, true
+}
+
+// grpcDeadline 返回单次尝试的总超时，为 0 时不限制总耗时
+// gRPC 路由优先使用客户端通过 grpc-timeout 指定的截止时间，其次是路由配置的 timeout.total；
+// 两者都没有时不使用全局的默认总超时，避免长时间的流式调用被中断
+func grpcDeadline(opts *ForwardOptions, total time.Duration) time.Duration {
+	if opts.Protocol != config.ProtocolGRPC {
+		return total
+	}
+	if opts.Request != nil {
+		if timeout, ok := parseGRPCTimeout(opts.Request.Header.Get("Grpc-Timeout")); ok {
+			return timeout
+		}
+	}
+	if opts.Timeout != nil && opts.Timeout.Total > 0 {
+		return total
+	}
+	return 0
+}
@@ -0,0 +1,201 @@
+package proxy
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ruke318/gateway/config"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+func newH2CServer(handler http.HandlerFunc) *httptest.Server {
+	return httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+}
+
+func TestForwardH2CWithTrailers(t *testing.T) {
+	backend := newH2CServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 {
+			w.WriteHeader(http.StatusHTTPVersionNotSupported)
+			return
+		}
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.Write([]byte("ok"))
+		w.Header().Set("Grpc-Status", "0")
+	})
+	defer backend.Close()
+
+	f := NewForwarder(backend.URL)
+	resp, body, err := f.Do(&ForwardOptions{Method: http.MethodGet, Path: "/", Protocol: config.ProtocolH2})
+	if err != nil {
+		t.Fatalf("Do failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || string(body) != "ok" {
+		t.Fatalf("Expected HTTP/2 response, got %d %q", resp.StatusCode, body)
+	}
+	if resp.Trailer.Get("Grpc-Status") != "0" {
+		t.Errorf("Expected trailer to be preserved, got %v", resp.Trailer)
+	}
+
+	// 默认协议对 http 后端使用 HTTP/1.1
+	resp, _, err = f.Do(&ForwardOptions{Method: http.MethodGet, Path: "/"})
+	if err != nil || resp.StatusCode != http.StatusHTTPVersionNotSupported {
+		t.Errorf("Default protocol should use HTTP/1.1, got %v %v", resp, err)
+	}
+}
+
+func TestGRPCBidiStream(t *testing.T) {
+	backend := newH2CServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Grpc-Timeout") != "2S" {
+			t.Errorf("grpc-timeout should be forwarded, got %q", r.Header.Get("Grpc-Timeout"))
+		}
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.Header().Set("Content-Type", "application/grpc")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+
+		// 逐行回传，请求体未结束时就写出响应，验证双向流
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			w.Write([]byte("echo:" + scanner.Text() + "\n"))
+			w.(http.Flusher).Flush()
+		}
+		w.Header().Set("Grpc-Status", "0")
+	})
+	defer backend.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/svc.Echo/Chat", nil)
+	req.Header.Set("Grpc-Timeout", "2S")
+	requestBody, requestWriter := io.Pipe()
+
+	f := NewForwarder(backend.URL)
+	resp, err := f.DoStream(&ForwardOptions{
+		Method:        http.MethodPost,
+		Path:          "/svc.Echo/Chat",
+		Headers:       req.Header,
+		Request:       req,
+		Protocol:      config.ProtocolGRPC,
+		BodyReader:    requestBody,
+		ContentLength: -1,
+		// 总超时短于 grpc-timeout，gRPC 路由应以 grpc-timeout 为准
+		Timeout: &config.TimeoutConfig{Total: config.Duration(50 * time.Millisecond)},
+	})
+	if err != nil {
+		t.Fatalf("DoStream failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	reader := bufio.NewReader(resp.Body)
+	for _, msg := range []string{"a", "b"} {
+		time.Sleep(40 * time.Millisecond)
+		requestWriter.Write([]byte(msg + "\n"))
+		line, err := reader.ReadString('\n')
+		if err != nil || line != "echo:"+msg+"\n" {
+			t.Fatalf("Expected echo of %q, got %q, err %v", msg, line, err)
+		}
+	}
+	requestWriter.Close()
+
+	if _, err := io.ReadAll(reader); err != nil {
+		t.Fatalf("Read rest failed: %v", err)
+	}
+	if resp.Trailer.Get("Grpc-Status") != "0" {
+		t.Errorf("Expected grpc-status trailer, got %v", resp.Trailer)
+	}
+}
+
+func TestGRPCDeadline(t *testing.T) {
+	withTimeout := httptest.NewRequest(http.MethodPost, "/svc.Echo/Chat", nil)
+	withTimeout.Header.Set("Grpc-Timeout", "2S")
+	routeTotal := &config.TimeoutConfig{Total: config.Duration(5 * time.Second)}
+
+	tests := []struct {
+		name string
+		opts ForwardOptions
+		want time.Duration
+	}{
+		{name: "http", opts: ForwardOptions{}, want: time.Minute},
+		{name: "grpc-timeout", opts: ForwardOptions{Protocol: config.ProtocolGRPC, Request: withTimeout, Timeout: routeTotal}, want: 2 * time.Second},
+		{name: "route total", opts: ForwardOptions{Protocol: config.ProtocolGRPC, Timeout: routeTotal}, want: time.Minute},
+		// 客户端和路由都未指定截止时间时不使用默认总超时
+		{name: "no deadline", opts: ForwardOptions{Protocol: config.ProtocolGRPC, Request: httptest.NewRequest(http.MethodPost, "/", nil)}, want: 0},
+	}
+	for _, tt := range tests {
+		if got := grpcDeadline(&tt.opts, time.Minute); got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestGRPCStreamWithoutDeadline(t *testing.T) {
+	backend := newH2CServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.Header().Set("Content-Type", "application/grpc")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("done"))
+		w.Header().Set("Grpc-Status", "0")
+	})
+	defer backend.Close()
+
+	f := NewForwarder(backend.URL)
+	// 全局总超时不作用于没有截止时间的 gRPC 流
+	f.SetTimeout(config.TimeoutConfig{Total: config.Duration(30 * time.Millisecond)})
+	req := httptest.NewRequest(http.MethodPost, "/svc.Feed/Watch", nil)
+	resp, err := f.DoStream(&ForwardOptions{
+		Method:   http.MethodPost,
+		Path:     "/svc.Feed/Watch",
+		Headers:  http.Header{},
+		Request:  req,
+		Protocol: config.ProtocolGRPC,
+	})
+	if err != nil {
+		t.Fatalf("DoStream failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil || string(body) != "done" {
+		t.Fatalf("Expected stream to outlive the default total timeout, got %q, err %v", body, err)
+	}
+}
+
+func TestGRPCHelpers(t *testing.T) {
+	timeouts := map[string]time.Duration{
+		"1H":   time.Hour,
+		"5S":   5 * time.Second,
+		"100m": 100 * time.Millisecond,
+		"10u":  10 * time.Microsecond,
+		"x":    0,
+		"10s":  0,
+		"":     0,
+	}
+	for s, want := range timeouts {
+		got, ok := parseGRPCTimeout(s)
+		if got != want || ok != (want > 0) {
+			t.Errorf("parseGRPCTimeout(%q) = %v, %v, want %v", s, got, ok, want)
+		}
+	}
+
+	statuses := map[int]int{
+		http.StatusUnauthorized:        GRPCUnauthenticated,
+		http.StatusNotFound:            GRPCUnimplemented,
+		http.StatusServiceUnavailable:  GRPCUnavailable,
+		http.StatusInternalServerError: GRPCUnknown,
+	}
+	for status, want := range statuses {
+		if got := GRPCStatusFromHTTP(status); got != want {
+			t.Errorf("GRPCStatusFromHTTP(%d) = %d, want %d", status, got, want)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	WriteGRPCStatus(w, GRPCUnavailable, "upstream 100% down\n")
+	if w.Code != http.StatusOK || w.Header().Get("Grpc-Status") != "14" || w.Header().Get("Grpc-Message") != "upstream 100%25 down%0A" {
+		t.Errorf("Unexpected grpc status response: %d %v", w.Code, w.Header())
+	}
+}
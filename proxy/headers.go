@@ -0,0 +1,183 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// 逐跳 Header 只对单个连接有效，不能转发，见 RFC 7230 6.1
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Connection",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// RemoveHopHeaders 删除逐跳 Header，包括 Connection 中列出的 Header
+func RemoveHopHeaders(h http.Header) {
+	for _, v := range h["Connection"] {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				h.Del(name)
+			}
+		}
+	}
+	for _, name := range hopHeaders {
+		h.Del(name)
+	}
+}
+
+// TrustedProxies 受信任的前置代理地址，只有来自这些地址的请求才保留其携带的 X-Forwarded-* 和 Forwarded
+type TrustedProxies []*net.IPNet
+
+// ParseTrustedProxies 解析 CIDR 或单个 IP 列表
+func ParseTrustedProxies(entries []string) (TrustedProxies, error) {
+	proxies := make(TrustedProxies, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+			}
+			bits := 8 * net.IPv4len
+			if ip.To4() == nil {
+				bits = 8 * net.IPv6len
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+		}
+		proxies = append(proxies, ipNet)
+	}
+	return proxies, nil
+}
+
+// Contains 判断地址是否属于受信任的代理
+func (p TrustedProxies) Contains(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range p {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetTrustedProxies 设置受信任的前置代理
+func (f *Forwarder) SetTrustedProxies(proxies TrustedProxies) {
+	f.headerMu.Lock()
+	defer f.headerMu.Unlock()
+	f.trustedProxies = proxies
+}
+
+// outgoingHeaders 生成发往后端的请求头：去掉逐跳 Header，设置 X-Forwarded-* 和 Forwarded
+// 多值 Header 原样保留；gRPC 需要的 TE: trailers 单独保留，upgrade 为 true 时保留协议升级的 Upgrade
+func (f *Forwarder) outgoingHeaders(opts *ForwardOptions, upgrade bool) http.Header {
+	headers := opts.Headers.Clone()
+	if headers == nil {
+		headers = make(http.Header)
+	}
+	trailers := headerContainsToken(opts.Headers, "Te", "trailers")
+	protocol := ""
+	if upgrade && headerContainsToken(opts.Headers, "Connection", "upgrade") {
+		protocol = opts.Headers.Get("Upgrade")
+	}
+
+	RemoveHopHeaders(headers)
+	if trailers {
+		headers.Set("Te", "trailers")
+	}
+	if protocol != "" {
+		headers.Set("Connection", "Upgrade")
+		headers.Set("Upgrade", protocol)
+	}
+
+	if opts.Request != nil {
+		f.headerMu.RLock()
+		trusted := f.trustedProxies
+		f.headerMu.RUnlock()
+		setForwardedHeaders(headers, opts.Request, trusted)
+	}
+	return headers
+}
+
+// setForwardedHeaders 追加本跳的转发信息
+// 直接连接网关的地址是受信任代理时，在其携带的 X-Forwarded-For 和 Forwarded 后追加，
+// 并沿用其 X-Forwarded-Proto 和 X-Forwarded-Host；否则丢弃客户端伪造的值，重新生成
+func setForwardedHeaders(h http.Header, r *http.Request, trusted TrustedProxies) {
+	peer := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(peer); err == nil {
+		peer = host
+	}
+	proto := "http"
+	if r.TLS != nil {
+		proto = "https"
+	}
+
+	if !trusted.Contains(peer) {
+		for _, name := range []string{"X-Forwarded-For", "X-Forwarded-Proto", "X-Forwarded-Host", "Forwarded"} {
+			h.Del(name)
+		}
+	}
+
+	if peer != "" {
+		if prior := h.Values("X-Forwarded-For"); len(prior) > 0 {
+			peer = strings.Join(prior, ", ") + ", " + peer
+		}
+		h.Set("X-Forwarded-For", peer)
+	}
+	if h.Get("X-Forwarded-Proto") == "" {
+		h.Set("X-Forwarded-Proto", proto)
+	}
+	if h.Get("X-Forwarded-Host") == "" && r.Host != "" {
+		h.Set("X-Forwarded-Host", r.Host)
+	}
+
+	element := forwardedElement(r, proto)
+	if prior := h.Values("Forwarded"); len(prior) > 0 {
+		element = strings.Join(prior, ", ") + ", " + element
+	}
+	h.Set("Forwarded", element)
+}
+
+// forwardedElement 按 RFC 7239 生成本跳的 Forwarded 元素，如 for=192.0.2.1;host=example.com;proto=https
+func forwardedElement(r *http.Request, proto string) string {
+	var pairs []string
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		if strings.Contains(host, ":") {
+			// IPv6 地址需要加方括号和引号
+			host = "[" + host + "]"
+		}
+		pairs = append(pairs, "for="+forwardedValue(host))
+	}
+	if r.Host != "" {
+		pairs = append(pairs, "host="+forwardedValue(r.Host))
+	}
+	pairs = append(pairs, "proto="+proto)
+	return strings.Join(pairs, ";")
+}
+
+// forwardedValue 值不是合法 token 时使用 quoted-string
+func forwardedValue(v string) string {
+	for i := 0; i < len(v); i++ {
+		c := v[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0) {
+			return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v) + `"`
+		}
+	}
+	return v
+}
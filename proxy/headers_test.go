@@ -0,0 +1,131 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestForwardStripsHopHeaders(t *testing.T) {
+	var received http.Header
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+	}))
+	defer backend.Close()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Connection", "keep-alive, X-Session-Hop")
+	req.Header.Set("Keep-Alive", "timeout=5")
+	req.Header.Set("X-Session-Hop", "1")
+	req.Header.Set("Proxy-Authorization", "Basic abc")
+	req.Header.Set("Te", "trailers, deflate")
+	req.Header.Add("Accept", "text/html")
+	req.Header.Add("Accept", "application/json")
+
+	f := NewForwarder(backend.URL)
+	if _, _, err := f.Forward(req, nil); err != nil {
+		t.Fatalf("Forward failed: %v", err)
+	}
+	for _, name := range []string{"Keep-Alive", "X-Session-Hop", "Proxy-Authorization"} {
+		if v := received.Get(name); v != "" {
+			t.Errorf("Hop-by-hop header %s should be stripped, got %q", name, v)
+		}
+	}
+	if received.Get("Te") != "trailers" {
+		t.Errorf("TE: trailers should be kept, got %q", received.Get("Te"))
+	}
+	if accept := received.Values("Accept"); len(accept) != 2 {
+		t.Errorf("Multi-value header should be preserved, got %v", accept)
+	}
+	if req.Header.Get("Keep-Alive") == "" {
+		t.Error("Client request headers should not be modified")
+	}
+}
+
+func TestForwardedHeaders(t *testing.T) {
+	var received http.Header
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+	}))
+	defer backend.Close()
+
+	trusted, err := ParseTrustedProxies([]string{"10.0.0.0/8", "::1"})
+	if err != nil {
+		t.Fatalf("ParseTrustedProxies failed: %v", err)
+	}
+	f := NewForwarder(backend.URL)
+	f.SetTrustedProxies(trusted)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		expected   map[string]string
+	}{
+		{
+			name:       "untrusted client spoofing headers",
+			remoteAddr: "203.0.113.7:5000",
+			headers:    map[string]string{"X-Forwarded-For": "1.2.3.4", "X-Forwarded-Proto": "https", "Forwarded": "for=1.2.3.4"},
+			expected: map[string]string{
+				"X-Forwarded-For":   "203.0.113.7",
+				"X-Forwarded-Proto": "http",
+				"X-Forwarded-Host":  "api.example.com",
+				"Forwarded":         "for=203.0.113.7;host=api.example.com;proto=http",
+			},
+		},
+		{
+			name:       "trusted proxy",
+			remoteAddr: "10.1.2.3:5000",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.1", "X-Forwarded-Proto": "https", "X-Forwarded-Host": "www.example.com", "Forwarded": "for=198.51.100.1;proto=https"},
+			expected: map[string]string{
+				"X-Forwarded-For":   "198.51.100.1, 10.1.2.3",
+				"X-Forwarded-Proto": "https",
+				"X-Forwarded-Host":  "www.example.com",
+				"Forwarded":         "for=198.51.100.1;proto=https, for=10.1.2.3;host=api.example.com;proto=http",
+			},
+		},
+		{
+			name:       "ipv6 trusted proxy",
+			remoteAddr: "[::1]:5000",
+			expected: map[string]string{
+				"X-Forwarded-For": "::1",
+				"Forwarded":       `for="[::1]";host=api.example.com;proto=http`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "http://api.example.com/", nil)
+		req.RemoteAddr = tt.remoteAddr
+		for k, v := range tt.headers {
+			req.Header.Set(k, v)
+		}
+		if _, _, err := f.Forward(req, nil); err != nil {
+			t.Fatalf("%s: Forward failed: %v", tt.name, err)
+		}
+		for k, v := range tt.expected {
+			if got := received.Get(k); got != v {
+				t.Errorf("%s: %s = %q, want %q", tt.name, k, got, v)
+			}
+		}
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	if _, err := ParseTrustedProxies([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("Invalid CIDR should be rejected")
+	}
+	if _, err := ParseTrustedProxies([]string{"proxy.local"}); err == nil {
+		t.Error("Hostnames should be rejected")
+	}
+
+	trusted, err := ParseTrustedProxies([]string{"192.168.0.0/16", "172.16.0.1"})
+	if err != nil {
+		t.Fatalf("ParseTrustedProxies failed: %v", err)
+	}
+	for addr, want := range map[string]bool{"192.168.5.5": true, "172.16.0.1": true, "172.16.0.2": false, "": false} {
+		if got := trusted.Contains(addr); got != want {
+			t.Errorf("Contains(%q) = %v, want %v", addr, got, want)
+		}
+	}
+}
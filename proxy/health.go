@@ -0,0 +1,207 @@
+package proxy
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ruke318/gateway/config"
+)
+
+// 健康检查默认值
+const (
+	defaultCheckInterval      = 10 * time.Second
+	defaultCheckTimeout       = 2 * time.Second
+	defaultHealthyThreshold   = 2
+	defaultUnhealthyThreshold = 3
+	defaultMaxFailures        = 5
+	defaultEjectDuration      = 30 * time.Second
+)
+
+// targetHealth 记录节点的健康状态
+// healthy 由主动检查维护；ejectedUntil 由被动检查维护，到期后节点自动恢复
+type targetHealth struct {
+	healthy         int32 // 1 表示健康
+	ejectedUntil    int64 // UnixNano
+	passiveFailures int32
+
+	// 以下字段只在主动检查的 goroutine 中读写
+	activeSuccesses int
+	activeFailures  int
+}
+
+// Available 判断节点当前是否可以接收流量
+func (t *Target) Available() bool {
+	if atomic.LoadInt32(&t.health.healthy) == 0 {
+		return false
+	}
+	return time.Now().UnixNano() >= atomic.LoadInt64(&t.health.ejectedUntil)
+}
+
+// report 根据一次真实请求的结果更新被动健康状态
+func (u *Upstream) report(t *Target, err error, status int) {
+	passive := u.passiveCheck()
+	if passive == nil {
+		return
+	}
+
+	if err == nil && status < http.StatusInternalServerError {
+		atomic.StoreInt32(&t.health.passiveFailures, 0)
+		return
+	}
+
+	maxFailures := passive.MaxFailures
+	if maxFailures <= 0 {
+		maxFailures = defaultMaxFailures
+	}
+	if atomic.AddInt32(&t.health.passiveFailures, 1) >= int32(maxFailures) {
+		atomic.StoreInt32(&t.health.passiveFailures, 0)
+		until := time.Now().Add(passive.EjectDuration.Or(defaultEjectDuration))
+		atomic.StoreInt64(&t.health.ejectedUntil, until.UnixNano())
+		log.Printf("[upstream %s] target %s ejected until %s after %d consecutive failures", u.Name, t.URL, until.Format(time.RFC3339), maxFailures)
+	}
+}
+
+func (u *Upstream) passiveCheck() *config.PassiveHealthCheck {
+	if u.healthCheck == nil {
+		return nil
+	}
+	return u.healthCheck.Passive
+}
+
+// startActiveCheck 启动主动健康检查，直到 Close 被调用
+func (u *Upstream) startActiveCheck(active *config.ActiveHealthCheck) {
+	client := &http.Client{Timeout: active.Timeout.Or(defaultCheckTimeout)}
+	ticker := time.NewTicker(active.Interval.Or(defaultCheckInterval))
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			u.checkTargets(client, active)
+			select {
+			case <-ticker.C:
+			case <-u.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (u *Upstream) checkTargets(client *http.Client, active *config.ActiveHealthCheck) {
+	var wg sync.WaitGroup
+	for _, t := range u.targets {
+		wg.Add(1)
+		go func(t *Target) {
+			defer wg.Done()
+			u.applyCheckResult(t, active, probe(client, t.URL, active))
+		}(t)
+	}
+	wg.Wait()
+}
+
+func (u *Upstream) applyCheckResult(t *Target, active *config.ActiveHealthCheck, ok bool) {
+	healthyThreshold := active.HealthyThreshold
+	if healthyThreshold <= 0 {
+		healthyThreshold = defaultHealthyThreshold
+	}
+	unhealthyThreshold := active.UnhealthyThreshold
+	if unhealthyThreshold <= 0 {
+		unhealthyThreshold = defaultUnhealthyThreshold
+	}
+
+	h := &t.health
+	if ok {
+		h.activeFailures = 0
+		h.activeSuccesses++
+		if h.activeSuccesses >= healthyThreshold && atomic.CompareAndSwapInt32(&h.healthy, 0, 1) {
+			log.Printf("[upstream %s] target %s is healthy again", u.Name, t.URL)
+		}
+		return
+	}
+
+	h.activeSuccesses = 0
+	h.activeFailures++
+	if h.activeFailures >= unhealthyThreshold && atomic.CompareAndSwapInt32(&h.healthy, 1, 0) {
+		log.Printf("[upstream %s] target %s marked unhealthy after %d failed checks", u.Name, t.URL, h.activeFailures)
+	}
+}
+
+// probe 请求一次健康检查接口
+func probe(client *http.Client, targetURL string, active *config.ActiveHealthCheck) bool {
+	path := active.Path
+	if path == "" {
+		path = "/"
+	}
+	resp, err := client.Get(strings.TrimSuffix(targetURL, "/") + path)
+	if err != nil {
+		return false
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	if len(active.ExpectedStatus) == 0 {
+		return resp.StatusCode >= 200 && resp.StatusCode < 400
+	}
+	for _, status := range active.ExpectedStatus {
+		if resp.StatusCode == status {
+			return true
+		}
+	}
+	return false
+}
+
+// Close 停止上游组的主动健康检查
+func (u *Upstream) Close() {
+	u.closeOnce.Do(func() {
+		close(u.stop)
+	})
+}
+
+// TargetStatus 是节点的健康状态快照
+type TargetStatus struct {
+	URL                 string     `json:"url"`
+	Weight              int        `json:"weight"`
+	Available           bool       `json:"available"`
+	Healthy             bool       `json:"healthy"`                // 主动检查结果
+	EjectedUntil        *time.Time `json:"ejectedUntil,omitempty"` // 被动摘除的截止时间
+	ConsecutiveFailures int32      `json:"consecutiveFailures"`    // 被动检查累计的连续失败次数
+	ActiveRequests      int64      `json:"activeRequests"`
+}
+
+// UpstreamStatus 是上游组的状态快照
+type UpstreamStatus struct {
+	Name     string         `json:"name"`
+	Inline   bool           `json:"inline"` // 是否为路由内联上游组（Name 为路由 Key）
+	Strategy string         `json:"strategy"`
+	Targets  []TargetStatus `json:"targets"`
+}
+
+// Status 返回上游组及其节点的当前状态
+func (u *Upstream) Status() UpstreamStatus {
+	strategy := u.strategy
+	if strategy == "" {
+		strategy = StrategyRoundRobin
+	}
+	status := UpstreamStatus{Name: u.Name, Strategy: strategy}
+
+	now := time.Now()
+	for _, t := range u.targets {
+		ts := TargetStatus{
+			URL:                 t.URL,
+			Weight:              t.Weight,
+			Available:           t.Available(),
+			Healthy:             atomic.LoadInt32(&t.health.healthy) == 1,
+			ConsecutiveFailures: atomic.LoadInt32(&t.health.passiveFailures),
+			ActiveRequests:      t.ActiveRequests(),
+		}
+		if until := time.Unix(0, atomic.LoadInt64(&t.health.ejectedUntil)); until.After(now) {
+			ts.EjectedUntil = &until
+		}
+		status.Targets = append(status.Targets, ts)
+	}
+	return status
+}
@@ -0,0 +1,174 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ruke318/gateway/config"
+)
+
+func TestActiveHealthCheck(t *testing.T) {
+	var healthy int32 = 1
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" && atomic.LoadInt32(&healthy) == 1 {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer backend.Close()
+
+	u, err := NewUpstream("test", []config.UpstreamTarget{{URL: backend.URL}}, config.LoadBalanceConfig{}, &config.HealthCheckConfig{
+		Active: &config.ActiveHealthCheck{
+			Path:               "/health",
+			Interval:           config.Duration(10 * time.Millisecond),
+			HealthyThreshold:   1,
+			UnhealthyThreshold: 1,
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewUpstream failed: %v", err)
+	}
+	defer u.Close()
+
+	atomic.StoreInt32(&healthy, 0)
+	waitFor(t, func() bool { return !u.Targets()[0].Available() })
+	if _, err := u.Select(nil); err == nil {
+		t.Error("Expected no available target while unhealthy")
+	}
+
+	atomic.StoreInt32(&healthy, 1)
+	waitFor(t, func() bool { return u.Targets()[0].Available() })
+}
+
+func TestPassiveHealthCheck(t *testing.T) {
+	u, err := NewUpstream("test", []config.UpstreamTarget{{URL: "a"}, {URL: "b"}}, config.LoadBalanceConfig{}, &config.HealthCheckConfig{
+		Passive: &config.PassiveHealthCheck{MaxFailures: 2, EjectDuration: config.Duration(50 * time.Millisecond)},
+	})
+	if err != nil {
+		t.Fatalf("NewUpstream failed: %v", err)
+	}
+	defer u.Close()
+
+	bad := u.Targets()[0]
+	u.report(bad, nil, http.StatusBadGateway)
+	if !bad.Available() {
+		t.Fatal("Target should stay available below the failure threshold")
+	}
+	u.report(bad, nil, http.StatusBadGateway)
+	if bad.Available() {
+		t.Fatal("Target should be ejected after consecutive failures")
+	}
+
+	for i := 0; i < 5; i++ {
+		target, _ := u.Select(nil)
+		if target == bad {
+			t.Fatal("Ejected target should be skipped by the balancer")
+		}
+	}
+
+	waitFor(t, bad.Available)
+	if status := u.Status(); status.Targets[0].EjectedUntil != nil {
+		t.Errorf("Recovered target should not report ejection, got %v", status.Targets[0].EjectedUntil)
+	}
+}
+
+func TestPruneInlineUpstreams(t *testing.T) {
+	f := NewForwarder("http://localhost:9090")
+	orders := config.RouteConfig{Path: "/orders", Method: "GET", Upstreams: []config.UpstreamTarget{{URL: "http://orders:8080"}}}
+	users := config.RouteConfig{Path: "/users", Method: "GET", Upstreams: []config.UpstreamTarget{{URL: "http://users:8080"}}}
+	removed, err := f.ResolveUpstream(&orders)
+	if err != nil {
+		t.Fatalf("ResolveUpstream failed: %v", err)
+	}
+	kept, err := f.ResolveUpstream(&users)
+	if err != nil {
+		t.Fatalf("ResolveUpstream failed: %v", err)
+	}
+
+	// orders 改用命名上游组，users 保留
+	orders.Upstream = "orders"
+	f.PruneInlineUpstreams([]config.RouteConfig{orders, users})
+
+	statuses := f.UpstreamStatuses()
+	if len(statuses) != 1 || statuses[0].Name != users.Key() {
+		t.Fatalf("Expected only %s to remain, got %+v", users.Key(), statuses)
+	}
+	select {
+	case <-removed.stop:
+	default:
+		t.Error("Pruned upstream should be closed")
+	}
+	select {
+	case <-kept.stop:
+		t.Error("Remaining upstream should not be closed")
+	default:
+	}
+	if u, _ := f.ResolveUpstream(&users); u != kept {
+		t.Error("Remaining upstream should be reused")
+	}
+}
+
+func TestResolveUpstreamReuse(t *testing.T) {
+	f := NewForwarder("http://localhost:9090")
+	route := &config.RouteConfig{Path: "/orders", Method: "GET", Upstreams: []config.UpstreamTarget{{URL: "http://orders:8080"}}}
+
+	// 并发解析同一个路由快照得到同一个上游组
+	resolved := make([]*Upstream, 8)
+	var wg sync.WaitGroup
+	for i := range resolved {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resolved[i], _ = f.ResolveUpstream(route)
+		}(i)
+	}
+	wg.Wait()
+	for _, u := range resolved[1:] {
+		if u != resolved[0] {
+			t.Fatal("Concurrent lookups should share one upstream")
+		}
+	}
+
+	// 配置相同的新快照复用上游组，配置变化时重建并关闭旧的
+	snapshot := route.DeepCopy()
+	if u, _ := f.ResolveUpstream(&snapshot); u != resolved[0] {
+		t.Error("Unchanged config should reuse the upstream")
+	}
+	changed := route.DeepCopy()
+	changed.Upstreams = append(changed.Upstreams, config.UpstreamTarget{URL: "http://orders-2:8080"})
+	if u, _ := f.ResolveUpstream(&changed); u == resolved[0] {
+		t.Error("Changed config should rebuild the upstream")
+	}
+	select {
+	case <-resolved[0].stop:
+	default:
+		t.Error("Replaced upstream should be closed")
+	}
+}
+
+func BenchmarkResolveUpstream(b *testing.B) {
+	f := NewForwarder("http://localhost:9090")
+	route := &config.RouteConfig{Path: "/orders", Method: "GET", Upstreams: []config.UpstreamTarget{{URL: "http://orders:8080"}}}
+	f.ResolveUpstream(route)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			f.ResolveUpstream(route)
+		}
+	})
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met before timeout")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,114 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/ruke318/gateway/config"
+	"golang.org/x/net/http2"
+)
+
+// newTransport 按后端协议创建 Transport
+// 默认与 http.DefaultTransport 一致：https 后端通过 ALPN 协商 HTTP/2，http 后端使用 HTTP/1.1
+func newTransport(key transportTimeouts) http.RoundTripper {
+	dialer := &net.Dialer{
+		Timeout:   key.connect,
+		KeepAlive: 30 * time.Second,
+	}
+
+	switch key.protocol {
+	case config.ProtocolH2, config.ProtocolGRPC:
+		var rt http.RoundTripper = &http2SchemeTransport{
+			tls: &http2.Transport{
+				DialTLSContext: func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+					return dialTLS(ctx, dialer, network, addr, cfg, key.tlsHandshake)
+				},
+			},
+			// h2c：明文 HTTP/2，不经过 HTTP/1.1 升级，直接发送连接前言
+			plain: &http2.Transport{
+				AllowHTTP: true,
+				DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+					return dialer.DialContext(ctx, network, addr)
+				},
+			},
+		}
+		// 流式 RPC 的后端可能很晚才返回响应头，gRPC 不限制等待响应头的时间
+		if key.protocol == config.ProtocolH2 {
+			rt = &responseHeaderTimeout{next: rt, timeout: key.responseHeader}
+		}
+		return rt
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.TLSHandshakeTimeout = key.tlsHandshake
+	transport.ResponseHeaderTimeout = key.responseHeader
+	if key.protocol == config.ProtocolHTTP1 {
+		// TLSNextProto 为非 nil 的空 map 时不会协商 HTTP/2
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return transport
+}
+
+func dialTLS(ctx context.Context, dialer *net.Dialer, network, addr string, cfg *tls.Config, timeout time.Duration) (net.Conn, error) {
+	conn, err := dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	handshakeCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	tlsConn := tls.Client(conn, cfg)
+	if err := tlsConn.HandshakeContext(handshakeCtx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if proto := tlsConn.ConnectionState().NegotiatedProtocol; proto != http2.NextProtoTLS {
+		conn.Close()
+		return nil, fmt.Errorf("backend %s does not support HTTP/2 (negotiated %q)", addr, proto)
+	}
+	return tlsConn, nil
+}
+
+// http2SchemeTransport 按请求的 scheme 选择 HTTP/2 over TLS 或 h2c
+type http2SchemeTransport struct {
+	tls   *http2.Transport
+	plain *http2.Transport
+}
+
+func (t *http2SchemeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme == "http" {
+		return t.plain.RoundTrip(req)
+	}
+	return t.tls.RoundTrip(req)
+}
+
+// responseHeaderTimeout 为 http2.Transport 补充等待响应头的超时
+type responseHeaderTimeout struct {
+	next    http.RoundTripper
+	timeout time.Duration
+}
+
+func (t *responseHeaderTimeout) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithCancel(req.Context())
+	timer := time.AfterFunc(t.timeout, cancel)
+	resp, err := t.next.RoundTrip(req.WithContext(ctx))
+	if !timer.Stop() {
+		// 定时器已经触发，请求因等待响应头超时被取消
+		if err == nil {
+			resp.Body.Close()
+		}
+		cancel()
+		return nil, fmt.Errorf("timeout awaiting response headers: %w", context.DeadlineExceeded)
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &streamBody{ReadCloser: resp.Body, done: cancel}
+	return resp, nil
+}
@@ -0,0 +1,337 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ruke318/gateway/config"
+)
+
+const (
+	// 同时进行的镜像请求上限，超过时丢弃新的镜像请求，避免镜像上游变慢时占用过多资源
+	maxMirrorInflight = 256
+	// 保留的差异记录数
+	maxMirrorDiffs = 100
+	// 每条差异记录保存的响应体长度和差异项数量
+	maxMirrorDiffBody  = 1024
+	maxMirrorDiffItems = 20
+)
+
+// MirrorStats 路由的流量镜像统计
+type MirrorStats struct {
+	Route    string `json:"route"`
+	Sent     uint64 `json:"sent"`     // 发出的镜像请求
+	Dropped  uint64 `json:"dropped"`  // 进行中的镜像请求过多而丢弃的请求
+	Failed   uint64 `json:"failed"`   // 转发失败的镜像请求
+	Compared uint64 `json:"compared"` // 与主请求比较过的镜像请求
+	Diffs    uint64 `json:"diffs"`    // 比较结果不一致的请求
+}
+
+// MirrorDiff 一次主请求与镜像请求结果不一致的记录
+type MirrorDiff struct {
+	Time          time.Time `json:"time"`
+	Route         string    `json:"route"`
+	Method        string    `json:"method"`
+	Path          string    `json:"path"`
+	PrimaryStatus int       `json:"primaryStatus,omitempty"`
+	ShadowStatus  int       `json:"shadowStatus,omitempty"`
+	// Differences 不一致的地方，JSON 响应体按字段路径列出，如 "$.data.items[0].price"
+	Differences []string `json:"differences"`
+	PrimaryBody string   `json:"primaryBody,omitempty"`
+	ShadowBody  string   `json:"shadowBody,omitempty"`
+}
+
+type mirrorCounters struct {
+	sent, dropped, failed, compared, diffs uint64
+}
+
+// mirrorRecorder 记录流量镜像的统计和差异
+type mirrorRecorder struct {
+	inflight int64
+
+	mu       sync.Mutex
+	counters map[string]*mirrorCounters
+	diffs    []MirrorDiff // 按时间顺序，最多 maxMirrorDiffs 条
+}
+
+func (m *mirrorRecorder) route(key string) *mirrorCounters {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.counters == nil {
+		m.counters = make(map[string]*mirrorCounters)
+	}
+	c, ok := m.counters[key]
+	if !ok {
+		c = &mirrorCounters{}
+		m.counters[key] = c
+	}
+	return c
+}
+
+func (m *mirrorRecorder) record(diff MirrorDiff) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.diffs = append(m.diffs, diff)
+	if len(m.diffs) > maxMirrorDiffs {
+		m.diffs = append([]MirrorDiff(nil), m.diffs[len(m.diffs)-maxMirrorDiffs:]...)
+	}
+}
+
+// mirrorResult 主请求或镜像请求的结果
+type mirrorResult struct {
+	status int
+	body   []byte
+	err    error
+}
+
+// Mirror 按 cfg 的比例在后台把 opts 描述的请求发送到镜像上游 upstream（为 nil 时使用 cfg.BackendURL），丢弃镜像的响应
+// 镜像请求不重试、不经过熔断器和缓存，不随客户端断开而取消
+// 返回的函数在主请求结束后调用，开启 Diff 时用主请求的结果与镜像的响应比较；未发送镜像请求时返回的函数什么也不做
+func (f *Forwarder) Mirror(opts *ForwardOptions, upstream *Upstream, cfg *config.MirrorConfig) func(resp *http.Response, body []byte, err error) {
+	noop := func(*http.Response, []byte, error) {}
+	if cfg == nil || !cfg.Enabled || opts.BodyReader != nil {
+		return noop
+	}
+	if cfg.Percentage > 0 && cfg.Percentage < 100 && rand.Float64()*100 >= cfg.Percentage {
+		return noop
+	}
+
+	m := &f.mirrors
+	counters := m.route(opts.route())
+	if atomic.AddInt64(&m.inflight, 1) > maxMirrorInflight {
+		atomic.AddInt64(&m.inflight, -1)
+		atomic.AddUint64(&counters.dropped, 1)
+		return noop
+	}
+	atomic.AddUint64(&counters.sent, 1)
+
+	shadow := *opts
+	shadow.Upstream = upstream
+	shadow.BackendURL = cfg.BackendURL
+	shadow.Headers = opts.Headers.Clone()
+	shadow.RouteKey = ""
+	shadow.Retry = nil
+	shadow.CircuitBreaker = nil
+	shadow.Cache = nil
+	shadow.Coalesce = false
+	shadow.Variant = ""
+	shadow.OnRetry = nil
+	if opts.Request != nil {
+		shadow.Request = opts.Request.WithContext(context.Background())
+	}
+	if cfg.Timeout > 0 {
+		timeout := config.TimeoutConfig{}
+		if opts.Timeout != nil {
+			timeout = *opts.Timeout
+		}
+		timeout.Total = cfg.Timeout
+		shadow.Timeout = &timeout
+	}
+
+	primary := make(chan mirrorResult, 1)
+	go func() {
+		defer atomic.AddInt64(&m.inflight, -1)
+		resp, body, err := f.do(&shadow, false)
+		result := mirrorResult{body: body, err: err}
+		if err != nil {
+			atomic.AddUint64(&counters.failed, 1)
+			log.Printf("[mirror] %s %s: %v", opts.Method, opts.Path, err)
+		} else {
+			result.status = resp.StatusCode
+		}
+		if !cfg.Diff {
+			return
+		}
+
+		atomic.AddUint64(&counters.compared, 1)
+		p := <-primary
+		differences := mirrorDifferences(p, result)
+		if len(differences) == 0 {
+			return
+		}
+		atomic.AddUint64(&counters.diffs, 1)
+		m.record(MirrorDiff{
+			Time:          time.Now(),
+			Route:         opts.route(),
+			Method:        opts.Method,
+			Path:          opts.Path,
+			PrimaryStatus: p.status,
+			ShadowStatus:  result.status,
+			Differences:   differences,
+			PrimaryBody:   truncateBody(p.body),
+			ShadowBody:    truncateBody(result.body),
+		})
+	}()
+
+	return func(resp *http.Response, body []byte, err error) {
+		result := mirrorResult{body: body, err: err}
+		if resp != nil {
+			result.status = resp.StatusCode
+		}
+		primary <- result
+	}
+}
+
+// mirrorDifferences 比较主请求和镜像请求的结果，JSON 响应体按字段比较
+func mirrorDifferences(primary, shadow mirrorResult) []string {
+	var differences []string
+	if primary.err != nil || shadow.err != nil {
+		if primary.err != nil {
+			differences = append(differences, fmt.Sprintf("primary error: %v", primary.err))
+		}
+		if shadow.err != nil {
+			differences = append(differences, fmt.Sprintf("shadow error: %v", shadow.err))
+		}
+		return differences
+	}
+
+	if primary.status != shadow.status {
+		differences = append(differences, fmt.Sprintf("status: %d != %d", primary.status, shadow.status))
+	}
+	if bytes.Equal(primary.body, shadow.body) {
+		return differences
+	}
+	a, errA := decodeJSON(primary.body)
+	b, errB := decodeJSON(shadow.body)
+	if errA != nil || errB != nil {
+		return append(differences, "body differs")
+	}
+	diffJSON("$", a, b, &differences)
+	return differences
+}
+
+func decodeJSON(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// diffJSON 递归比较两个 JSON 值，把不一致的字段路径追加到 out，最多 maxMirrorDiffItems 项
+func diffJSON(path string, a, b interface{}, out *[]string) {
+	if len(*out) >= maxMirrorDiffItems {
+		return
+	}
+	switch av := a.(type) {
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(av)+len(bv))
+		for k := range av {
+			keys = append(keys, k)
+		}
+		for k := range bv {
+			if _, ok := av[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			x, inA := av[k]
+			y, inB := bv[k]
+			switch {
+			case !inB:
+				appendDiff(out, path+"."+k+": missing in shadow")
+			case !inA:
+				appendDiff(out, path+"."+k+": missing in primary")
+			default:
+				diffJSON(path+"."+k, x, y, out)
+			}
+		}
+		return
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok {
+			break
+		}
+		if len(av) != len(bv) {
+			appendDiff(out, fmt.Sprintf("%s: length %d != %d", path, len(av), len(bv)))
+			return
+		}
+		for i := range av {
+			diffJSON(fmt.Sprintf("%s[%d]", path, i), av[i], bv[i], out)
+		}
+		return
+	}
+	if !reflect.DeepEqual(a, b) {
+		appendDiff(out, path)
+	}
+}
+
+func appendDiff(out *[]string, diff string) {
+	if len(*out) < maxMirrorDiffItems {
+		*out = append(*out, diff)
+	}
+}
+
+func truncateBody(body []byte) string {
+	if len(body) > maxMirrorDiffBody {
+		return string(body[:maxMirrorDiffBody]) + "..."
+	}
+	return string(body)
+}
+
+// MirrorStats 返回各路由的流量镜像统计
+func (f *Forwarder) MirrorStats() []MirrorStats {
+	m := &f.mirrors
+	m.mu.Lock()
+	stats := make([]MirrorStats, 0, len(m.counters))
+	for route, c := range m.counters {
+		stats = append(stats, MirrorStats{
+			Route:    route,
+			Sent:     atomic.LoadUint64(&c.sent),
+			Dropped:  atomic.LoadUint64(&c.dropped),
+			Failed:   atomic.LoadUint64(&c.failed),
+			Compared: atomic.LoadUint64(&c.compared),
+			Diffs:    atomic.LoadUint64(&c.diffs),
+		})
+	}
+	m.mu.Unlock()
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Route < stats[j].Route })
+	return stats
+}
+
+// MirrorDiffs 返回最近的差异记录，最新的在前；route 不为空时只返回该路由的记录
+func (f *Forwarder) MirrorDiffs(route string) []MirrorDiff {
+	m := &f.mirrors
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	diffs := make([]MirrorDiff, 0, len(m.diffs))
+	for i := len(m.diffs) - 1; i >= 0; i-- {
+		if route == "" || m.diffs[i].Route == route {
+			diffs = append(diffs, m.diffs[i])
+		}
+	}
+	return diffs
+}
+
+// ClearMirrorDiffs 删除差异记录，route 为空时删除全部，返回删除的数量
+func (f *Forwarder) ClearMirrorDiffs(route string) int {
+	m := &f.mirrors
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	kept := m.diffs[:0]
+	for _, diff := range m.diffs {
+		if route != "" && diff.Route != route {
+			kept = append(kept, diff)
+		}
+	}
+	cleared := len(m.diffs) - len(kept)
+	m.diffs = kept
+	return cleared
+}
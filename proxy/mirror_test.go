@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ruke318/gateway/config"
+)
+
+func waitMirror(t *testing.T, f *Forwarder, done func(s MirrorStats) bool) MirrorStats {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if stats := f.MirrorStats(); len(stats) == 1 && done(stats[0]) {
+			return stats[0]
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Mirror did not finish: %+v", f.MirrorStats())
+	return MirrorStats{}
+}
+
+func TestMirrorDoesNotDelayPrimary(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":1}`))
+	}))
+	defer primary.Close()
+	var shadowBody atomic.Value
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		buf := make([]byte, 64)
+		n, _ := r.Body.Read(buf)
+		shadowBody.Store(string(buf[:n]))
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer shadow.Close()
+
+	f := NewForwarder(primary.URL)
+	opts := &ForwardOptions{Method: http.MethodPost, Path: "/items", Body: []byte(`{"name":"a"}`), Headers: http.Header{}, RouteKey: "POST /items"}
+	mirrored := f.Mirror(opts, nil, &config.MirrorConfig{Enabled: true, BackendURL: shadow.URL})
+
+	start := time.Now()
+	resp, body, err := f.Do(opts)
+	mirrored(resp, body, err)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Primary request failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+		t.Errorf("Mirror should not delay the primary request, took %v", elapsed)
+	}
+
+	stats := waitMirror(t, f, func(s MirrorStats) bool { return shadowBody.Load() != nil })
+	if shadowBody.Load() != `{"name":"a"}` {
+		t.Errorf("Shadow should receive the request body, got %v", shadowBody.Load())
+	}
+	if stats.Sent != 1 || stats.Compared != 0 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestMirrorDiff(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":1,"items":[{"price":10}],"name":"a"}`))
+	}))
+	defer primary.Close()
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/same" {
+			w.Write([]byte(`{"name":"a", "id":1, "items":[{"price":10}]}`))
+			return
+		}
+		w.Write([]byte(`{"id":1,"items":[{"price":12}],"extra":true}`))
+	}))
+	defer shadow.Close()
+
+	f := NewForwarder(primary.URL)
+	cfg := &config.MirrorConfig{Enabled: true, BackendURL: shadow.URL, Diff: true}
+	for _, path := range []string{"/same", "/changed"} {
+		opts := &ForwardOptions{Method: http.MethodGet, Path: path, Headers: http.Header{}, RouteKey: "GET /items"}
+		mirrored := f.Mirror(opts, nil, cfg)
+		resp, body, err := f.Do(opts)
+		mirrored(resp, body, err)
+	}
+
+	stats := waitMirror(t, f, func(s MirrorStats) bool { return s.Compared == 2 && len(f.MirrorDiffs("")) == 1 })
+	if stats.Diffs != 1 {
+		t.Errorf("Expected only the changed response to differ, got %+v", stats)
+	}
+	diff := f.MirrorDiffs("GET /items")[0]
+	expected := []string{"$.extra: missing in primary", "$.items[0].price", "$.name: missing in shadow"}
+	if diff.Path != "/changed" || !reflect.DeepEqual(diff.Differences, expected) {
+		t.Errorf("Unexpected diff %+v", diff)
+	}
+
+	if n := f.ClearMirrorDiffs(""); n != 1 || len(f.MirrorDiffs("")) != 0 {
+		t.Errorf("Expected diffs to be cleared, got %d", n)
+	}
+}
+
+func TestMirrorSampling(t *testing.T) {
+	var calls int32
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	defer shadow.Close()
+
+	f := NewForwarder(shadow.URL)
+	cfg := &config.MirrorConfig{Enabled: true, BackendURL: shadow.URL, Percentage: 0.0001}
+	for i := 0; i < 100; i++ {
+		f.Mirror(&ForwardOptions{Method: http.MethodGet, Path: "/", Headers: http.Header{}}, nil, cfg)(nil, nil, nil)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt32(&calls); n > 1 {
+		t.Errorf("Expected almost no mirrored requests, got %d", n)
+	}
+}
@@ -0,0 +1,210 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ruke318/gateway/config"
+)
+
+// 重试原因，同时也是 retryOn 的可选值
+const (
+	RetryOnConnectFailure = "connect-failure"
+	RetryOnTimeout        = "timeout"
+	RetryOn5xx            = "5xx"
+)
+
+// 重试默认值
+const (
+	defaultRetryAttempts    = 3
+	defaultRetryBackoff     = 25 * time.Millisecond
+	defaultRetryMaxBackoff  = time.Second
+	defaultRetryBudgetRatio = 0.2
+	defaultRetryMinRetries  = 10
+	retryBudgetWindow       = 10 * time.Second
+)
+
+// 默认只重试幂等方法，避免重复提交
+var defaultRetryMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodOptions,
+	http.MethodPut, http.MethodDelete, http.MethodTrace,
+}
+
+// retryPolicy 是解析后的重试配置
+type retryPolicy struct {
+	attempts       int
+	connectFailure bool
+	timeout        bool
+	any5xx         bool
+	statuses       map[int]bool
+	methods        map[string]bool
+	backoff        time.Duration
+	maxBackoff     time.Duration
+}
+
+func newRetryPolicy(cfg *config.RetryConfig) *retryPolicy {
+	if cfg == nil {
+		return nil
+	}
+
+	p := &retryPolicy{
+		attempts:   cfg.Attempts,
+		statuses:   make(map[int]bool),
+		methods:    make(map[string]bool),
+		backoff:    cfg.Backoff.Or(defaultRetryBackoff),
+		maxBackoff: cfg.MaxBackoff.Or(defaultRetryMaxBackoff),
+	}
+	if p.attempts <= 0 {
+		p.attempts = defaultRetryAttempts
+	}
+
+	retryOn := cfg.RetryOn
+	if len(retryOn) == 0 {
+		retryOn = []string{RetryOnConnectFailure, RetryOnTimeout}
+	}
+	for _, cond := range retryOn {
+		switch cond = strings.ToLower(strings.TrimSpace(cond)); cond {
+		case RetryOnConnectFailure:
+			p.connectFailure = true
+		case RetryOnTimeout:
+			p.timeout = true
+		case RetryOn5xx:
+			p.any5xx = true
+		default:
+			if status, err := strconv.Atoi(cond); err == nil {
+				p.statuses[status] = true
+			}
+		}
+	}
+
+	methods := cfg.Methods
+	if len(methods) == 0 {
+		methods = defaultRetryMethods
+	}
+	for _, method := range methods {
+		p.methods[strings.ToUpper(method)] = true
+	}
+	return p
+}
+
+// reason 判断一次尝试的结果是否需要重试，返回重试原因
+func (p *retryPolicy) reason(resp *http.Response, err error) (string, bool) {
+	if err != nil {
+		if errors.Is(err, ErrNoAvailableTarget) || errors.Is(err, ErrResponseTooLarge) {
+			return "", false
+		}
+		if IsTimeout(err) {
+			return RetryOnTimeout, p.timeout
+		}
+		return RetryOnConnectFailure, p.connectFailure
+	}
+	if p.statuses[resp.StatusCode] {
+		return strconv.Itoa(resp.StatusCode), true
+	}
+	if p.any5xx && resp.StatusCode >= http.StatusInternalServerError {
+		return strconv.Itoa(resp.StatusCode), true
+	}
+	return "", false
+}
+
+// delay 返回第 retry 次重试前的等待时间：指数退避加全抖动
+func (p *retryPolicy) delay(retry int) time.Duration {
+	d := p.backoff
+	for i := 1; i < retry && d < p.maxBackoff; i++ {
+		d *= 2
+	}
+	if d > p.maxBackoff {
+		d = p.maxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+// retryBudget 限制一个窗口内的重试比例，防止后端故障时重试把流量放大
+type retryBudget struct {
+	mu          sync.Mutex
+	windowStart time.Time
+	requests    int
+	retries     int
+}
+
+// request 记录一次新请求
+func (b *retryBudget) request() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rotate()
+	b.requests++
+}
+
+// allow 判断预算是否允许再重试一次，允许时计入重试次数
+func (b *retryBudget) allow(cfg *config.RetryConfig) bool {
+	ratio := cfg.BudgetRatio
+	if ratio <= 0 {
+		ratio = defaultRetryBudgetRatio
+	}
+	minRetries := cfg.MinRetries
+	if minRetries <= 0 {
+		minRetries = defaultRetryMinRetries
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rotate()
+	if b.retries >= minRetries && float64(b.retries) >= ratio*float64(b.requests) {
+		return false
+	}
+	b.retries++
+	return true
+}
+
+func (b *retryBudget) rotate() {
+	now := time.Now()
+	if now.Sub(b.windowStart) >= retryBudgetWindow {
+		b.windowStart = now
+		b.requests = 0
+		b.retries = 0
+	}
+}
+
+// retryBudgets 按路由 Key 维护重试预算
+type retryBudgets struct {
+	mu      sync.Mutex
+	budgets map[string]*retryBudget
+}
+
+func (r *retryBudgets) get(key string) *retryBudget {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.budgets == nil {
+		r.budgets = make(map[string]*retryBudget)
+	}
+	b, ok := r.budgets[key]
+	if !ok {
+		b = &retryBudget{}
+		r.budgets[key] = b
+	}
+	return b
+}
+
+// sleepContext 等待 d，ctx 结束时提前返回 false
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,179 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ruke318/gateway/config"
+)
+
+func TestRetryOnStatusSelectsNextTarget(t *testing.T) {
+	var badHits, goodHits int32
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&badHits, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer bad.Close()
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&goodHits, 1)
+		w.Write([]byte("ok"))
+	}))
+	defer good.Close()
+
+	u, err := NewUpstream("test", []config.UpstreamTarget{{URL: bad.URL}, {URL: good.URL}}, config.LoadBalanceConfig{}, nil)
+	if err != nil {
+		t.Fatalf("NewUpstream failed: %v", err)
+	}
+	defer u.Close()
+
+	var reasons []string
+	f := NewForwarder("")
+	resp, body, err := f.Do(&ForwardOptions{
+		Method:   http.MethodGet,
+		Path:     "/",
+		Upstream: u,
+		Retry:    &config.RetryConfig{RetryOn: []string{"503"}, Backoff: config.Duration(time.Millisecond)},
+		RouteKey: "test",
+		OnRetry: func(attempt int, reason string) error {
+			reasons = append(reasons, reason)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("Do failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || string(body) != "ok" {
+		t.Errorf("Expected retry to reach healthy target, got %d %q", resp.StatusCode, body)
+	}
+	if badHits != 1 || goodHits != 1 {
+		t.Errorf("Expected one attempt per target, got bad=%d good=%d", badHits, goodHits)
+	}
+	if len(reasons) != 1 || reasons[0] != "503" {
+		t.Errorf("Expected one retry for 503, got %v", reasons)
+	}
+}
+
+func TestRetryConnectFailure(t *testing.T) {
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	var attempts int
+	f := NewForwarder("")
+	_, _, err := f.Do(&ForwardOptions{
+		Method:     http.MethodGet,
+		BackendURL: closed.URL,
+		Path:       "/",
+		Retry:      &config.RetryConfig{Attempts: 3, Backoff: config.Duration(time.Millisecond)},
+		RouteKey:   "test",
+		OnRetry: func(attempt int, reason string) error {
+			attempts = attempt
+			if reason != RetryOnConnectFailure {
+				t.Errorf("Expected connect-failure, got %s", reason)
+			}
+			return nil
+		},
+	})
+	if err == nil {
+		t.Fatal("Expected error from closed backend")
+	}
+	if attempts != 3 {
+		t.Errorf("Expected retries up to attempt 3, got %d", attempts)
+	}
+}
+
+func TestRetrySkipsNonIdempotentMethods(t *testing.T) {
+	var hits int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer backend.Close()
+
+	f := NewForwarder("")
+	retry := &config.RetryConfig{RetryOn: []string{RetryOn5xx}, Backoff: config.Duration(time.Millisecond)}
+	f.Do(&ForwardOptions{Method: http.MethodPost, BackendURL: backend.URL, Path: "/", Retry: retry, RouteKey: "test"})
+	if hits != 1 {
+		t.Errorf("POST should not be retried by default, got %d attempts", hits)
+	}
+
+	atomic.StoreInt32(&hits, 0)
+	retry.Methods = []string{"post"}
+	f.Do(&ForwardOptions{Method: http.MethodPost, BackendURL: backend.URL, Path: "/", Retry: retry, RouteKey: "test"})
+	if hits != defaultRetryAttempts {
+		t.Errorf("Expected %d attempts when POST is allowed, got %d", defaultRetryAttempts, hits)
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	var hits int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer backend.Close()
+
+	f := NewForwarder("")
+	retry := &config.RetryConfig{
+		Attempts:    2,
+		RetryOn:     []string{RetryOn5xx},
+		Backoff:     config.Duration(time.Millisecond),
+		BudgetRatio: 0.01,
+		MinRetries:  1,
+	}
+	for i := 0; i < 3; i++ {
+		f.Do(&ForwardOptions{Method: http.MethodGet, BackendURL: backend.URL, Path: "/", Retry: retry, RouteKey: "test"})
+	}
+	// 第一个请求消耗唯一的重试预算，之后的请求不再重试
+	if hits != 4 {
+		t.Errorf("Expected 4 attempts with an exhausted budget, got %d", hits)
+	}
+}
+
+func TestRetryCancelledByHook(t *testing.T) {
+	var hits int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer backend.Close()
+
+	f := NewForwarder("")
+	resp, _, err := f.Do(&ForwardOptions{
+		Method:     http.MethodGet,
+		BackendURL: backend.URL,
+		Path:       "/",
+		Retry:      &config.RetryConfig{RetryOn: []string{RetryOn5xx}},
+		RouteKey:   "test",
+		OnRetry: func(attempt int, reason string) error {
+			return errors.New("stop")
+		},
+	})
+	if err != nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("Expected last response to be returned, got %v %v", resp, err)
+	}
+	if hits != 1 {
+		t.Errorf("Expected hook to cancel the retry, got %d attempts", hits)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := newRetryPolicy(&config.RetryConfig{
+		Backoff:    config.Duration(10 * time.Millisecond),
+		MaxBackoff: config.Duration(40 * time.Millisecond),
+	})
+	for retry := 1; retry <= 6; retry++ {
+		limit := 10 * time.Millisecond << (retry - 1)
+		if limit > 40*time.Millisecond {
+			limit = 40 * time.Millisecond
+		}
+		for i := 0; i < 100; i++ {
+			if d := p.delay(retry); d < 0 || d > limit {
+				t.Fatalf("delay(%d) = %s, expected within [0, %s]", retry, d, limit)
+			}
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package proxy
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// ErrEventTooLarge SSE 事件超过大小上限，流无法继续按事件解析
+var ErrEventTooLarge = errors.New("sse event too large")
+
+// 单个 SSE 事件的默认大小上限
+const defaultMaxEventSize = 1 << 20
+
+// IsEventStream 判断响应是否为 SSE（text/event-stream）
+func IsEventStream(h http.Header) bool {
+	mediaType, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	return err == nil && mediaType == "text/event-stream"
+}
+
+// Event 是 SSE 中以空行结束的一个事件，保留原始的字段行（含注释）及其顺序
+type Event struct {
+	lines []string
+}
+
+// field 返回第一个名为 name 的字段值，按规范去掉冒号后的一个空格
+func (e *Event) field(name string) (string, bool) {
+	for _, line := range e.lines {
+		if value, ok := fieldValue(line, name); ok {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+func fieldValue(line, name string) (string, bool) {
+	if line == name {
+		return "", true
+	}
+	if !strings.HasPrefix(line, name+":") {
+		return "", false
+	}
+	return strings.TrimPrefix(line[len(name)+1:], " "), true
+}
+
+// Name 返回 event 字段，未设置时为空
+func (e *Event) Name() string {
+	name, _ := e.field("event")
+	return name
+}
+
+// ID 返回 id 字段，未设置时为空
+func (e *Event) ID() string {
+	id, _ := e.field("id")
+	return id
+}
+
+// Data 返回所有 data 行以换行连接后的内容，没有 data 字段时 ok 为 false
+func (e *Event) Data() (data string, ok bool) {
+	var parts []string
+	for _, line := range e.lines {
+		if value, found := fieldValue(line, "data"); found {
+			parts = append(parts, value)
+		}
+	}
+	return strings.Join(parts, "\n"), len(parts) > 0
+}
+
+// SetData 替换事件的数据，新数据写在原来第一个 data 行的位置，多行数据拆成多个 data 行
+func (e *Event) SetData(data string) {
+	var lines []string
+	replaced := false
+	for _, line := range e.lines {
+		if _, found := fieldValue(line, "data"); !found {
+			lines = append(lines, line)
+			continue
+		}
+		if !replaced {
+			for _, part := range strings.Split(data, "\n") {
+				lines = append(lines, "data: "+part)
+			}
+			replaced = true
+		}
+	}
+	e.lines = lines
+}
+
+// WriteTo 按 SSE 格式写出事件，末尾带空行
+func (e *Event) WriteTo(w io.Writer) (int64, error) {
+	var sb strings.Builder
+	for _, line := range e.lines {
+		sb.WriteString(line)
+		sb.WriteByte('\n')
+	}
+	sb.WriteByte('\n')
+	n, err := io.WriteString(w, sb.String())
+	return int64(n), err
+}
+
+// EventReader 从 SSE 响应体中逐个读取事件
+type EventReader struct {
+	r   *bufio.Reader
+	max int
+}
+
+// NewEventReader 使用默认的事件大小上限（1MB）
+func NewEventReader(r io.Reader) *EventReader {
+	return NewEventReaderSize(r, defaultMaxEventSize)
+}
+
+// NewEventReaderSize 创建单个事件（所有行合计）不超过 max 字节的 EventReader，max 不大于 0 时使用默认值
+// 后端不发送空行或换行时，超过上限的事件返回 ErrEventTooLarge，避免无限缓存
+func NewEventReaderSize(r io.Reader, max int64) *EventReader {
+	if max <= 0 {
+		max = defaultMaxEventSize
+	}
+	return &EventReader{r: bufio.NewReader(r), max: int(max)}
+}
+
+// Next 读取下一个事件，流结束时返回 io.EOF；流在事件中途结束时先返回已读到的部分
+// 事件超过大小上限时返回 ErrEventTooLarge，之后不能再继续读取
+func (r *EventReader) Next() (*Event, error) {
+	event := &Event{}
+	size := 0
+	for {
+		line, err := r.readLine(r.max - size)
+		if err == ErrEventTooLarge {
+			return nil, fmt.Errorf("%w: exceeds %d bytes", ErrEventTooLarge, r.max)
+		}
+		size += len(line)
+		line = strings.TrimRight(line, "\r\n")
+		if line != "" {
+			event.lines = append(event.lines, line)
+		} else if err == nil && len(event.lines) > 0 {
+			return event, nil
+		}
+		if err != nil {
+			if len(event.lines) > 0 && err == io.EOF {
+				return event, nil
+			}
+			return nil, err
+		}
+	}
+}
+
+// readLine 读取一行（含换行符），超过 limit 字节时返回 ErrEventTooLarge
+func (r *EventReader) readLine(limit int) (string, error) {
+	var line []byte
+	for {
+		chunk, err := r.r.ReadSlice('\n')
+		if len(line)+len(chunk) > limit {
+			return "", ErrEventTooLarge
+		}
+		line = append(line, chunk...)
+		if err != bufio.ErrBufferFull {
+			return string(line), err
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ruke318/gateway/config"
+)
+
+func TestEventReader(t *testing.T) {
+	stream := ": keep-alive\n\n" +
+		"event: update\nid: 7\ndata: {\"a\":1}\n\n" +
+		"data: line1\r\ndata: line2\r\n\r\n" +
+		"data:partial"
+	reader := NewEventReader(strings.NewReader(stream))
+
+	var events []*Event
+	for {
+		event, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next failed: %v", err)
+		}
+		events = append(events, event)
+	}
+	if len(events) != 4 {
+		t.Fatalf("Expected 4 events, got %d", len(events))
+	}
+
+	if _, ok := events[0].Data(); ok {
+		t.Error("Comment event should have no data")
+	}
+	if data, _ := events[1].Data(); data != `{"a":1}` || events[1].Name() != "update" || events[1].ID() != "7" {
+		t.Errorf("Unexpected event fields: data %q name %q id %q", data, events[1].Name(), events[1].ID())
+	}
+	if data, _ := events[2].Data(); data != "line1\nline2" {
+		t.Errorf("Multi-line data should be joined, got %q", data)
+	}
+	if data, _ := events[3].Data(); data != "partial" {
+		t.Errorf("Unterminated event should be returned, got %q", data)
+	}
+
+	events[1].SetData(`{"b":2}`)
+	var buf bytes.Buffer
+	events[1].WriteTo(&buf)
+	if buf.String() != "event: update\nid: 7\ndata: {\"b\":2}\n\n" {
+		t.Errorf("Unexpected encoded event %q", buf.String())
+	}
+}
+
+func TestEventReaderMaxSize(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream string
+		err    bool
+	}{
+		{name: "within limit", stream: "data: " + strings.Repeat("a", 50) + "\n\n"},
+		{name: "long line", stream: "data: " + strings.Repeat("a", 100), err: true},
+		{name: "many lines", stream: strings.Repeat("data: a\n", 20) + "\n", err: true},
+	}
+	for _, tt := range tests {
+		_, err := NewEventReaderSize(strings.NewReader(tt.stream), 64).Next()
+		if tt.err != errors.Is(err, ErrEventTooLarge) {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		}
+	}
+
+	// 上限只作用于单个事件
+	reader := NewEventReaderSize(strings.NewReader(strings.Repeat("data: "+strings.Repeat("a", 40)+"\n\n", 10)), 64)
+	for i := 0; i < 10; i++ {
+		if _, err := reader.Next(); err != nil {
+			t.Fatalf("Event %d: %v", i, err)
+		}
+	}
+}
+
+func TestDoStreamIdleTimeout(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		// 持续发送事件的时间超过总超时，但间隔小于空闲超时
+		for i := 0; i < 5; i++ {
+			w.Write([]byte("data: tick\n\n"))
+			w.(http.Flusher).Flush()
+			time.Sleep(30 * time.Millisecond)
+		}
+		if r.URL.Path == "/hang" {
+			<-r.Context().Done()
+		}
+	}))
+	defer backend.Close()
+
+	f := NewForwarder(backend.URL)
+	stream := func(path string) (*http.Response, []byte, error) {
+		resp, err := f.DoStream(&ForwardOptions{
+			Method:      http.MethodGet,
+			Path:        path,
+			Timeout:     &config.TimeoutConfig{Total: config.Duration(50 * time.Millisecond)},
+			IdleTimeout: 100 * time.Millisecond,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return resp, body, err
+	}
+
+	resp, body, err := stream("/")
+	if err != nil {
+		t.Fatalf("Stream should not be limited by total timeout: %v", err)
+	}
+	if !IsEventStream(resp.Header) || strings.Count(string(body), "tick") != 5 {
+		t.Errorf("Expected 5 events, got %q", body)
+	}
+
+	_, body, err = stream("/hang")
+	if !IsTimeout(err) {
+		t.Errorf("Expected idle timeout error, got %v", err)
+	}
+	if strings.Count(string(body), "tick") != 5 {
+		t.Errorf("Events before idle timeout should be delivered, got %q", body)
+	}
+}
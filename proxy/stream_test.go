@@ -0,0 +1,120 @@
+package proxy
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ruke318/gateway/config"
+)
+
+func TestDoStream(t *testing.T) {
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 原样回传请求体，确认流式请求体被完整发送
+		received, _ := io.ReadAll(r.Body)
+		w.Write([]byte("first:" + string(received) + ":" + strings.Join(r.TransferEncoding, ",") + "\n"))
+		w.(http.Flusher).Flush()
+		<-release
+		w.Write([]byte("second\n"))
+	}))
+	defer backend.Close()
+	defer close(release)
+
+	u, err := NewUpstream("test", []config.UpstreamTarget{{URL: backend.URL}}, config.LoadBalanceConfig{}, nil)
+	if err != nil {
+		t.Fatalf("NewUpstream failed: %v", err)
+	}
+	defer u.Close()
+
+	f := NewForwarder("")
+	resp, err := f.DoStream(&ForwardOptions{
+		Method:        http.MethodPost,
+		Path:          "/upload",
+		Upstream:      u,
+		BodyReader:    strings.NewReader("payload"),
+		ContentLength: -1,
+	})
+	if err != nil {
+		t.Fatalf("DoStream failed: %v", err)
+	}
+
+	// 第一段数据在后端结束响应之前就能读到
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil {
+		t.Fatalf("Read first chunk failed: %v", err)
+	}
+	if line != "first:payload:chunked\n" {
+		t.Errorf("Unexpected first chunk %q", line)
+	}
+	if active := u.Targets()[0].ActiveRequests(); active != 1 {
+		t.Errorf("Target should stay active while streaming, got %d", active)
+	}
+
+	resp.Body.Close()
+	if active := u.Targets()[0].ActiveRequests(); active != 0 {
+		t.Errorf("Target should be released after close, got %d", active)
+	}
+}
+
+func TestMaxResponseBody(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("x", 100)))
+	}))
+	defer backend.Close()
+
+	f := NewForwarder(backend.URL)
+	opts := &ForwardOptions{
+		Method:          http.MethodGet,
+		Path:            "/",
+		RouteKey:        "GET /big",
+		MaxResponseBody: 99,
+		Retry:           &config.RetryConfig{RetryOn: []string{RetryOnConnectFailure}},
+		CircuitBreaker:  &config.CircuitBreakerConfig{MinRequests: 1},
+	}
+	if _, _, err := f.Do(opts); !errors.Is(err, ErrResponseTooLarge) {
+		t.Fatalf("Expected ErrResponseTooLarge, got %v", err)
+	}
+	// 响应体超限不代表后端故障，不应触发熔断
+	if status := f.BreakerStatuses()[0]; status.State != BreakerClosed || status.Failures != 0 {
+		t.Errorf("Oversized response should not count as failure, got %+v", status)
+	}
+
+	opts.MaxResponseBody = 100
+	if _, body, err := f.Do(opts); err != nil || len(body) != 100 {
+		t.Errorf("Expected body within limit, got %d bytes, err %v", len(body), err)
+	}
+}
+
+func TestDoStreamRetryClosesPreviousBody(t *testing.T) {
+	attempts := 0
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	f := NewForwarder(backend.URL)
+	resp, err := f.DoStream(&ForwardOptions{
+		Method: http.MethodGet,
+		Path:   "/",
+		Retry:  &config.RetryConfig{RetryOn: []string{"503"}, Backoff: config.Duration(time.Millisecond)},
+	})
+	if err != nil {
+		t.Fatalf("DoStream failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "ok" {
+		t.Errorf("Expected retried stream to succeed, got %d %q", resp.StatusCode, body)
+	}
+}
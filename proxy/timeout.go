@@ -0,0 +1,137 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ruke318/gateway/config"
+)
+
+// 转发超时默认值
+const (
+	defaultConnectTimeout        = 5 * time.Second
+	defaultTLSHandshakeTimeout   = 5 * time.Second
+	defaultResponseHeaderTimeout = 30 * time.Second
+	defaultTotalTimeout          = 60 * time.Second
+)
+
+// IsTimeout 判断转发错误是否由超时引起（连接、TLS 握手、等待响应头或总超时）
+func IsTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// clientPool 按后端协议和连接相关的超时配置复用 http.Client
+// 连接、TLS 握手和响应头超时只能设置在 Transport 上，配置相同的路由共享同一个连接池
+type clientPool struct {
+	mu       sync.Mutex
+	defaults config.TimeoutConfig
+	clients  map[transportTimeouts]*http.Client
+}
+
+type transportTimeouts struct {
+	protocol       string
+	connect        time.Duration
+	tlsHandshake   time.Duration
+	responseHeader time.Duration
+}
+
+// SetTimeout 设置转发超时的全局默认值，未设置的字段使用内置默认值
+func (f *Forwarder) SetTimeout(cfg config.TimeoutConfig) {
+	f.clients.mu.Lock()
+	defer f.clients.mu.Unlock()
+	f.clients.defaults = cfg
+}
+
+// resolve 按路由配置、全局配置、内置默认值的顺序合并超时配置
+func (p *clientPool) resolve(route *config.TimeoutConfig) config.TimeoutConfig {
+	p.mu.Lock()
+	t := p.defaults
+	p.mu.Unlock()
+
+	if route != nil {
+		if route.Connect > 0 {
+			t.Connect = route.Connect
+		}
+		if route.TLSHandshake > 0 {
+			t.TLSHandshake = route.TLSHandshake
+		}
+		if route.ResponseHeader > 0 {
+			t.ResponseHeader = route.ResponseHeader
+		}
+		if route.Total > 0 {
+			t.Total = route.Total
+		}
+	}
+	t.Connect = config.Duration(t.Connect.Or(defaultConnectTimeout))
+	t.TLSHandshake = config.Duration(t.TLSHandshake.Or(defaultTLSHandshakeTimeout))
+	t.ResponseHeader = config.Duration(t.ResponseHeader.Or(defaultResponseHeaderTimeout))
+	t.Total = config.Duration(t.Total.Or(defaultTotalTimeout))
+	return t
+}
+
+// client 返回与后端协议、超时配置对应的 http.Client，总超时由请求的 context 控制
+func (p *clientPool) client(protocol string, t config.TimeoutConfig) *http.Client {
+	key := transportTimeouts{
+		protocol:       protocol,
+		connect:        t.Connect.Std(),
+		tlsHandshake:   t.TLSHandshake.Std(),
+		responseHeader: t.ResponseHeader.Std(),
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if c, ok := p.clients[key]; ok {
+		return c
+	}
+
+	c := &http.Client{Transport: newTransport(key)}
+	if p.clients == nil {
+		p.clients = make(map[transportTimeouts]*http.Client)
+	}
+	p.clients[key] = c
+	return c
+}
+
+// idleTimeoutBody 读取响应体时超过 timeout 没有收到数据则取消请求，返回的错误满足 IsTimeout
+type idleTimeoutBody struct {
+	io.ReadCloser
+	timeout time.Duration
+	timer   *time.Timer
+	expired int32
+}
+
+func newIdleTimeoutBody(body io.ReadCloser, timeout time.Duration, cancel context.CancelFunc) *idleTimeoutBody {
+	b := &idleTimeoutBody{ReadCloser: body, timeout: timeout}
+	b.timer = time.AfterFunc(timeout, func() {
+		atomic.StoreInt32(&b.expired, 1)
+		cancel()
+	})
+	return b
+}
+
+func (b *idleTimeoutBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.timer.Reset(b.timeout)
+	}
+	if err != nil && err != io.EOF && atomic.LoadInt32(&b.expired) == 1 {
+		err = fmt.Errorf("no data received for %s: %w", b.timeout, context.DeadlineExceeded)
+	}
+	return n, err
+}
+
+func (b *idleTimeoutBody) Close() error {
+	b.timer.Stop()
+	return b.ReadCloser.Close()
+}
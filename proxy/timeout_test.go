@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ruke318/gateway/config"
+)
+
+func TestForwardTimeouts(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow-body" {
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+		}
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer backend.Close()
+
+	f := NewForwarder(backend.URL)
+	f.SetTimeout(config.TimeoutConfig{Total: config.Duration(time.Minute)})
+
+	tests := []struct {
+		name    string
+		path    string
+		timeout *config.TimeoutConfig
+	}{
+		{"response header", "/slow-header", &config.TimeoutConfig{ResponseHeader: config.Duration(50 * time.Millisecond)}},
+		{"total", "/slow-body", &config.TimeoutConfig{Total: config.Duration(50 * time.Millisecond)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			_, _, err := f.Do(&ForwardOptions{Method: http.MethodGet, BackendURL: backend.URL, Path: tt.path, Timeout: tt.timeout})
+			if !IsTimeout(err) {
+				t.Fatalf("Expected timeout error, got %v", err)
+			}
+			if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+				t.Errorf("Timeout took too long: %s", elapsed)
+			}
+		})
+	}
+}
+
+func TestForwardPropagatesCancellation(t *testing.T) {
+	cancelled := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+			close(cancelled)
+		case <-time.After(time.Second):
+		}
+	}))
+	defer backend.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	f := NewForwarder(backend.URL)
+	if _, _, err := f.Do(&ForwardOptions{Method: http.MethodGet, BackendURL: backend.URL, Path: "/", Request: req}); err == nil {
+		t.Fatal("Expected error after client cancellation")
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(500 * time.Millisecond):
+		t.Error("Backend request was not cancelled")
+	}
+}
+
+func TestResolveTimeout(t *testing.T) {
+	var p clientPool
+	p.defaults = config.TimeoutConfig{Connect: config.Duration(time.Second), Total: config.Duration(10 * time.Second)}
+
+	got := p.resolve(&config.TimeoutConfig{Total: config.Duration(3 * time.Second)})
+	want := config.TimeoutConfig{
+		Connect:        config.Duration(time.Second),
+		TLSHandshake:   config.Duration(defaultTLSHandshakeTimeout),
+		ResponseHeader: config.Duration(defaultResponseHeaderTimeout),
+		Total:          config.Duration(3 * time.Second),
+	}
+	if got != want {
+		t.Errorf("resolve() = %+v, want %+v", got, want)
+	}
+	if p.client("", got) != p.client("", p.resolve(&config.TimeoutConfig{Total: config.Duration(time.Second)})) {
+		t.Error("Routes differing only in total timeout should share a client")
+	}
+}
@@ -0,0 +1,223 @@
+package proxy
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ruke318/gateway/config"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// GRPCError 是后端返回的非 OK gRPC 状态
+type GRPCError struct {
+	Code    int
+	Message string
+}
+
+func (e *GRPCError) Error() string {
+	return fmt.Sprintf("grpc status %d: %s", e.Code, e.Message)
+}
+
+// HTTPStatusFromGRPC 将 gRPC 状态码映射为 HTTP 状态码，与 google.api.http 转码规则一致
+func HTTPStatusFromGRPC(code int) int {
+	switch code {
+	case GRPCOK:
+		return http.StatusOK
+	case GRPCCanceled:
+		return 499 // 客户端关闭请求，沿用 nginx 的约定
+	case GRPCInvalidArgument, GRPCFailedPrecondition, GRPCOutOfRange:
+		return http.StatusBadRequest
+	case GRPCDeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case GRPCNotFound:
+		return http.StatusNotFound
+	case GRPCAlreadyExists, GRPCAborted:
+		return http.StatusConflict
+	case GRPCPermissionDenied:
+		return http.StatusForbidden
+	case GRPCResourceExhausted:
+		return http.StatusTooManyRequests
+	case GRPCUnimplemented:
+		return http.StatusNotImplemented
+	case GRPCUnavailable:
+		return http.StatusServiceUnavailable
+	case GRPCUnauthenticated:
+		return http.StatusUnauthorized
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// GRPCMethod 是从描述文件中解析出的一元 gRPC 方法，负责 JSON 与 protobuf 之间的转换
+type GRPCMethod struct {
+	desc protoreflect.MethodDescriptor
+}
+
+// Path 返回 gRPC 请求路径，如 /helloworld.Greeter/SayHello
+func (m *GRPCMethod) Path() string {
+	return "/" + string(m.desc.Parent().FullName()) + "/" + string(m.desc.Name())
+}
+
+// EncodeRequest 将 JSON 请求体转为带 gRPC 长度前缀的 protobuf 消息，空请求体对应空消息
+func (m *GRPCMethod) EncodeRequest(body []byte) ([]byte, error) {
+	msg := dynamicpb.NewMessage(m.desc.Input())
+	if len(body) > 0 {
+		if err := protojson.Unmarshal(body, msg); err != nil {
+			return nil, fmt.Errorf("invalid request for %s: %w", m.Path(), err)
+		}
+	}
+	payload, err := proto.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	frame := make([]byte, 5, 5+len(payload))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(payload)))
+	return append(frame, payload...), nil
+}
+
+// DecodeResponse 检查 gRPC 状态并将响应消息转为 JSON（包含零值字段）
+// resp 的响应体必须已经读完，trailers 才有值
+func (m *GRPCMethod) DecodeResponse(resp *http.Response, body []byte) ([]byte, error) {
+	if err := grpcStatus(resp); err != nil {
+		return nil, err
+	}
+	if len(body) < 5 {
+		return nil, errors.New("grpc: missing response message")
+	}
+	if body[0] != 0 {
+		return nil, errors.New("grpc: compressed response is not supported")
+	}
+	size := binary.BigEndian.Uint32(body[1:5])
+	if uint64(len(body)-5) != uint64(size) {
+		return nil, errors.New("grpc: malformed response message")
+	}
+
+	msg := dynamicpb.NewMessage(m.desc.Output())
+	if err := proto.Unmarshal(body[5:], msg); err != nil {
+		return nil, err
+	}
+	return protojson.MarshalOptions{EmitUnpopulated: true}.Marshal(msg)
+}
+
+// grpcStatus 从 trailers（或 Trailers-Only 响应的响应头）读取 grpc-status
+func grpcStatus(resp *http.Response) error {
+	if resp.StatusCode != http.StatusOK {
+		return &GRPCError{Code: GRPCStatusFromHTTP(resp.StatusCode), Message: http.StatusText(resp.StatusCode)}
+	}
+	header := resp.Trailer
+	if header.Get("Grpc-Status") == "" {
+		header = resp.Header
+	}
+	status := header.Get("Grpc-Status")
+	if status == "" {
+		return &GRPCError{Code: GRPCInternal, Message: "missing grpc-status"}
+	}
+	code, err := strconv.Atoi(status)
+	if err != nil {
+		return &GRPCError{Code: GRPCInternal, Message: "invalid grpc-status " + status}
+	}
+	if code == GRPCOK {
+		return nil
+	}
+	message, err := url.PathUnescape(header.Get("Grpc-Message"))
+	if err != nil {
+		message = header.Get("Grpc-Message")
+	}
+	return &GRPCError{Code: code, Message: message}
+}
+
+// GRPCRequestHeaders 基于客户端请求头生成 gRPC 调用的请求头，其余请求头作为 metadata 转发
+func GRPCRequestHeaders(src http.Header) http.Header {
+	headers := make(http.Header, len(src)+2)
+	for k, v := range src {
+		switch k {
+		case "Content-Type", "Content-Length", "Accept", "Accept-Encoding", "Connection", "Keep-Alive",
+			"Proxy-Connection", "Transfer-Encoding", "Upgrade", "Te", "Trailer", "Host":
+			continue
+		}
+		headers[k] = append([]string(nil), v...)
+	}
+	headers.Set("Content-Type", "application/grpc+proto")
+	headers.Set("Te", "trailers")
+	return headers
+}
+
+// grpcMethodCache 缓存解析后的描述文件，文件修改后重新加载
+type grpcMethodCache struct {
+	mu    sync.Mutex
+	files map[string]*descriptorFile
+}
+
+type descriptorFile struct {
+	modTime time.Time
+	files   *protoregistry.Files
+}
+
+// GRPCMethod 按路由配置查找 gRPC 方法
+func (f *Forwarder) GRPCMethod(cfg *config.GRPCTranscodeConfig) (*GRPCMethod, error) {
+	files, err := f.grpcMethods.load(cfg.DescriptorSet)
+	if err != nil {
+		return nil, err
+	}
+	d, err := files.FindDescriptorByName(protoreflect.FullName(cfg.Service))
+	if err != nil {
+		return nil, fmt.Errorf("grpc service %s not found in %s", cfg.Service, cfg.DescriptorSet)
+	}
+	service, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a grpc service", cfg.Service)
+	}
+	method := service.Methods().ByName(protoreflect.Name(cfg.Method))
+	if method == nil {
+		return nil, fmt.Errorf("grpc method %s/%s not found", cfg.Service, cfg.Method)
+	}
+	if method.IsStreamingClient() || method.IsStreamingServer() {
+		return nil, fmt.Errorf("grpc method %s/%s is streaming, only unary methods can be transcoded", cfg.Service, cfg.Method)
+	}
+	return &GRPCMethod{desc: method}, nil
+}
+
+func (c *grpcMethodCache) load(path string) (*protoregistry.Files, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cached, ok := c.files[path]; ok && cached.modTime.Equal(info.ModTime()) {
+		return cached.files, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid descriptor set %s: %w", path, err)
+	}
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return nil, fmt.Errorf("invalid descriptor set %s: %w", path, err)
+	}
+
+	if c.files == nil {
+		c.files = make(map[string]*descriptorFile)
+	}
+	c.files[path] = &descriptorFile{modTime: info.ModTime(), files: files}
+	return files, nil
+}
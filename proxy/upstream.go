@@ -0,0 +1,279 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ruke318/gateway/config"
+)
+
+// ErrNoAvailableTarget 上游组中没有可用节点
+var ErrNoAvailableTarget = errors.New("no available upstream target")
+
+// Target 是上游组中的一个后端节点
+type Target struct {
+	URL    string
+	Weight int
+
+	active int64 // 进行中的请求数
+	health targetHealth
+}
+
+// ActiveRequests 返回节点当前进行中的请求数
+func (t *Target) ActiveRequests() int64 {
+	return atomic.LoadInt64(&t.active)
+}
+
+func (t *Target) acquire() {
+	atomic.AddInt64(&t.active, 1)
+}
+
+func (t *Target) release() {
+	atomic.AddInt64(&t.active, -1)
+}
+
+// Upstream 是一组可负载均衡的后端节点
+type Upstream struct {
+	Name        string
+	targets     []*Target
+	balancer    Balancer
+	strategy    string
+	healthCheck *config.HealthCheckConfig
+
+	signature string // 配置签名，配置变化时重建
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewUpstream 根据节点列表、负载均衡和健康检查配置创建上游组
+// 配置了主动健康检查时会启动后台检查，不再使用时需要调用 Close
+func NewUpstream(name string, targets []config.UpstreamTarget, lb config.LoadBalanceConfig, hc *config.HealthCheckConfig) (*Upstream, error) {
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("upstream %s has no targets", name)
+	}
+
+	u := &Upstream{
+		Name:        name,
+		strategy:    lb.Strategy,
+		healthCheck: hc,
+		signature:   upstreamSignature(targets, lb, hc),
+		stop:        make(chan struct{}),
+	}
+	for _, t := range targets {
+		if t.URL == "" {
+			return nil, fmt.Errorf("upstream %s has a target without url", name)
+		}
+		weight := t.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		u.targets = append(u.targets, &Target{URL: t.URL, Weight: weight, health: targetHealth{healthy: 1}})
+	}
+
+	balancer, err := NewBalancer(lb, u.targets)
+	if err != nil {
+		return nil, fmt.Errorf("upstream %s: %w", name, err)
+	}
+	u.balancer = balancer
+
+	if hc != nil && hc.Active != nil {
+		u.startActiveCheck(hc.Active)
+	}
+	return u, nil
+}
+
+// Targets 返回上游组的全部节点
+func (u *Upstream) Targets() []*Target {
+	return u.targets
+}
+
+// Select 为请求选择一个节点，不健康或被摘除的节点会被跳过
+func (u *Upstream) Select(req *http.Request) (*Target, error) {
+	candidates := make([]*Target, 0, len(u.targets))
+	for _, t := range u.targets {
+		if t.Available() {
+			candidates = append(candidates, t)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("%w in %s", ErrNoAvailableTarget, u.Name)
+	}
+	return u.balancer.Pick(req, candidates), nil
+}
+
+func upstreamSignature(targets []config.UpstreamTarget, lb config.LoadBalanceConfig, hc *config.HealthCheckConfig) string {
+	data, _ := json.Marshal(struct {
+		Targets     []config.UpstreamTarget
+		LoadBalance config.LoadBalanceConfig
+		HealthCheck *config.HealthCheckConfig
+	}{targets, lb, hc})
+	return string(data)
+}
+
+// upstreamRegistry 管理命名上游组和路由内联上游组
+// 内联上游组按路由 Key 缓存，路由配置变化时自动重建，保证负载均衡状态在请求之间延续
+type upstreamRegistry struct {
+	mu     sync.RWMutex
+	named  map[string]*Upstream
+	inline map[string]*inlineUpstream
+}
+
+// inlineUpstream 记录内联上游组对应的路由快照
+// 路由快照不可变，指针相同时无需重新比较配置签名
+type inlineUpstream struct {
+	route    *config.RouteConfig
+	upstream *Upstream
+}
+
+func newUpstreamRegistry() *upstreamRegistry {
+	return &upstreamRegistry{
+		named:  make(map[string]*Upstream),
+		inline: make(map[string]*inlineUpstream),
+	}
+}
+
+// SetUpstreams 设置命名上游组，未变化的上游组保留原有状态
+func (f *Forwarder) SetUpstreams(upstreams []config.UpstreamConfig) error {
+	r := f.upstreams
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	named := make(map[string]*Upstream, len(upstreams))
+	for _, cfg := range upstreams {
+		if cfg.Name == "" {
+			return errors.New("upstream name is required")
+		}
+		if _, exists := named[cfg.Name]; exists {
+			return fmt.Errorf("duplicate upstream: %s", cfg.Name)
+		}
+
+		existing := r.named[cfg.Name]
+		if existing != nil && existing.signature == upstreamSignature(cfg.Targets, cfg.LoadBalance, cfg.HealthCheck) {
+			named[cfg.Name] = existing
+		} else {
+			u, err := NewUpstream(cfg.Name, cfg.Targets, cfg.LoadBalance, cfg.HealthCheck)
+			if err != nil {
+				for _, created := range named {
+					if created != r.named[created.Name] {
+						created.Close()
+					}
+				}
+				return err
+			}
+			named[cfg.Name] = u
+		}
+	}
+
+	// 停止被替换或删除的上游组的健康检查
+	for name, old := range r.named {
+		if named[name] != old {
+			old.Close()
+		}
+	}
+	r.named = named
+	return nil
+}
+
+// ResolveUpstream 返回路由使用的上游组；路由未配置上游组时返回 nil
+// 每个请求都会调用，命名上游组和路由快照未变化的内联上游组只持有读锁
+func (f *Forwarder) ResolveUpstream(route *config.RouteConfig) (*Upstream, error) {
+	r := f.upstreams
+	if route.Upstream != "" {
+		r.mu.RLock()
+		u, ok := r.named[route.Upstream]
+		r.mu.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("upstream not found: %s", route.Upstream)
+		}
+		return u, nil
+	}
+
+	if len(route.Upstreams) == 0 {
+		return nil, nil
+	}
+
+	key := route.Key()
+	r.mu.RLock()
+	cached, ok := r.inline[key]
+	hit := ok && cached.route == route
+	r.mu.RUnlock()
+	if hit {
+		return cached.upstream, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cached, ok = r.inline[key]
+	if ok && cached.route == route {
+		return cached.upstream, nil
+	}
+
+	var lb config.LoadBalanceConfig
+	if route.LoadBalance != nil {
+		lb = *route.LoadBalance
+	}
+	if ok && cached.upstream.signature == upstreamSignature(route.Upstreams, lb, route.HealthCheck) {
+		cached.route = route
+		return cached.upstream, nil
+	}
+
+	u, err := NewUpstream(key, route.Upstreams, lb, route.HealthCheck)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		cached.upstream.Close()
+	}
+	r.inline[key] = &inlineUpstream{route: route, upstream: u}
+	return u, nil
+}
+
+// PruneInlineUpstreams 删除 routes 中已不存在的路由的内联上游组，停止它们的健康检查
+// 在路由变更后调用，路由被删除或 Key 改变后不再探测旧节点
+func (f *Forwarder) PruneInlineUpstreams(routes []config.RouteConfig) {
+	keys := make(map[string]bool, len(routes))
+	for _, route := range routes {
+		if route.Upstream == "" && len(route.Upstreams) > 0 {
+			keys[route.Key()] = true
+		}
+	}
+
+	r := f.upstreams
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key, cached := range r.inline {
+		if !keys[key] {
+			cached.upstream.Close()
+			delete(r.inline, key)
+		}
+	}
+}
+
+// UpstreamStatuses 返回所有命名上游组和已使用过的内联上游组的健康状态
+func (f *Forwarder) UpstreamStatuses() []UpstreamStatus {
+	r := f.upstreams
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	statuses := make([]UpstreamStatus, 0, len(r.named)+len(r.inline))
+	for _, u := range r.named {
+		statuses = append(statuses, u.Status())
+	}
+	for _, cached := range r.inline {
+		status := cached.upstream.Status()
+		status.Inline = true
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].Inline != statuses[j].Inline {
+			return !statuses[i].Inline
+		}
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}
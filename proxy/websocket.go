@@ -0,0 +1,364 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// UpgradeConn 是发送了 Upgrade 握手请求的后端连接
+// Response 为 101 时可以继续读写数据；否则 Response.Body 为后端的普通响应
+type UpgradeConn struct {
+	Response *http.Response
+
+	conn      net.Conn
+	reader    *bufio.Reader
+	done      func()
+	closeOnce sync.Once
+}
+
+func (c *UpgradeConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+func (c *UpgradeConn) Write(p []byte) (int, error) {
+	return c.conn.Write(p)
+}
+
+// Close 关闭后端连接并释放节点
+func (c *UpgradeConn) Close() error {
+	err := c.conn.Close()
+	c.closeOnce.Do(c.done)
+	return err
+}
+
+// DialUpgrade 选择节点，建立连接并发送 Upgrade 握手请求（如 WebSocket）
+// 连接和 TLS 握手使用 connect、tlsHandshake 超时，等待握手响应使用 responseHeader 超时；
+// 握手结果计入被动健康检查和熔断统计，升级后的连接不受超时限制
+func (f *Forwarder) DialUpgrade(opts *ForwardOptions) (*UpgradeConn, error) {
+	breaker := f.breakers.get(opts.RouteKey, opts.CircuitBreaker)
+	if breaker != nil && !breaker.allow() {
+		return nil, fmt.Errorf("%w: %s", ErrCircuitOpen, opts.RouteKey)
+	}
+
+	backendURL := opts.BackendURL
+	if backendURL == "" {
+		backendURL = f.backendURL
+	}
+	var target *Target
+	if opts.Upstream != nil {
+		var err error
+		if target, err = opts.Upstream.Select(opts.Request); err != nil {
+			return nil, err
+		}
+		target.acquire()
+		backendURL = target.URL
+	}
+	release := func() {
+		if target != nil {
+			target.release()
+		}
+	}
+
+	start := time.Now()
+	conn, err := f.dialUpgrade(opts, backendURL)
+	status := 0
+	if err == nil {
+		status = conn.Response.StatusCode
+	}
+	if canceled(opts.Request, err) {
+		// 客户端在握手完成前断开，不计入健康检查和熔断
+		if breaker != nil {
+			breaker.abandon()
+		}
+	} else {
+		if target != nil {
+			opts.Upstream.report(target, err, status)
+		}
+		if breaker != nil {
+			breaker.record(err, status, time.Since(start))
+		}
+	}
+	if err != nil {
+		release()
+		return nil, err
+	}
+	conn.done = release
+	return conn, nil
+}
+
+func (f *Forwarder) dialUpgrade(opts *ForwardOptions, backendURL string) (*UpgradeConn, error) {
+	timeout := f.clients.resolve(opts.Timeout)
+	target, err := joinURL(backendURL, opts.Path, opts.RawQuery)
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConn := u.Scheme == "https" || u.Scheme == "wss"
+	addr := u.Host
+	if u.Port() == "" {
+		if tlsConn {
+			addr = net.JoinHostPort(u.Hostname(), "443")
+		} else {
+			addr = net.JoinHostPort(u.Hostname(), "80")
+		}
+	}
+
+	ctx := requestContext(opts.Request)
+	dialer := &net.Dialer{Timeout: timeout.Connect.Std()}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConn {
+		tc := tls.Client(conn, &tls.Config{ServerName: u.Hostname()})
+		conn.SetDeadline(time.Now().Add(timeout.TLSHandshake.Std()))
+		if err := tc.Handshake(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tc
+	}
+
+	req, err := http.NewRequest(opts.Method, target, nil)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	req.Header = f.outgoingHeaders(opts, true)
+
+	conn.SetDeadline(time.Now().Add(timeout.ResponseHeader.Std()))
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	return &UpgradeConn{Response: resp, conn: conn, reader: reader}, nil
+}
+
+// WebSocket 帧类型
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+)
+
+// ErrWebSocketMessageTooLarge 消息超过 RelayWebSocket 的 maxMessageSize
+var ErrWebSocketMessageTooLarge = errors.New("websocket message too large")
+
+// WebSocketMessage 是一条完整的 WebSocket 数据消息（分片已组装）
+type WebSocketMessage struct {
+	FromClient bool // true 表示客户端发往后端
+	Text       bool // true 为文本消息，否则为二进制消息
+	Data       []byte
+}
+
+// WebSocketFilter 检查或修改消息，返回 false 时丢弃该消息，返回错误时关闭连接
+type WebSocketFilter func(msg *WebSocketMessage) (bool, error)
+
+// RelayWebSocket 在客户端和后端之间双向转发 WebSocket 数据，直到任一方关闭连接
+// filter 为 nil 时直接转发字节流；否则逐帧解析，控制帧原样转发，数据消息交给 filter 处理后重新编码
+// 使用 filter 时需要在握手中去掉 Sec-WebSocket-Extensions，避免协商出压缩扩展
+func RelayWebSocket(client io.ReadWriteCloser, backend io.ReadWriteCloser, filter WebSocketFilter, maxMessageSize int64) error {
+	errc := make(chan error, 2)
+	relay := func(dst io.Writer, src io.Reader, fromClient bool) {
+		if filter == nil {
+			_, err := io.Copy(dst, src)
+			errc <- err
+			return
+		}
+		errc <- relayFrames(dst, src, fromClient, filter, maxMessageSize)
+	}
+	go relay(backend, client, true)
+	go relay(client, backend, false)
+
+	// 任一方向结束后关闭两端，另一个方向随之退出
+	err := <-errc
+	client.Close()
+	backend.Close()
+	<-errc
+
+	if err == io.EOF || errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+	return err
+}
+
+type wsFrame struct {
+	fin     bool
+	opcode  byte
+	payload []byte
+}
+
+func relayFrames(dst io.Writer, src io.Reader, fromClient bool, filter WebSocketFilter, maxMessageSize int64) error {
+	var opcode byte
+	var message []byte
+	for {
+		frame, err := readFrame(src, maxMessageSize)
+		if err != nil {
+			return err
+		}
+
+		if frame.opcode >= wsClose {
+			// 控制帧不分片，可以插在数据分片之间，直接转发
+			if err := writeFrame(dst, frame, fromClient); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if frame.opcode != wsContinuation {
+			opcode, message = frame.opcode, nil
+		}
+		message = append(message, frame.payload...)
+		if maxMessageSize > 0 && int64(len(message)) > maxMessageSize {
+			return ErrWebSocketMessageTooLarge
+		}
+		if !frame.fin {
+			continue
+		}
+
+		msg := &WebSocketMessage{FromClient: fromClient, Text: opcode == wsText, Data: message}
+		keep, err := filter(msg)
+		if err != nil {
+			return err
+		}
+		if !keep {
+			continue
+		}
+		if err := writeFrame(dst, wsFrame{fin: true, opcode: opcode, payload: msg.Data}, fromClient); err != nil {
+			return err
+		}
+	}
+}
+
+// readFrame 读取一帧并去掉掩码
+func readFrame(r io.Reader, maxPayload int64) (wsFrame, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return wsFrame{}, err
+	}
+	frame := wsFrame{fin: header[0]&0x80 != 0, opcode: header[0] & 0x0f}
+	if header[0]&0x70 != 0 {
+		return wsFrame{}, errors.New("websocket: unsupported extension bits")
+	}
+
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return wsFrame{}, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return wsFrame{}, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if maxPayload > 0 && length > uint64(maxPayload) {
+		return wsFrame{}, ErrWebSocketMessageTooLarge
+	}
+
+	var mask [4]byte
+	masked := header[1]&0x80 != 0
+	if masked {
+		if _, err := io.ReadFull(r, mask[:]); err != nil {
+			return wsFrame{}, err
+		}
+	}
+
+	frame.payload = make([]byte, length)
+	if _, err := io.ReadFull(r, frame.payload); err != nil {
+		return wsFrame{}, err
+	}
+	if masked {
+		for i := range frame.payload {
+			frame.payload[i] ^= mask[i%4]
+		}
+	}
+	return frame, nil
+}
+
+// writeFrame 编码一帧，客户端发往后端的帧必须加掩码
+func writeFrame(w io.Writer, frame wsFrame, mask bool) error {
+	header := make([]byte, 2, 14)
+	header[0] = frame.opcode
+	if frame.fin {
+		header[0] |= 0x80
+	}
+
+	length := len(frame.payload)
+	switch {
+	case length < 126:
+		header[1] = byte(length)
+	case length <= 0xffff:
+		header[1] = 126
+		header = header[:4]
+		binary.BigEndian.PutUint16(header[2:], uint16(length))
+	default:
+		header[1] = 127
+		header = header[:10]
+		binary.BigEndian.PutUint64(header[2:], uint64(length))
+	}
+
+	payload := frame.payload
+	if mask {
+		header[1] |= 0x80
+		var key [4]byte
+		if _, err := rand.Read(key[:]); err != nil {
+			return err
+		}
+		header = append(header, key[:]...)
+		payload = make([]byte, length)
+		for i, b := range frame.payload {
+			payload[i] = b ^ key[i%4]
+		}
+	}
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+// IsWebSocketUpgrade 判断请求是否为 WebSocket 握手
+func IsWebSocketUpgrade(r *http.Request) bool {
+	return headerContainsToken(r.Header, "Connection", "upgrade") && strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+func headerContainsToken(h http.Header, name, token string) bool {
+	for _, v := range h[http.CanonicalHeaderKey(name)] {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
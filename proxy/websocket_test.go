@@ -0,0 +1,180 @@
+package proxy
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ruke318/gateway/config"
+)
+
+// newEchoWebSocketServer 完成握手后把收到的每一帧原样回传，要求客户端的帧必须带掩码
+func newEchoWebSocketServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !IsWebSocketUpgrade(r) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.URL.RawQuery != "token=1" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		rw.Flush()
+
+		for {
+			header, err := rw.Peek(2)
+			if err != nil {
+				return
+			}
+			if header[1]&0x80 == 0 {
+				t.Errorf("Client frame should be masked")
+				return
+			}
+			frame, err := readFrame(rw, 0)
+			if err != nil {
+				return
+			}
+			if err := writeFrame(conn, frame, false); err != nil {
+				return
+			}
+		}
+	}))
+}
+
+func TestWebSocketRelay(t *testing.T) {
+	backend := newEchoWebSocketServer(t)
+	defer backend.Close()
+
+	f := NewForwarder(backend.URL)
+	headers := http.Header{}
+	headers.Set("Connection", "Upgrade")
+	headers.Set("Upgrade", "websocket")
+	conn, err := f.DialUpgrade(&ForwardOptions{
+		Method:   http.MethodGet,
+		Path:     "/ws",
+		RawQuery: "token=1",
+		Headers:  headers,
+	})
+	if err != nil {
+		t.Fatalf("DialUpgrade failed: %v", err)
+	}
+	if conn.Response.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected 101, got %d", conn.Response.StatusCode)
+	}
+
+	// 客户端发往后端的消息转为大写，内容为 drop 的消息被丢弃
+	filter := func(msg *WebSocketMessage) (bool, error) {
+		if !msg.FromClient {
+			return true, nil
+		}
+		if string(msg.Data) == "drop" {
+			return false, nil
+		}
+		msg.Data = bytes.ToUpper(msg.Data)
+		return true, nil
+	}
+	client, gatewaySide := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- RelayWebSocket(gatewaySide, conn, filter, 1024)
+	}()
+
+	send := func(frames ...wsFrame) {
+		for _, frame := range frames {
+			if err := writeFrame(client, frame, true); err != nil {
+				t.Fatalf("Write frame failed: %v", err)
+			}
+		}
+	}
+	expect := func(want string) {
+		client.SetReadDeadline(time.Now().Add(2 * time.Second))
+		frame, err := readFrame(client, 0)
+		if err != nil {
+			t.Fatalf("Read frame failed: %v", err)
+		}
+		if frame.opcode != wsText || !frame.fin || string(frame.payload) != want {
+			t.Errorf("Expected text frame %q, got opcode %d fin %v %q", want, frame.opcode, frame.fin, frame.payload)
+		}
+	}
+
+	send(wsFrame{fin: true, opcode: wsText, payload: []byte("hello")})
+	expect("HELLO")
+
+	// 分片消息组装后再交给 filter
+	send(wsFrame{opcode: wsText, payload: []byte("ab")}, wsFrame{fin: true, opcode: wsContinuation, payload: []byte("cd")})
+	expect("ABCD")
+
+	send(wsFrame{fin: true, opcode: wsText, payload: []byte("drop")})
+	send(wsFrame{fin: true, opcode: wsText, payload: []byte("next")})
+	expect("NEXT")
+
+	// 超过上限的消息关闭连接，读到帧头就会拒绝，不等待写完
+	go writeFrame(client, wsFrame{fin: true, opcode: wsBinary, payload: bytes.Repeat([]byte("x"), 2048)}, true)
+	select {
+	case err := <-done:
+		if err != ErrWebSocketMessageTooLarge {
+			t.Errorf("Expected ErrWebSocketMessageTooLarge, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Relay should stop on oversized message")
+	}
+}
+
+func TestDialUpgradeRejected(t *testing.T) {
+	backend := newEchoWebSocketServer(t)
+	defer backend.Close()
+
+	u, err := NewUpstream("ws", []config.UpstreamTarget{{URL: backend.URL}}, config.LoadBalanceConfig{}, nil)
+	if err != nil {
+		t.Fatalf("NewUpstream failed: %v", err)
+	}
+	defer u.Close()
+
+	f := NewForwarder("")
+	headers := http.Header{}
+	headers.Set("Connection", "Upgrade")
+	headers.Set("Upgrade", "websocket")
+	conn, err := f.DialUpgrade(&ForwardOptions{Method: http.MethodGet, Path: "/ws", Headers: headers, Upstream: u})
+	if err != nil {
+		t.Fatalf("DialUpgrade failed: %v", err)
+	}
+	if conn.Response.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected backend rejection to be returned, got %d", conn.Response.StatusCode)
+	}
+	if active := u.Targets()[0].ActiveRequests(); active != 1 {
+		t.Errorf("Target should stay active until close, got %d", active)
+	}
+	conn.Close()
+	if active := u.Targets()[0].ActiveRequests(); active != 0 {
+		t.Errorf("Target should be released after close, got %d", active)
+	}
+}
+
+func TestWebSocketFrameLengths(t *testing.T) {
+	for _, size := range []int{0, 125, 126, 65535, 65536} {
+		payload := []byte(strings.Repeat("a", size))
+		for _, mask := range []bool{false, true} {
+			var buf bytes.Buffer
+			if err := writeFrame(&buf, wsFrame{fin: true, opcode: wsBinary, payload: payload}, mask); err != nil {
+				t.Fatalf("writeFrame failed: %v", err)
+			}
+			frame, err := readFrame(&buf, 0)
+			if err != nil {
+				t.Fatalf("readFrame(%d, mask=%v) failed: %v", size, mask, err)
+			}
+			if !bytes.Equal(frame.payload, payload) || frame.opcode != wsBinary || !frame.fin {
+				t.Errorf("Frame of %d bytes (mask=%v) did not round trip", size, mask)
+			}
+		}
+	}
+}
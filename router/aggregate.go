@@ -0,0 +1,87 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ruke318/gateway/config"
+)
+
+// validateAggregate 校验聚合路由：调用名唯一、依赖存在且没有环
+// 聚合路由自己组装响应，不能与转发单个后端的功能同时使用
+func validateAggregate(route *config.RouteConfig) error {
+	cfg := route.Aggregate
+	if cfg == nil {
+		return nil
+	}
+	if len(cfg.Calls) == 0 {
+		return errors.New("aggregate requires at least one call")
+	}
+	switch {
+	case route.BodyMode == config.BodyModeStreaming:
+		return errors.New("aggregate cannot be used with streaming body mode")
+	case route.Protocol == config.ProtocolGRPC || route.GRPC != nil:
+		return errors.New("aggregate cannot be used with grpc")
+	case route.SSE != nil && route.SSE.Enabled, route.WebSocket != nil && route.WebSocket.Enabled:
+		return errors.New("aggregate cannot be used with sse or websocket")
+	case route.Canary != nil:
+		return errors.New("aggregate cannot be used with canary")
+	}
+	if feature := bufferedFeature(route); feature != "" {
+		return fmt.Errorf("aggregate cannot be used with %s", feature)
+	}
+
+	calls := make(map[string]*config.AggregateCall, len(cfg.Calls))
+	for i := range cfg.Calls {
+		call := &cfg.Calls[i]
+		if call.Name == "" {
+			return errors.New("aggregate call requires name")
+		}
+		if calls[call.Name] != nil {
+			return fmt.Errorf("duplicate aggregate call: %s", call.Name)
+		}
+		calls[call.Name] = call
+		switch call.OnError {
+		case "", config.AggregateOnErrorFail, config.AggregateOnErrorOmit, config.AggregateOnErrorDefault:
+		default:
+			return fmt.Errorf("aggregate call %s: unknown onError: %s", call.Name, call.OnError)
+		}
+	}
+	for _, call := range cfg.Calls {
+		for _, dep := range call.DependsOn {
+			if calls[dep] == nil {
+				return fmt.Errorf("aggregate call %s depends on unknown call %s", call.Name, dep)
+			}
+		}
+	}
+
+	// 深度优先检查依赖环
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[string]int, len(calls))
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("aggregate calls have a dependency cycle at %s", name)
+		case done:
+			return nil
+		}
+		state[name] = visiting
+		for _, dep := range calls[name].DependsOn {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		state[name] = done
+		return nil
+	}
+	for _, call := range cfg.Calls {
+		if err := visit(call.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
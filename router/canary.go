@@ -0,0 +1,130 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+
+	"github.com/ruke318/gateway/config"
+)
+
+// 粘性取值映射到的桶数，桶按权重比例分给各版本
+const canaryBuckets = 10000
+
+// PickVariant 按权重选择 canary 版本；sticky 不为空时同一个值总是落在同一个桶里
+// 版本按配置顺序占据连续的桶区间，调大某个版本的权重时原来命中它的值仍然命中它（相邻版本的区间不变时）
+// 所有版本的权重都为 0 时返回 nil
+func PickVariant(cfg *config.CanaryConfig, sticky string) *config.CanaryVariant {
+	if cfg == nil {
+		return nil
+	}
+	total := 0
+	for _, v := range cfg.Variants {
+		total += v.Weight
+	}
+	if total <= 0 {
+		return nil
+	}
+
+	var point float64
+	if sticky != "" {
+		h := fnv.New32a()
+		h.Write([]byte(sticky))
+		point = float64(h.Sum32()%canaryBuckets) / canaryBuckets * float64(total)
+	} else {
+		point = rand.Float64() * float64(total)
+	}
+	for i := range cfg.Variants {
+		v := &cfg.Variants[i]
+		if point < float64(v.Weight) {
+			return v
+		}
+		point -= float64(v.Weight)
+	}
+	// 浮点误差时落在最后一个有权重的版本
+	for i := len(cfg.Variants) - 1; i >= 0; i-- {
+		if cfg.Variants[i].Weight > 0 {
+			return &cfg.Variants[i]
+		}
+	}
+	return nil
+}
+
+// validateCanary 校验 canary 配置；版本的 body 转换与路由级的限制相同，WebSocket 连接不分流
+func validateCanary(route *config.RouteConfig) error {
+	cfg := route.Canary
+	if cfg == nil {
+		return nil
+	}
+	if len(cfg.Variants) == 0 {
+		return errors.New("canary requires at least one variant")
+	}
+	names := make(map[string]bool, len(cfg.Variants))
+	total := 0
+	for _, v := range cfg.Variants {
+		if v.Name == "" {
+			return errors.New("canary variant requires name")
+		}
+		if names[v.Name] {
+			return fmt.Errorf("duplicate canary variant: %s", v.Name)
+		}
+		names[v.Name] = true
+		if v.Weight < 0 {
+			return fmt.Errorf("canary variant %s has negative weight", v.Name)
+		}
+		total += v.Weight
+		if len(v.RequestTransform) > 0 || len(v.ResponseTransform) > 0 {
+			if route.BodyMode == config.BodyModeStreaming || (route.SSE != nil && route.SSE.Enabled) || route.Protocol == config.ProtocolGRPC {
+				return fmt.Errorf("canary variant %s: transforms cannot be used with streaming body mode, sse or grpc protocol", v.Name)
+			}
+		}
+	}
+	if total == 0 {
+		return errors.New("canary requires a variant with positive weight")
+	}
+	switch cfg.StickyOn {
+	case "":
+	case "header", "cookie", "context":
+		if cfg.StickyKey == "" {
+			return fmt.Errorf("canary sticky on %s requires stickyKey", cfg.StickyOn)
+		}
+	default:
+		return fmt.Errorf("unknown canary sticky source: %s", cfg.StickyOn)
+	}
+	if route.WebSocket != nil && route.WebSocket.Enabled {
+		return errors.New("canary cannot be used with websocket")
+	}
+	return nil
+}
+
+// SetCanaryWeights 调整路由 key 的 canary 版本权重，未出现在 weights 中的版本保持不变
+// 权重立即对新请求生效，正在处理的请求继续使用旧配置
+func (r *Router) SetCanaryWeights(key string, weights map[string]int) error {
+	return r.update(func(routes []config.RouteConfig) ([]config.RouteConfig, error) {
+		for i := range routes {
+			if routes[i].Key() != key {
+				continue
+			}
+			if routes[i].Canary == nil {
+				return nil, fmt.Errorf("%w: route %s has no canary", ErrInvalidRoute, key)
+			}
+			route := routes[i].DeepCopy()
+			for name, weight := range weights {
+				found := false
+				for j := range route.Canary.Variants {
+					if route.Canary.Variants[j].Name == name {
+						route.Canary.Variants[j].Weight = weight
+						found = true
+					}
+				}
+				if !found {
+					return nil, fmt.Errorf("%w: unknown canary variant %s", ErrInvalidRoute, name)
+				}
+			}
+			routes[i] = route
+			return routes, nil
+		}
+		return nil, fmt.Errorf("%w: %s", ErrRouteNotFound, key)
+	})
+}
@@ -0,0 +1,110 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/ruke318/gateway/config"
+)
+
+func canaryRoute(stable, canary int) config.RouteConfig {
+	return config.RouteConfig{
+		Path:   "/api/orders",
+		Method: "GET",
+		Canary: &config.CanaryConfig{
+			Variants: []config.CanaryVariant{
+				{Name: "stable", Weight: stable},
+				{Name: "canary", Weight: canary, BackendURL: "http://localhost:9091"},
+			},
+			StickyOn:  "header",
+			StickyKey: "X-User-Id",
+		},
+	}
+}
+
+// TestPickVariantWeights 测试按权重随机分流
+func TestPickVariantWeights(t *testing.T) {
+	route := canaryRoute(90, 10)
+	counts := map[string]int{}
+	for i := 0; i < 10000; i++ {
+		counts[PickVariant(route.Canary, "").Name]++
+	}
+	if counts["canary"] < 800 || counts["canary"] > 1200 {
+		t.Errorf("Expected about 10%% canary traffic, got %v", counts)
+	}
+
+	route = canaryRoute(0, 0)
+	if v := PickVariant(route.Canary, ""); v != nil {
+		t.Errorf("Expected no variant when all weights are zero, got %s", v.Name)
+	}
+}
+
+// TestPickVariantSticky 测试粘性分流：同一个值命中同一版本，调大权重时已命中 canary 的值保持不变
+func TestPickVariantSticky(t *testing.T) {
+	small := canaryRoute(99, 1)
+	large := canaryRoute(90, 10)
+	inCanary := 0
+	for i := 0; i < 2000; i++ {
+		user := fmt.Sprintf("user-%d", i)
+		v := PickVariant(small.Canary, user)
+		if again := PickVariant(small.Canary, user); again != v {
+			t.Fatalf("Sticky value %s should always pick the same variant", user)
+		}
+		if v.Name == "canary" {
+			inCanary++
+			if PickVariant(large.Canary, user).Name != "canary" {
+				t.Errorf("User %s should stay on canary when its weight grows", user)
+			}
+		}
+	}
+	if inCanary == 0 || inCanary > 60 {
+		t.Errorf("Expected about 1%% of users on canary, got %d", inCanary)
+	}
+}
+
+// TestSetCanaryWeights 测试实时调整权重
+func TestSetCanaryWeights(t *testing.T) {
+	router := NewRouter([]config.RouteConfig{canaryRoute(99, 1)}, "http://localhost:9090")
+	key := "GET /api/orders"
+
+	if err := router.SetCanaryWeights(key, map[string]int{"stable": 0, "canary": 100}); err != nil {
+		t.Fatalf("SetCanaryWeights failed: %v", err)
+	}
+	variants := router.GetAllRoutes()[0].Canary.Variants
+	if variants[0].Weight != 0 || variants[1].Weight != 100 {
+		t.Errorf("Weights not updated: %+v", variants)
+	}
+
+	if err := router.SetCanaryWeights(key, map[string]int{"unknown": 1}); !errors.Is(err, ErrInvalidRoute) {
+		t.Errorf("Unknown variant should be rejected, got %v", err)
+	}
+	if err := router.SetCanaryWeights(key, map[string]int{"canary": 0}); !errors.Is(err, ErrInvalidRoute) {
+		t.Errorf("All-zero weights should be rejected, got %v", err)
+	}
+	if err := router.SetCanaryWeights("GET /missing", map[string]int{"canary": 1}); !errors.Is(err, ErrRouteNotFound) {
+		t.Errorf("Expected ErrRouteNotFound, got %v", err)
+	}
+}
+
+// TestInvalidCanary 测试非法的 canary 配置被拒绝
+func TestInvalidCanary(t *testing.T) {
+	cases := map[string]func(route *config.RouteConfig){
+		"duplicate name": func(route *config.RouteConfig) { route.Canary.Variants[1].Name = "stable" },
+		"negative":       func(route *config.RouteConfig) { route.Canary.Variants[1].Weight = -1 },
+		"sticky key":     func(route *config.RouteConfig) { route.Canary.StickyKey = "" },
+		"sticky source":  func(route *config.RouteConfig) { route.Canary.StickyOn = "ip" },
+		"streaming": func(route *config.RouteConfig) {
+			route.BodyMode = config.BodyModeStreaming
+			route.Canary.Variants[1].ResponseTransform = map[string]interface{}{"data": "$.data"}
+		},
+	}
+	for name, mutate := range cases {
+		route := canaryRoute(90, 10)
+		mutate(&route)
+		router := NewRouter(nil, "http://localhost:9090")
+		if err := router.AddRoute(route); !errors.Is(err, ErrInvalidRoute) {
+			t.Errorf("%s: expected ErrInvalidRoute, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,314 @@
+package router
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/ruke318/gateway/config"
+)
+
+// MatchCandidate 描述一条能匹配请求的路由，用于排查请求为何命中某条路由
+type MatchCandidate struct {
+	Key      string            `json:"key"`
+	Path     string            `json:"path,omitempty"`
+	Regex    string            `json:"pathRegex,omitempty"`
+	Method   string            `json:"method,omitempty"`
+	Priority int               `json:"priority"`
+	Params   map[string]string `json:"params"`
+	Selected bool              `json:"selected"` // 是否为最终命中的路由
+}
+
+// Explain 按匹配顺序返回所有能匹配请求的路由，并标记最终命中的路由
+func (r *Router) Explain(req *http.Request) []MatchCandidate {
+	table := r.snapshot()
+
+	var result []MatchCandidate
+	selected := -1
+	table.each(req.URL.Path, acceptRequest(req), func(c candidate) bool {
+		route := c.entry.route
+		if selected < 0 || route.Priority > result[selected].Priority {
+			selected = len(result)
+		}
+		result = append(result, MatchCandidate{
+			Key:      route.Key(),
+			Path:     route.Path,
+			Regex:    route.PathRegex,
+			Method:   route.Method,
+			Priority: route.Priority,
+			Params:   c.params,
+		})
+		return true
+	})
+	if selected >= 0 {
+		result[selected].Selected = true
+	}
+	return result
+}
+
+// 路由冲突类型
+const (
+	ConflictShadowed = "shadowed" // 路由被另一条路由完全覆盖，永远不会命中
+	ConflictOverlap  = "overlap"  // 两条路由部分重叠，重叠部分的请求由 Winner 处理
+)
+
+// Conflict 描述两条路由之间的冲突
+type Conflict struct {
+	Type   string `json:"type"`
+	Route  string `json:"route"`  // 被遮蔽或在重叠部分落选的路由
+	Winner string `json:"winner"` // 在重叠部分胜出的路由
+}
+
+// Conflicts 静态分析路由表，报告被遮蔽和部分重叠的路由
+// 一条路由完全包含另一条、且更具体的路由胜出属于正常用法（例如 /api/* 与 /api/users），不会报告
+// PathRegex 路由无法静态分析，不参与检测
+func (r *Router) Conflicts() []Conflict {
+	table := r.snapshot()
+
+	var entries []*entry
+	var patterns []*pattern
+	for i := range table.routes {
+		route := &table.routes[i]
+		if route.PathRegex != "" || route.Path == "" {
+			continue
+		}
+		p, err := parsePattern(route.Path)
+		if err != nil {
+			continue
+		}
+		preds, _ := compilePredicates(route)
+		entries = append(entries, &entry{route: route, order: i, predicates: preds})
+		patterns = append(patterns, p)
+	}
+
+	var conflicts []Conflict
+	for i := 0; i < len(entries); i++ {
+		for j := i + 1; j < len(entries); j++ {
+			a, b := entries[i], entries[j]
+			pa, pb := patterns[i], patterns[j]
+			if !routesOverlap(a.route, b.route) || !patternsOverlap(pa, pb) {
+				continue
+			}
+
+			winner, loser, pw, pl := a, b, pa, pb
+			if !wins(a, pa, b, pb) {
+				winner, loser, pw, pl = b, a, pb, pa
+			}
+
+			switch {
+			case routeCovers(winner.route, loser.route) && patternCovers(pw, pl):
+				conflicts = append(conflicts, Conflict{Type: ConflictShadowed, Route: loser.route.Key(), Winner: winner.route.Key()})
+			case patternCovers(pl, pw):
+				// 落选路由的路径范围包含胜出路由，属于更具体路由优先的正常用法
+			default:
+				conflicts = append(conflicts, Conflict{Type: ConflictOverlap, Route: loser.route.Key(), Winner: winner.route.Key()})
+			}
+		}
+	}
+	return conflicts
+}
+
+// wins 判断两条都能匹配同一请求的路由中 a 是否胜出，规则与 match 一致
+func wins(a *entry, pa *pattern, b *entry, pb *pattern) bool {
+	if a.route.Priority != b.route.Priority {
+		return a.route.Priority > b.route.Priority
+	}
+	if c := compareSpecificity(pa, pb); c != 0 {
+		return c > 0
+	}
+	less := func(x, y *entry) bool { return len(x.prefix) > len(y.prefix) }
+	a.prefix, b.prefix = pa.prefix, pb.prefix
+	return entryBefore(a, b, less)
+}
+
+// 路径段在匹配顺序中的排名，数值越小越先匹配
+func segmentRank(p *pattern, i int) int {
+	if i < len(p.segments) {
+		switch p.segments[i].kind {
+		case segmentStatic:
+			return 0
+		case segmentParam:
+			return 1
+		default:
+			return 2
+		}
+	}
+	if p.wildcard {
+		return 3
+	}
+	return 0
+}
+
+// compareSpecificity 按回溯顺序逐段比较，a 更具体返回 1，b 更具体返回 -1
+func compareSpecificity(a, b *pattern) int {
+	n := len(a.segments)
+	if len(b.segments) > n {
+		n = len(b.segments)
+	}
+	for i := 0; i <= n; i++ {
+		ra, rb := segmentRank(a, i), segmentRank(b, i)
+		if ra != rb {
+			if ra < rb {
+				return 1
+			}
+			return -1
+		}
+	}
+	return 0
+}
+
+// patternsOverlap 判断是否存在同时匹配两个路径模式的路径
+func patternsOverlap(a, b *pattern) bool {
+	for i := 0; ; i++ {
+		aHas, bHas := i < len(a.segments), i < len(b.segments)
+		// {name...} 要求当前位置还有路径段，对方在此处结束且不是通配时不重叠
+		if aHas && a.segments[i].kind == segmentCatchAll {
+			return bHas || b.wildcard
+		}
+		if bHas && b.segments[i].kind == segmentCatchAll {
+			return aHas || a.wildcard
+		}
+		if aHas && bHas {
+			if !segmentsOverlap(a.segments[i], b.segments[i]) {
+				return false
+			}
+			continue
+		}
+		if !aHas && !bHas {
+			if a.wildcard && b.wildcard {
+				return strings.HasPrefix(a.prefix, b.prefix) || strings.HasPrefix(b.prefix, a.prefix)
+			}
+			return a.wildcard == b.wildcard
+		}
+		// 一方已结束，另一方还有段：结束的一方必须是前缀通配才能继续匹配
+		ended, other := a, b
+		if aHas {
+			ended, other = b, a
+		}
+		if !ended.wildcard {
+			return false
+		}
+		seg := other.segments[i]
+		return seg.kind == segmentParam || strings.HasPrefix(seg.value, ended.prefix)
+	}
+}
+
+func segmentsOverlap(a, b segment) bool {
+	switch {
+	case a.kind == segmentStatic && b.kind == segmentStatic:
+		return a.value == b.value
+	case a.kind == segmentStatic:
+		return a.value != ""
+	case b.kind == segmentStatic:
+		return b.value != ""
+	default:
+		return true
+	}
+}
+
+// patternCovers 判断 a 是否匹配 b 能匹配的所有路径
+func patternCovers(a, b *pattern) bool {
+	for i := 0; ; i++ {
+		aHas, bHas := i < len(a.segments), i < len(b.segments)
+		if aHas && a.segments[i].kind == segmentCatchAll {
+			return bHas || b.wildcard
+		}
+		if bHas && b.segments[i].kind == segmentCatchAll {
+			return !aHas && a.wildcard && a.prefix == ""
+		}
+		if aHas && bHas {
+			sa, sb := a.segments[i], b.segments[i]
+			if sa.kind == segmentStatic && (sb.kind != segmentStatic || sa.value != sb.value) {
+				return false
+			}
+			if sa.kind == segmentParam && sb.kind == segmentStatic && sb.value == "" {
+				return false
+			}
+			continue
+		}
+		if aHas {
+			return false
+		}
+		if !a.wildcard {
+			return !bHas && !b.wildcard
+		}
+		if bHas {
+			seg := b.segments[i]
+			return a.prefix == "" || seg.kind == segmentStatic && strings.HasPrefix(seg.value, a.prefix)
+		}
+		return b.wildcard && strings.HasPrefix(b.prefix, a.prefix)
+	}
+}
+
+// routesOverlap 判断 method 和附加条件是否可能同时满足
+func routesOverlap(a, b *config.RouteConfig) bool {
+	if a.Method != "" && b.Method != "" && !strings.EqualFold(a.Method, b.Method) {
+		return false
+	}
+	if a.Host != "" && b.Host != "" && !hostCovers(a.Host, b.Host) && !hostCovers(b.Host, a.Host) {
+		return false
+	}
+	if a.ContentType != "" && b.ContentType != "" && !strings.EqualFold(a.ContentType, b.ContentType) {
+		return false
+	}
+	return conditionsCompatible(a.Headers, b.Headers, http.CanonicalHeaderKey) && conditionsCompatible(a.Query, b.Query, nil)
+}
+
+// routeCovers 判断 a 的 method 和附加条件是否比 b 更宽松（b 满足时 a 一定满足）
+func routeCovers(a, b *config.RouteConfig) bool {
+	if a.Method != "" && !strings.EqualFold(a.Method, b.Method) {
+		return false
+	}
+	if a.Host != "" && (b.Host == "" || !hostCovers(a.Host, b.Host)) {
+		return false
+	}
+	if a.ContentType != "" && !strings.EqualFold(a.ContentType, b.ContentType) {
+		return false
+	}
+	return conditionsSubset(a.Headers, b.Headers, http.CanonicalHeaderKey) && conditionsSubset(a.Query, b.Query, nil)
+}
+
+func hostCovers(a, b string) bool {
+	a, b = strings.ToLower(a), strings.ToLower(b)
+	if a == b {
+		return true
+	}
+	return strings.HasPrefix(a, "*.") && matchHost(a, strings.TrimPrefix(b, "*."))
+}
+
+// conditionsCompatible 同名条件都是精确值且不相等时不可能同时满足
+func conditionsCompatible(a, b map[string]string, normalize func(string) string) bool {
+	bn := normalizeConditions(b, normalize)
+	for name, va := range normalizeConditions(a, normalize) {
+		vb, ok := bn[name]
+		if !ok || va == "" || vb == "" || strings.HasPrefix(va, "~") || strings.HasPrefix(vb, "~") {
+			continue
+		}
+		if va != vb {
+			return false
+		}
+	}
+	return true
+}
+
+// conditionsSubset 判断 a 的每个条件在 b 中都有相同或更严格的条件
+func conditionsSubset(a, b map[string]string, normalize func(string) string) bool {
+	bn := normalizeConditions(b, normalize)
+	for name, va := range normalizeConditions(a, normalize) {
+		vb, ok := bn[name]
+		if !ok || va != "" && va != vb {
+			return false
+		}
+	}
+	return true
+}
+
+func normalizeConditions(conditions map[string]string, normalize func(string) string) map[string]string {
+	if normalize == nil {
+		return conditions
+	}
+	result := make(map[string]string, len(conditions))
+	for k, v := range conditions {
+		result[normalize(k)] = v
+	}
+	return result
+}
@@ -0,0 +1,145 @@
+package router
+
+import (
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/ruke318/gateway/config"
+)
+
+// predicates 是路由除 Path/Method 之外的匹配条件，在构建路由表时预编译
+type predicates struct {
+	host        string // 小写；以 "*." 开头表示通配子域名
+	headers     []valueMatcher
+	query       []valueMatcher
+	contentType string // 小写；支持 "application/*" 形式的子类型通配
+}
+
+// valueMatcher 匹配单个 Header 或 Query 参数
+// 配置值为空表示只要求存在；以 "~" 开头表示正则匹配；否则精确匹配
+type valueMatcher struct {
+	name  string
+	value string
+	regex *regexp.Regexp
+}
+
+func compilePredicates(route *config.RouteConfig) (*predicates, error) {
+	p := &predicates{
+		host:        strings.ToLower(route.Host),
+		contentType: strings.ToLower(route.ContentType),
+	}
+
+	var err error
+	if p.headers, err = compileMatchers(route.Headers, http.CanonicalHeaderKey); err != nil {
+		return nil, fmt.Errorf("invalid header predicate: %w", err)
+	}
+	if p.query, err = compileMatchers(route.Query, nil); err != nil {
+		return nil, fmt.Errorf("invalid query predicate: %w", err)
+	}
+	return p, nil
+}
+
+func compileMatchers(conditions map[string]string, normalize func(string) string) ([]valueMatcher, error) {
+	matchers := make([]valueMatcher, 0, len(conditions))
+	for name, value := range conditions {
+		if normalize != nil {
+			name = normalize(name)
+		}
+		m := valueMatcher{name: name, value: value}
+		if strings.HasPrefix(value, "~") {
+			regex, err := regexp.Compile(value[1:])
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			m.regex = regex
+		}
+		matchers = append(matchers, m)
+	}
+	return matchers, nil
+}
+
+// count 返回条件数量，条件越多的路由越具体
+func (p *predicates) count() int {
+	n := len(p.headers) + len(p.query)
+	if p.host != "" {
+		n++
+	}
+	if p.contentType != "" {
+		n++
+	}
+	return n
+}
+
+func (p *predicates) match(req *http.Request) bool {
+	if p.host != "" && !matchHost(p.host, req.Host) {
+		return false
+	}
+
+	if p.contentType != "" && !matchContentType(p.contentType, req.Header.Get("Content-Type")) {
+		return false
+	}
+
+	for _, m := range p.headers {
+		values, ok := req.Header[m.name]
+		if !ok || !m.matchAny(values) {
+			return false
+		}
+	}
+
+	if len(p.query) > 0 {
+		query := req.URL.Query()
+		for _, m := range p.query {
+			values, ok := query[m.name]
+			if !ok || !m.matchAny(values) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (m *valueMatcher) matchAny(values []string) bool {
+	if m.value == "" {
+		return true
+	}
+	for _, v := range values {
+		if m.regex != nil {
+			if m.regex.MatchString(v) {
+				return true
+			}
+		} else if v == m.value {
+			return true
+		}
+	}
+	return false
+}
+
+// matchHost 匹配请求 Host（忽略端口和大小写）
+// "*.example.com" 匹配任意层级的子域名，但不匹配 example.com 本身
+func matchHost(pattern, host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+
+	if strings.HasPrefix(pattern, "*.") {
+		return strings.HasSuffix(host, pattern[1:])
+	}
+	return host == pattern
+}
+
+// matchContentType 比较媒体类型（忽略 charset 等参数），支持 "type/*"
+func matchContentType(pattern, contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	if strings.HasSuffix(pattern, "/*") {
+		return strings.HasPrefix(mediaType, pattern[:len(pattern)-1])
+	}
+	return mediaType == pattern
+}
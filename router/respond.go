@@ -0,0 +1,52 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/ruke318/gateway/config"
+)
+
+// validateRespond 校验本地响应路由：body、template 和 redirect 只能配置一种，不能与转发相关的功能同时使用
+func validateRespond(route *config.RouteConfig) error {
+	cfg := route.Respond
+	if cfg == nil {
+		return nil
+	}
+	kinds := 0
+	for _, set := range []bool{cfg.Body != "", cfg.Template != nil, cfg.Redirect != ""} {
+		if set {
+			kinds++
+		}
+	}
+	if kinds > 1 {
+		return errors.New("respond allows only one of body, template and redirect")
+	}
+	if cfg.Status != 0 && (cfg.Status < 100 || cfg.Status > 599) {
+		return fmt.Errorf("invalid respond status: %d", cfg.Status)
+	}
+	if cfg.Redirect != "" && cfg.Status != 0 && (cfg.Status < http.StatusMultipleChoices || cfg.Status >= http.StatusBadRequest) {
+		return fmt.Errorf("respond redirect requires a 3xx status, got %d", cfg.Status)
+	}
+	if cfg.KeepQuery && cfg.Redirect == "" {
+		return errors.New("respond keepQuery requires redirect")
+	}
+
+	switch {
+	case route.BodyMode == config.BodyModeStreaming:
+		return errors.New("respond cannot be used with streaming body mode")
+	case route.Protocol == config.ProtocolGRPC || route.GRPC != nil:
+		return errors.New("respond cannot be used with grpc")
+	case route.SSE != nil && route.SSE.Enabled, route.WebSocket != nil && route.WebSocket.Enabled:
+		return errors.New("respond cannot be used with sse or websocket")
+	case route.Canary != nil:
+		return errors.New("respond cannot be used with canary")
+	case route.Aggregate != nil:
+		return errors.New("respond cannot be used with aggregate")
+	}
+	if feature := bufferedFeature(route); feature != "" {
+		return fmt.Errorf("respond cannot be used with %s", feature)
+	}
+	return nil
+}
@@ -1,119 +1,347 @@
 package router
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/ruke318/gateway/config"
+	"golang.org/x/net/http/httpguts"
+)
+
+// 路由管理相关的错误，管理接口据此返回不同的状态码
+var (
+	ErrRouteExists   = errors.New("route already exists")
+	ErrRouteNotFound = errors.New("route not found")
+	ErrInvalidRoute  = errors.New("invalid route")
 )
 
 type Router struct {
-	routes         []config.RouteConfig
+	table          atomic.Value // *routeTable，只读快照
 	defaultBackend string
-	mu             sync.RWMutex
+	mu             sync.Mutex // 串行化写操作，读操作无锁
+	onChange       func(routes []config.RouteConfig)
 }
 
 func NewRouter(routes []config.RouteConfig, defaultBackend string) *Router {
-	return &Router{
-		routes:         routes,
+	r := &Router{
 		defaultBackend: defaultBackend,
 	}
+
+	valid := make([]config.RouteConfig, 0, len(routes))
+	keys := make(map[string]bool, len(routes))
+	for _, route := range routes {
+		if err := validateRoute(&route); err != nil {
+			log.Printf("Warning: skip invalid route %s: %v", route.Key(), err)
+			continue
+		}
+		// 与 AddRoute 一致，Key 重复的路由无法单独更新和删除，保留先出现的
+		if keys[route.Key()] {
+			log.Printf("Warning: skip duplicate route %s", route.Key())
+			continue
+		}
+		keys[route.Key()] = true
+		valid = append(valid, route.DeepCopy())
+	}
+
+	table, err := buildTable(valid)
+	if err != nil {
+		// 上面已经过滤了非法路由，理论上不会失败
+		log.Printf("Warning: failed to build route table: %v", err)
+		table, _ = buildTable(nil)
+	}
+	r.table.Store(table)
+	return r
 }
 
-// AddRoute 动态添加路由
-// 如果路由已存在（相同 path 和 method），返回错误
-func (r *Router) AddRoute(route config.RouteConfig) error {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+// validateRoute 校验单条路由的路径、匹配条件和各项功能配置
+// NewRouter 过滤非法路由和 buildTable 构建路由表都使用它，新增的校验只需要加在这里
+func validateRoute(route *config.RouteConfig) error {
+	if route.PathRegex != "" {
+		if _, err := compilePathRegex(route); err != nil {
+			return err
+		}
+	} else if route.Path != "" {
+		if _, err := parsePattern(route.Path); err != nil {
+			return err
+		}
+	}
+	if err := validateBodyMode(route); err != nil {
+		return err
+	}
+	if err := validateProtocol(route); err != nil {
+		return err
+	}
+	if err := validateHeaderTransforms(route); err != nil {
+		return err
+	}
+	if err := validateMirror(route); err != nil {
+		return err
+	}
+	if err := validateCanary(route); err != nil {
+		return err
+	}
+	if err := validateAggregate(route); err != nil {
+		return err
+	}
+	if err := validateRespond(route); err != nil {
+		return err
+	}
+	_, err := compilePredicates(route)
+	return err
+}
 
-	// 检查路由是否已存在
-	for _, existingRoute := range r.routes {
-		if existingRoute.Path == route.Path && existingRoute.Method == route.Method {
-			return fmt.Errorf("route already exists: %s %s", route.Method, route.Path)
+// validateProtocol 校验后端协议；gRPC 使用流式转发，不能与 body 转换同时使用
+// REST 转 gRPC 需要读取完整的请求体，使用 HTTP/2 调用后端
+func validateProtocol(route *config.RouteConfig) error {
+	if route.GRPC != nil {
+		if route.GRPC.DescriptorSet == "" || route.GRPC.Service == "" || route.GRPC.Method == "" {
+			return errors.New("grpc transcoding requires descriptorSet, service and method")
+		}
+		if route.BodyMode == config.BodyModeStreaming || (route.SSE != nil && route.SSE.Enabled) {
+			return errors.New("grpc transcoding cannot be used with streaming body mode or sse")
+		}
+		if route.Protocol != config.ProtocolAuto && route.Protocol != config.ProtocolH2 {
+			return fmt.Errorf("grpc transcoding cannot be used with protocol %s", route.Protocol)
+		}
+		if route.Cache != nil && route.Cache.Enabled {
+			return errors.New("grpc transcoding cannot be used with cache")
 		}
+		return nil
 	}
+	switch route.Protocol {
+	case config.ProtocolAuto, config.ProtocolHTTP1, config.ProtocolH2:
+		return nil
+	case config.ProtocolGRPC:
+		if route.BodyMode == config.BodyModeBuffered {
+			return errors.New("grpc protocol cannot be used with buffered body mode")
+		}
+		if len(route.RequestTransform) > 0 || len(route.ResponseTransform) > 0 {
+			return errors.New("grpc protocol cannot be used with requestTransform or responseTransform")
+		}
+		if feature := bufferedFeature(route); feature != "" {
+			return fmt.Errorf("grpc protocol cannot be used with %s", feature)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown protocol: %s", route.Protocol)
+	}
+}
 
-	r.routes = append(r.routes, route)
+// validateHeaderTransforms 校验 requestHeaders 和 responseHeaders 中的 Header 名称
+func validateHeaderTransforms(route *config.RouteConfig) error {
+	for _, cfg := range []*config.HeaderTransformConfig{route.RequestHeaders, route.ResponseHeaders} {
+		if cfg == nil {
+			continue
+		}
+		names := append([]string(nil), cfg.Remove...)
+		for from, to := range cfg.Rename {
+			names = append(names, from, to)
+		}
+		for name := range cfg.Set {
+			names = append(names, name)
+		}
+		for name := range cfg.Append {
+			names = append(names, name)
+		}
+		for _, name := range names {
+			if !httpguts.ValidHeaderFieldName(name) {
+				return fmt.Errorf("invalid header name: %q", name)
+			}
+		}
+	}
 	return nil
 }
 
-// UpdateRoute 动态更新路由（根据 path 和 method 匹配）
-func (r *Router) UpdateRoute(route config.RouteConfig) error {
+// bufferedFeature 返回路由启用的、需要完整读取响应体的功能
+func bufferedFeature(route *config.RouteConfig) string {
+	if route.Cache != nil && route.Cache.Enabled {
+		return "cache"
+	}
+	if route.Coalesce {
+		return "coalesce"
+	}
+	if route.Mirror != nil && route.Mirror.Enabled {
+		return "mirror"
+	}
+	return ""
+}
+
+// validateMirror 校验流量镜像配置；WebSocket 连接不做镜像
+func validateMirror(route *config.RouteConfig) error {
+	if route.Mirror == nil || !route.Mirror.Enabled {
+		return nil
+	}
+	if route.Mirror.Upstream == "" && route.Mirror.BackendURL == "" {
+		return errors.New("mirror requires upstream or backendUrl")
+	}
+	if route.Mirror.Percentage < 0 || route.Mirror.Percentage > 100 {
+		return fmt.Errorf("mirror percentage must be between 0 and 100, got %v", route.Mirror.Percentage)
+	}
+	if route.WebSocket != nil && route.WebSocket.Enabled {
+		return errors.New("mirror cannot be used with websocket")
+	}
+	return nil
+}
+
+// validateBodyMode 校验 body 处理方式；流式转发不读取 body，不能与 body 转换、缓存、请求合并和流量镜像同时使用
+func validateBodyMode(route *config.RouteConfig) error {
+	if route.SSE != nil && route.SSE.Enabled {
+		if route.BodyMode == config.BodyModeBuffered {
+			return errors.New("sse cannot be used with buffered body mode")
+		}
+		if len(route.RequestTransform) > 0 || len(route.ResponseTransform) > 0 {
+			return errors.New("sse cannot be used with requestTransform or responseTransform, use sse.eventTransform instead")
+		}
+		if feature := bufferedFeature(route); feature != "" {
+			return fmt.Errorf("sse cannot be used with %s", feature)
+		}
+	}
+	switch route.BodyMode {
+	case "", config.BodyModeAuto, config.BodyModeBuffered:
+		return nil
+	case config.BodyModeStreaming:
+		if len(route.RequestTransform) > 0 || len(route.ResponseTransform) > 0 {
+			return errors.New("streaming body mode cannot be used with requestTransform or responseTransform")
+		}
+		if feature := bufferedFeature(route); feature != "" {
+			return fmt.Errorf("streaming body mode cannot be used with %s", feature)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown body mode: %s", route.BodyMode)
+	}
+}
+
+func (r *Router) snapshot() *routeTable {
+	return r.table.Load().(*routeTable)
+}
+
+// update 在写锁内基于当前快照生成新的路由列表，重建路由表后原子替换
+// 正在处理的请求继续使用旧快照，不受影响
+func (r *Router) update(fn func(routes []config.RouteConfig) ([]config.RouteConfig, error)) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	for i, existingRoute := range r.routes {
-		if existingRoute.Path == route.Path && existingRoute.Method == route.Method {
-			r.routes[i] = route
-			return nil
-		}
+	current := r.snapshot().routes
+	routes := make([]config.RouteConfig, len(current), len(current)+1)
+	copy(routes, current)
+
+	routes, err := fn(routes)
+	if err != nil {
+		return err
 	}
-	return fmt.Errorf("route not found: %s %s", route.Method, route.Path)
+
+	table, err := buildTable(routes)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidRoute, err)
+	}
+	r.table.Store(table)
+	if r.onChange != nil {
+		r.onChange(table.routes)
+	}
+	return nil
 }
 
-// DeleteRoute 动态删除路由
-func (r *Router) DeleteRoute(path, method string) error {
+// OnChange 设置路由变更后的回调，回调在写锁内执行，不能修改 routes，也不能再修改路由
+func (r *Router) OnChange(fn func(routes []config.RouteConfig)) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
+	r.onChange = fn
+}
+
+// AddRoute 动态添加路由
+// 如果路由已存在（相同 ID，或未设置 ID 时相同 method、host 和 path），返回错误
+func (r *Router) AddRoute(route config.RouteConfig) error {
+	return r.update(func(routes []config.RouteConfig) ([]config.RouteConfig, error) {
+		// 检查路由是否已存在
+		for _, existingRoute := range routes {
+			if existingRoute.Key() == route.Key() {
+				return nil, fmt.Errorf("%w: %s", ErrRouteExists, route.Key())
+			}
+		}
+		// 深拷贝，避免调用方后续修改影响路由表
+		return append(routes, route.DeepCopy()), nil
+	})
+}
 
-	for i, route := range r.routes {
-		if route.Path == path && route.Method == method {
-			r.routes = append(r.routes[:i], r.routes[i+1:]...)
-			return nil
+// UpdateRoute 动态更新路由（根据 Key 匹配：ID，或 method + host + path）
+func (r *Router) UpdateRoute(route config.RouteConfig) error {
+	return r.update(func(routes []config.RouteConfig) ([]config.RouteConfig, error) {
+		for i, existingRoute := range routes {
+			if existingRoute.Key() == route.Key() {
+				routes[i] = route.DeepCopy()
+				return routes, nil
+			}
 		}
-	}
-	return fmt.Errorf("route not found: %s %s", method, path)
+		return nil, fmt.Errorf("%w: %s", ErrRouteNotFound, route.Key())
+	})
+}
+
+// DeleteRoute 动态删除路由（未设置 ID 和 host 的路由）
+func (r *Router) DeleteRoute(path, method string) error {
+	return r.RemoveRoute(config.RouteConfig{Path: path, Method: method})
+}
+
+// RemoveRoute 删除与 route 具有相同 Key 的路由
+func (r *Router) RemoveRoute(route config.RouteConfig) error {
+	return r.update(func(routes []config.RouteConfig) ([]config.RouteConfig, error) {
+		for i, existingRoute := range routes {
+			if existingRoute.Key() == route.Key() {
+				return append(routes[:i], routes[i+1:]...), nil
+			}
+		}
+		return nil, fmt.Errorf("%w: %s", ErrRouteNotFound, route.Key())
+	})
 }
 
 // GetAllRoutes 获取所有路由配置
 // 返回深拷贝，避免外部修改影响内部状态
 func (r *Router) GetAllRoutes() []config.RouteConfig {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
+	current := r.snapshot().routes
 
 	// 返回深拷贝，避免外部修改
-	routes := make([]config.RouteConfig, len(r.routes))
-	for i, route := range r.routes {
+	routes := make([]config.RouteConfig, len(current))
+	for i, route := range current {
 		routes[i] = route.DeepCopy()
 	}
 	return routes
 }
 
+// Match 匹配请求对应的路由
+// 返回的路由指向只读快照，调用方不得修改
 func (r *Router) Match(req *http.Request) (*config.RouteConfig, error) {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
-
-	for _, route := range r.routes {
-		if r.matchRoute(req, &route) {
-			// 返回深拷贝，避免并发修改 map 导致 panic
-			routeCopy := route.DeepCopy()
-			return &routeCopy, nil
-		}
-	}
-	return nil, fmt.Errorf("no matching route found for %s %s", req.Method, req.URL.Path)
+	route, _, err := r.MatchWithParams(req)
+	return route, err
 }
 
-func (r *Router) matchRoute(req *http.Request, route *config.RouteConfig) bool {
-	if route.Method != "" && !strings.EqualFold(route.Method, req.Method) {
-		return false
-	}
-
-	if route.Path == "" {
-		return false
-	}
+// MatchWithParams 匹配路由，同时返回从路径中提取的命名参数
+// 例如路由 /api/users/:id 匹配 /api/users/42 时返回 {"id": "42"}
+// 多条路由都能匹配时，Priority 大的路由优先；Priority 相同时最具体的路由优先（静态段 > 参数段 > 通配），
+// 同一路径下指定 Method、附加条件更多的路由优先，同等具体时按配置顺序；
+// PathRegex 路由在前缀树没有非通配路由命中时参与匹配，且优先于通配路由
+func (r *Router) MatchWithParams(req *http.Request) (*config.RouteConfig, map[string]string, error) {
+	table := r.snapshot()
 
-	if route.Path == req.URL.Path {
-		return true
+	e, params := table.match(req.URL.Path, acceptRequest(req))
+	if e == nil {
+		return nil, nil, fmt.Errorf("no matching route found for %s %s", req.Method, req.URL.Path)
 	}
+	return e.route, params, nil
+}
 
-	if strings.HasSuffix(route.Path, "*") {
-		prefix := strings.TrimSuffix(route.Path, "*")
-		return strings.HasPrefix(req.URL.Path, prefix)
+func acceptRequest(req *http.Request) func(*entry) bool {
+	return func(e *entry) bool {
+		if e.route.Method != "" && !strings.EqualFold(e.route.Method, req.Method) {
+			return false
+		}
+		return e.predicates.match(req)
 	}
-
-	return false
 }
 
 func (r *Router) GetBackendURL(route *config.RouteConfig) string {
@@ -123,13 +351,48 @@ func (r *Router) GetBackendURL(route *config.RouteConfig) string {
 	return r.defaultBackend
 }
 
-func (r *Router) GetBackendPath(route *config.RouteConfig, originalPath string) string {
+// GetBackendPath 计算转发到后端的路径
+// BackendPathRewrite 优先：先展开 $1 / ${name} 捕获组引用，再展开 {name} 路径参数
+// BackendPath 中的 {name} 或 {name...} 会被替换为匹配时提取的路径参数
+func (r *Router) GetBackendPath(route *config.RouteConfig, originalPath string, params map[string]string) string {
+	if route.BackendPathRewrite != "" {
+		return ExpandParams(expandCaptures(route.BackendPathRewrite, params), params)
+	}
 	if route.BackendPath != "" {
-		return route.BackendPath
+		return ExpandParams(route.BackendPath, params)
 	}
 	return originalPath
 }
 
+var paramPlaceholder = regexp.MustCompile(`\{(\w+)(?:\.\.\.)?\}`)
+
+var capturePlaceholder = regexp.MustCompile(`\$(\d+|\{\w+\})`)
+
+// expandCaptures 将模板中的 $1 / ${1} / ${name} 替换为捕获组的值，未知引用替换为空串（与 regexp.Expand 一致）
+func expandCaptures(template string, params map[string]string) string {
+	if !strings.Contains(template, "$") {
+		return template
+	}
+	return capturePlaceholder.ReplaceAllStringFunc(template, func(placeholder string) string {
+		name := strings.Trim(placeholder[1:], "{}")
+		return params[name]
+	})
+}
+
+// ExpandParams 将模板中的 {name} / {name...} 替换为对应参数值，未知参数保持原样
+func ExpandParams(template string, params map[string]string) string {
+	if len(params) == 0 || !strings.Contains(template, "{") {
+		return template
+	}
+	return paramPlaceholder.ReplaceAllStringFunc(template, func(placeholder string) string {
+		name := paramPlaceholder.FindStringSubmatch(placeholder)[1]
+		if value, ok := params[name]; ok {
+			return value
+		}
+		return placeholder
+	})
+}
+
 func (r *Router) GetBackendMethod(route *config.RouteConfig, originalMethod string) string {
 	if route.BackendMethod != "" {
 		return route.BackendMethod
@@ -1,7 +1,10 @@
 package router
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 	"sync"
 	"testing"
 
@@ -108,8 +111,34 @@ func TestAddRouteDuplication(t *testing.T) {
 	}
 }
 
-// TestDeepCopy 测试深拷贝功能
-func TestDeepCopy(t *testing.T) {
+// TestNewRouterDuplication 配置中 Key 重复的路由只保留先出现的一条
+func TestNewRouterDuplication(t *testing.T) {
+	router := NewRouter([]config.RouteConfig{
+		{Path: "/api/users", Method: "GET", BackendURL: "http://first"},
+		{Path: "/api/users", Method: "GET", BackendURL: "http://second", Headers: map[string]string{"X-Version": "2"}},
+		{ID: "users-v2", Path: "/api/users", Method: "GET", BackendURL: "http://third", Headers: map[string]string{"X-Version": "2"}},
+	}, "http://localhost:9090")
+
+	routes := router.GetAllRoutes()
+	if len(routes) != 2 {
+		t.Fatalf("Expected 2 routes, got %d", len(routes))
+	}
+	if routes[0].BackendURL != "http://first" || routes[1].ID != "users-v2" {
+		t.Errorf("Expected the first duplicate and the route with its own ID to be kept, got %+v", routes)
+	}
+
+	// 保留的路由可以按 Key 删除
+	if err := router.DeleteRoute("/api/users", "GET"); err != nil {
+		t.Fatalf("DeleteRoute failed: %v", err)
+	}
+	if routes := router.GetAllRoutes(); len(routes) != 1 || routes[0].ID != "users-v2" {
+		t.Errorf("Expected only users-v2 after delete, got %+v", routes)
+	}
+}
+
+// TestRouteIsolation 测试路由快照与外部数据隔离
+// Match 直接返回只读快照，隔离由写入时和 GetAllRoutes 的深拷贝保证
+func TestRouteIsolation(t *testing.T) {
 	routes := []config.RouteConfig{
 		{
 			Path:       "/api/test",
@@ -124,21 +153,420 @@ func TestDeepCopy(t *testing.T) {
 
 	router := NewRouter(routes, "http://localhost:9090")
 
-	// 获取路由配置
+	// 修改传入 NewRouter 的配置
+	routes[0].ResponseTransform["code"] = "500"
+
+	// 修改 GetAllRoutes 返回的配置
+	all := router.GetAllRoutes()
+	all[0].ResponseTransform["new_field"] = "added"
+
+	// 修改传入 AddRoute 的配置
+	added := config.RouteConfig{
+		Path:              "/api/added",
+		Method:            "GET",
+		ResponseTransform: map[string]interface{}{"code": "200"},
+	}
+	if err := router.AddRoute(added); err != nil {
+		t.Fatalf("AddRoute failed: %v", err)
+	}
+	added.ResponseTransform["code"] = "500"
+
 	req, _ := http.NewRequest("GET", "/api/test", nil)
-	route1, _ := router.Match(req)
-	route2, _ := router.Match(req)
+	route, _ := router.Match(req)
+	if route.ResponseTransform["code"] != "200" {
+		t.Error("Route isolation failed: NewRouter input modification leaked into route table")
+	}
+	if _, exists := route.ResponseTransform["new_field"]; exists {
+		t.Error("Route isolation failed: GetAllRoutes modification leaked into route table")
+	}
+
+	req, _ = http.NewRequest("GET", "/api/added", nil)
+	route, _ = router.Match(req)
+	if route.ResponseTransform["code"] != "200" {
+		t.Error("Route isolation failed: AddRoute input modification leaked into route table")
+	}
+}
+
+// TestOnChange 测试路由变更回调
+func TestOnChange(t *testing.T) {
+	router := NewRouter([]config.RouteConfig{{Path: "/a", Method: "GET"}}, "http://localhost:9090")
+	var got []config.RouteConfig
+	router.OnChange(func(routes []config.RouteConfig) { got = routes })
+
+	if err := router.RemoveRoute(config.RouteConfig{Path: "/a", Method: "GET"}); err != nil {
+		t.Fatalf("RemoveRoute failed: %v", err)
+	}
+	if got == nil || len(got) != 0 {
+		t.Errorf("Expected callback with no routes, got %v", got)
+	}
+	if err := router.AddRoute(config.RouteConfig{Path: "/b", Method: "GET"}); err != nil {
+		t.Fatalf("AddRoute failed: %v", err)
+	}
+	if len(got) != 1 || got[0].Path != "/b" {
+		t.Errorf("Expected callback with /b, got %v", got)
+	}
+
+	// 失败的修改不触发回调
+	got = nil
+	router.AddRoute(config.RouteConfig{Path: "/b", Method: "GET"})
+	if got != nil {
+		t.Errorf("Failed update should not trigger callback, got %v", got)
+	}
+}
+
+// TestPathParams 测试命名路径参数的提取
+func TestPathParams(t *testing.T) {
+	routes := []config.RouteConfig{
+		{Path: "/api/users/:id/orders/{orderId}", Method: "GET"},
+		{Path: "/files/{rest...}", Method: "GET"},
+	}
+	router := NewRouter(routes, "http://localhost:9090")
+
+	req, _ := http.NewRequest("GET", "/api/users/42/orders/1001", nil)
+	route, params, err := router.MatchWithParams(req)
+	if err != nil {
+		t.Fatalf("MatchWithParams failed: %v", err)
+	}
+	if route.Path != "/api/users/:id/orders/{orderId}" {
+		t.Errorf("Unexpected route matched: %s", route.Path)
+	}
+	if params["id"] != "42" || params["orderId"] != "1001" {
+		t.Errorf("Unexpected params: %v", params)
+	}
+
+	req, _ = http.NewRequest("GET", "/files/docs/2024/report.pdf", nil)
+	_, params, err = router.MatchWithParams(req)
+	if err != nil {
+		t.Fatalf("Catch-all match failed: %v", err)
+	}
+	if params["rest"] != "docs/2024/report.pdf" {
+		t.Errorf("Expected rest to be 'docs/2024/report.pdf', got %q", params["rest"])
+	}
+
+	// 参数段不能为空，段数必须一致
+	for _, path := range []string{"/api/users//orders/1", "/api/users/42/orders", "/api/users/42/orders/1/x", "/files"} {
+		req, _ = http.NewRequest("GET", path, nil)
+		if _, _, err := router.MatchWithParams(req); err == nil {
+			t.Errorf("Expected %s not to match", path)
+		}
+	}
+}
+
+// TestBackendPathParams 测试 BackendPath 中的参数替换
+func TestBackendPathParams(t *testing.T) {
+	router := NewRouter(nil, "http://localhost:9090")
+	route := &config.RouteConfig{BackendPath: "/v1/users/{id}/files/{rest...}/{unknown}"}
 
-	// 修改第一个返回的配置
-	route1.ResponseTransform["code"] = "500"
-	route1.ResponseTransform["new_field"] = "added"
+	got := router.GetBackendPath(route, "/api/users/7", map[string]string{"id": "7", "rest": "a/b"})
+	if got != "/v1/users/7/files/a/b/{unknown}" {
+		t.Errorf("Unexpected backend path: %s", got)
+	}
 
-	// 验证第二个返回的配置没有被修改
-	if route2.ResponseTransform["code"] != "200" {
-		t.Error("Deep copy failed: modifications affected other copies")
+	if got := router.GetBackendPath(&config.RouteConfig{}, "/original", nil); got != "/original" {
+		t.Errorf("Expected original path, got %s", got)
 	}
+}
 
-	if _, exists := route2.ResponseTransform["new_field"]; exists {
-		t.Error("Deep copy failed: new field appeared in other copies")
+// TestMatchPrecedence 测试最具体路由优先的匹配规则
+func TestMatchPrecedence(t *testing.T) {
+	routes := []config.RouteConfig{
+		{Path: "/*", BackendURL: "root-wildcard"},
+		{Path: "/api/*", BackendURL: "api-wildcard"},
+		{Path: "/api/v*", BackendURL: "api-v-prefix"},
+		{Path: "/api/{rest...}", Method: "GET", BackendURL: "api-catch-all"},
+		{Path: "/api/users/:id", BackendURL: "user-any-method"},
+		{Path: "/api/users/:id", Method: "GET", BackendURL: "user-get"},
+		{Path: "/api/users/me", BackendURL: "user-me"},
+	}
+	router := NewRouter(routes, "http://localhost:9090")
+
+	cases := []struct {
+		method, path, expected string
+	}{
+		{"GET", "/api/users/me", "user-me"},
+		{"GET", "/api/users/42", "user-get"},
+		{"POST", "/api/users/42", "user-any-method"},
+		{"GET", "/api/orders", "api-catch-all"},
+		{"POST", "/api/v2/orders", "api-v-prefix"},
+		{"POST", "/api/orders", "api-wildcard"},
+		{"POST", "/api", "root-wildcard"},
+		{"GET", "/", "root-wildcard"},
+	}
+	for _, c := range cases {
+		req, _ := http.NewRequest(c.method, c.path, nil)
+		route, err := router.Match(req)
+		if err != nil {
+			t.Errorf("%s %s: unexpected error: %v", c.method, c.path, err)
+			continue
+		}
+		if route.BackendURL != c.expected {
+			t.Errorf("%s %s: expected %s, got %s", c.method, c.path, c.expected, route.BackendURL)
+		}
+	}
+}
+
+// TestInvalidRoute 测试非法路由路径被拒绝
+func TestInvalidRoute(t *testing.T) {
+	router := NewRouter([]config.RouteConfig{{Path: "/files/{rest...}/x"}}, "http://localhost:9090")
+	if len(router.GetAllRoutes()) != 0 {
+		t.Error("Invalid route from config should be skipped")
+	}
+
+	err := router.AddRoute(config.RouteConfig{Path: "/files/{rest...}/x", Method: "GET"})
+	if !errors.Is(err, ErrInvalidRoute) {
+		t.Errorf("Expected ErrInvalidRoute, got %v", err)
+	}
+
+	err = router.AddRoute(config.RouteConfig{
+		Path:            "/headers",
+		Method:          "GET",
+		ResponseHeaders: &config.HeaderTransformConfig{Set: map[string]interface{}{"X Bad": "1"}},
+	})
+	if !errors.Is(err, ErrInvalidRoute) {
+		t.Errorf("Invalid header name should be rejected, got %v", err)
+	}
+
+	err = router.AddRoute(config.RouteConfig{Path: "/coalesce", Method: "GET", Coalesce: true, BodyMode: config.BodyModeStreaming})
+	if !errors.Is(err, ErrInvalidRoute) {
+		t.Errorf("Coalescing with streaming body mode should be rejected, got %v", err)
+	}
+
+	err = router.AddRoute(config.RouteConfig{Path: "/mirror", Method: "GET", Mirror: &config.MirrorConfig{Enabled: true, Percentage: 150}})
+	if !errors.Is(err, ErrInvalidRoute) {
+		t.Errorf("Mirror without target should be rejected, got %v", err)
+	}
+
+	err = router.AddRoute(config.RouteConfig{Path: "/aggregate", Method: "GET", Aggregate: &config.AggregateConfig{Calls: []config.AggregateCall{
+		{Name: "a", Path: "/a", DependsOn: []string{"b"}},
+		{Name: "b", Path: "/b", DependsOn: []string{"a"}},
+	}}})
+	if !errors.Is(err, ErrInvalidRoute) {
+		t.Errorf("Aggregate dependency cycle should be rejected, got %v", err)
+	}
+
+	err = router.AddRoute(config.RouteConfig{Path: "/old", Method: "GET", Respond: &config.RespondConfig{Redirect: "/new", Status: 200}})
+	if !errors.Is(err, ErrInvalidRoute) {
+		t.Errorf("Redirect with non-3xx status should be rejected, got %v", err)
+	}
+}
+
+func benchmarkRoutes(n int) []config.RouteConfig {
+	routes := make([]config.RouteConfig, 0, n)
+	for i := 0; i < n; i++ {
+		routes = append(routes, config.RouteConfig{
+			Path:              fmt.Sprintf("/api/service%d/users/:id", i),
+			Method:            "GET",
+			ResponseTransform: map[string]interface{}{"data": "$.data"},
+		})
+	}
+	return routes
+}
+
+// BenchmarkMatch 在 5000 条路由中匹配最后一条
+func BenchmarkMatch(b *testing.B) {
+	router := NewRouter(benchmarkRoutes(5000), "http://localhost:9090")
+	req, _ := http.NewRequest("GET", "/api/service4999/users/42", nil)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := router.MatchWithParams(req); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkLinearScanBaseline 模拟旧实现：逐条按段比较 + 每次命中深拷贝，用于对比
+func BenchmarkLinearScanBaseline(b *testing.B) {
+	routes := benchmarkRoutes(5000)
+	req, _ := http.NewRequest("GET", "/api/service4999/users/42", nil)
+
+	linearMatch := func(pattern, path string) bool {
+		patternSegs, pathSegs := splitPath(pattern), splitPath(path)
+		if len(patternSegs) != len(pathSegs) {
+			return false
+		}
+		for i, seg := range patternSegs {
+			if _, ok := paramName(seg); !ok && seg != pathSegs[i] {
+				return false
+			}
+		}
+		return true
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var matched *config.RouteConfig
+		for j := range routes {
+			if strings.EqualFold(routes[j].Method, req.Method) && linearMatch(routes[j].Path, req.URL.Path) {
+				routeCopy := routes[j].DeepCopy()
+				matched = &routeCopy
+				break
+			}
+		}
+		if matched == nil {
+			b.Fatal("no route matched")
+		}
+	}
+}
+
+// TestRoutePredicates 测试 host / header / query / content-type 匹配条件
+func TestRoutePredicates(t *testing.T) {
+	routes := []config.RouteConfig{
+		{Path: "/api/items", BackendURL: "default"},
+		{Path: "/api/items", Host: "*.tenant-a.example.com", BackendURL: "tenant-a"},
+		{ID: "items-v2", Path: "/api/items", Headers: map[string]string{"x-api-version": "2"}, BackendURL: "v2"},
+		{ID: "items-beta", Path: "/api/items", Query: map[string]string{"beta": ""}, BackendURL: "beta"},
+		{ID: "items-json", Path: "/api/items", Method: "POST", ContentType: "application/json", BackendURL: "json"},
+		{ID: "items-trace", Path: "/api/items", Headers: map[string]string{"X-Trace-Id": "~^[0-9a-f]{8}$"}, BackendURL: "trace"},
+	}
+	router := NewRouter(routes, "http://localhost:9090")
+
+	cases := []struct {
+		name     string
+		setup    func(req *http.Request)
+		method   string
+		target   string
+		expected string
+	}{
+		{"no predicates", nil, "GET", "/api/items", "default"},
+		{"wildcard host", func(req *http.Request) { req.Host = "api.tenant-a.example.com:8080" }, "GET", "/api/items", "tenant-a"},
+		{"wildcard host excludes apex", func(req *http.Request) { req.Host = "tenant-a.example.com" }, "GET", "/api/items", "default"},
+		{"header exact", func(req *http.Request) { req.Header.Set("X-Api-Version", "2") }, "GET", "/api/items", "v2"},
+		{"header mismatch", func(req *http.Request) { req.Header.Set("X-Api-Version", "3") }, "GET", "/api/items", "default"},
+		{"query presence", nil, "GET", "/api/items?beta", "beta"},
+		{"content type", func(req *http.Request) { req.Header.Set("Content-Type", "application/json; charset=utf-8") }, "POST", "/api/items", "json"},
+		{"header regex", func(req *http.Request) { req.Header.Set("X-Trace-Id", "deadbeef") }, "GET", "/api/items", "trace"},
+		{"header regex mismatch", func(req *http.Request) { req.Header.Set("X-Trace-Id", "nothex!!") }, "GET", "/api/items", "default"},
+	}
+	for _, c := range cases {
+		req, _ := http.NewRequest(c.method, c.target, nil)
+		if c.setup != nil {
+			c.setup(req)
+		}
+		route, err := router.Match(req)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.name, err)
+			continue
+		}
+		if route.BackendURL != c.expected {
+			t.Errorf("%s: expected %s, got %s", c.name, c.expected, route.BackendURL)
+		}
+	}
+
+	// 无 ID 时 host 参与路由标识，同一 path + method 可以按 host 区分
+	if err := router.AddRoute(config.RouteConfig{Path: "/api/items", Host: "b.example.com"}); err != nil {
+		t.Errorf("AddRoute with different host should succeed: %v", err)
+	}
+	if err := router.RemoveRoute(config.RouteConfig{ID: "items-v2"}); err != nil {
+		t.Errorf("RemoveRoute by ID failed: %v", err)
+	}
+
+	err := router.AddRoute(config.RouteConfig{ID: "bad", Path: "/x", Headers: map[string]string{"X": "~("}})
+	if !errors.Is(err, ErrInvalidRoute) {
+		t.Errorf("Expected ErrInvalidRoute for bad regex, got %v", err)
+	}
+}
+
+// TestPathRegex 测试正则路由与捕获组重写
+func TestPathRegex(t *testing.T) {
+	routes := []config.RouteConfig{
+		{Path: "/*", BackendURL: "fallback"},
+		{Path: "/legacy/health", BackendURL: "health"},
+		{PathRegex: "/legacy/(.*)", BackendPathRewrite: "/v2/$1", BackendURL: "legacy"},
+		{PathRegex: `/orders/(?P<year>\d{4})/(?P<id>\d+)`, BackendPathRewrite: "/v2/orders/${id}?year=${year}", BackendURL: "orders"},
+	}
+	router := NewRouter(routes, "http://localhost:9090")
+
+	cases := []struct {
+		path, expectedBackend, expectedPath string
+	}{
+		{"/legacy/users/1", "legacy", "/v2/users/1"},
+		{"/legacy/health", "health", "/legacy/health"},
+		{"/orders/2024/77", "orders", "/v2/orders/77?year=2024"},
+		{"/orders/24/77", "fallback", "/orders/24/77"},
+	}
+	for _, c := range cases {
+		req, _ := http.NewRequest("GET", c.path, nil)
+		route, params, err := router.MatchWithParams(req)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.path, err)
+			continue
+		}
+		if route.BackendURL != c.expectedBackend {
+			t.Errorf("%s: expected backend %s, got %s", c.path, c.expectedBackend, route.BackendURL)
+		}
+		if got := router.GetBackendPath(route, c.path, params); got != c.expectedPath {
+			t.Errorf("%s: expected backend path %s, got %s", c.path, c.expectedPath, got)
+		}
+	}
+
+	err := router.AddRoute(config.RouteConfig{Path: "/x", PathRegex: "/x"})
+	if !errors.Is(err, ErrInvalidRoute) {
+		t.Errorf("Expected ErrInvalidRoute when both path and pathRegex are set, got %v", err)
+	}
+}
+
+// TestRoutePriority 测试显式优先级覆盖具体程度规则
+func TestRoutePriority(t *testing.T) {
+	router := NewRouter([]config.RouteConfig{
+		{Path: "/api/*", BackendURL: "wildcard"},
+	}, "http://localhost:9090")
+
+	// 动态添加的具体路由默认优先于通配路由
+	if err := router.AddRoute(config.RouteConfig{Path: "/api/users", BackendURL: "users"}); err != nil {
+		t.Fatalf("AddRoute failed: %v", err)
+	}
+	req, _ := http.NewRequest("GET", "/api/users", nil)
+	if route, _ := router.Match(req); route.BackendURL != "users" {
+		t.Errorf("Expected specific route to win, got %s", route.BackendURL)
+	}
+
+	// 提高通配路由的优先级后，通配路由胜出
+	if err := router.UpdateRoute(config.RouteConfig{Path: "/api/*", Priority: 10, BackendURL: "wildcard"}); err != nil {
+		t.Fatalf("UpdateRoute failed: %v", err)
+	}
+	if route, _ := router.Match(req); route.BackendURL != "wildcard" {
+		t.Errorf("Expected high priority route to win, got %s", route.BackendURL)
+	}
+
+	candidates := router.Explain(req)
+	if len(candidates) != 2 {
+		t.Fatalf("Expected 2 candidates, got %d", len(candidates))
+	}
+	if candidates[0].Key != " /api/users" || candidates[0].Selected {
+		t.Errorf("Unexpected first candidate: %+v", candidates[0])
+	}
+	if candidates[1].Key != " /api/*" || !candidates[1].Selected {
+		t.Errorf("Unexpected second candidate: %+v", candidates[1])
+	}
+}
+
+// TestRouteConflicts 测试遮蔽和重叠路由检测
+func TestRouteConflicts(t *testing.T) {
+	router := NewRouter([]config.RouteConfig{
+		{Path: "/api/*", Method: "GET", Priority: 10},
+		{Path: "/api/users", Method: "GET"},
+		{Path: "/a/:x", Method: "POST"},
+		{Path: "/:y/b", Method: "POST"},
+		{Path: "/docs/*", Method: "GET"},
+		{Path: "/docs/intro"},
+		{Path: "/tenant", Host: "a.example.com"},
+		{Path: "/tenant", Host: "b.example.com"},
+	}, "http://localhost:9090")
+
+	conflicts := router.Conflicts()
+	expected := []Conflict{
+		{Type: ConflictShadowed, Route: "GET /api/users", Winner: "GET /api/*"},
+		{Type: ConflictOverlap, Route: "POST /:y/b", Winner: "POST /a/:x"},
+	}
+	if len(conflicts) != len(expected) {
+		t.Fatalf("Expected %d conflicts, got %+v", len(expected), conflicts)
+	}
+	for i := range expected {
+		if conflicts[i] != expected[i] {
+			t.Errorf("Expected conflict %+v, got %+v", expected[i], conflicts[i])
+		}
 	}
 }
@@ -0,0 +1,374 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ruke318/gateway/config"
+)
+
+// routeTable 是路由的不可变快照
+// 每次 AddRoute/UpdateRoute/DeleteRoute 都会重建整张表并原子替换，
+// 匹配过程无需加锁，也无需再对命中的路由做深拷贝
+type routeTable struct {
+	routes      []config.RouteConfig
+	root        *node
+	regexes     []*entry // PathRegex 路由，优先级低于前缀树中的非通配路由、高于通配路由
+	maxPriority int
+}
+
+// node 是按路径段组织的前缀树节点
+// 匹配优先级（从高到低）：静态段 > 参数段 > {name...} 通配段 > 末尾 * 前缀通配
+type node struct {
+	static   map[string]*node
+	param    *node
+	entries  []*entry // 路径恰好在此节点结束的路由
+	catchAll []*entry // {name...} 通配段位于此节点之后的路由
+	prefixes []*entry // 末尾 * 前缀通配路由，按 prefix 长度降序
+}
+
+// entry 是挂在树节点上的一条路由
+type entry struct {
+	route        *config.RouteConfig
+	order        int
+	predicates   *predicates
+	regex        *regexp.Regexp // PathRegex 路由的预编译正则
+	paramNames   []string       // 按出现顺序记录参数名，同一位置的参数在不同路由中可以同名或不同名
+	catchAllName string
+	prefix       string // 前缀通配路由在最后一个完整段之后剩余的部分，例如 /api/v* 中的 "v"
+}
+
+type segmentKind int
+
+const (
+	segmentStatic segmentKind = iota
+	segmentParam
+	segmentCatchAll
+)
+
+type segment struct {
+	kind  segmentKind
+	value string // 静态段的字面量或参数名
+}
+
+// pattern 是解析后的路由路径
+type pattern struct {
+	segments []segment
+	wildcard bool   // 是否为末尾 * 前缀通配
+	prefix   string // 前缀通配的不完整末段
+}
+
+// parsePattern 解析路由路径，校验通配参数的位置
+func parsePattern(path string) (*pattern, error) {
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("route path must start with '/': %q", path)
+	}
+
+	p := &pattern{}
+	rest := path
+	if strings.HasSuffix(path, "*") {
+		p.wildcard = true
+		rest = strings.TrimSuffix(path, "*")
+		idx := strings.LastIndex(rest, "/")
+		p.prefix = rest[idx+1:]
+		rest = rest[:idx]
+		if rest == "" {
+			return p, nil
+		}
+	}
+
+	segs := splitPath(rest)
+	for i, seg := range segs {
+		if name, ok := catchAllName(seg); ok {
+			if i != len(segs)-1 || p.wildcard {
+				return nil, fmt.Errorf("catch-all parameter {%s...} must be the last segment: %q", name, path)
+			}
+			p.segments = append(p.segments, segment{kind: segmentCatchAll, value: name})
+			continue
+		}
+		if name, ok := paramName(seg); ok {
+			p.segments = append(p.segments, segment{kind: segmentParam, value: name})
+			continue
+		}
+		p.segments = append(p.segments, segment{kind: segmentStatic, value: seg})
+	}
+	return p, nil
+}
+
+// buildTable 根据路由列表构建不可变路由表
+// routes 必须已经是调用方独占的副本，构建后不再修改
+func buildTable(routes []config.RouteConfig) (*routeTable, error) {
+	t := &routeTable{
+		routes: routes,
+		root:   &node{},
+	}
+
+	for i := range routes {
+		route := &routes[i]
+		if i == 0 || route.Priority > t.maxPriority {
+			t.maxPriority = route.Priority
+		}
+		if err := validateRoute(route); err != nil {
+			return nil, fmt.Errorf("route %s: %w", route.Key(), err)
+		}
+		preds, err := compilePredicates(route)
+		if err != nil {
+			return nil, fmt.Errorf("route %s: %w", route.Key(), err)
+		}
+		e := &entry{route: route, order: i, predicates: preds}
+
+		if route.PathRegex != "" {
+			if e.regex, err = compilePathRegex(route); err != nil {
+				return nil, err
+			}
+			t.regexes = insertEntry(t.regexes, e, nil)
+			continue
+		}
+
+		if route.Path == "" {
+			continue
+		}
+		p, err := parsePattern(route.Path)
+		if err != nil {
+			return nil, err
+		}
+		t.root.insert(p, e)
+	}
+	return t, nil
+}
+
+// compilePathRegex 编译 PathRegex，整体锚定以匹配完整路径
+func compilePathRegex(route *config.RouteConfig) (*regexp.Regexp, error) {
+	if route.Path != "" {
+		return nil, errors.New("path and pathRegex are mutually exclusive")
+	}
+	regex, err := regexp.Compile("^(?:" + route.PathRegex + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid pathRegex: %w", err)
+	}
+	return regex, nil
+}
+
+// candidate 是一条能匹配请求的路由及其参数
+type candidate struct {
+	entry  *entry
+	params map[string]string
+}
+
+// match 返回优先级最高的候选路由；优先级相同时按 each 的遍历顺序取第一个
+func (t *routeTable) match(path string, accept func(*entry) bool) (*entry, map[string]string) {
+	var best *candidate
+	t.each(path, accept, func(c candidate) bool {
+		if best == nil || c.entry.route.Priority > best.entry.route.Priority {
+			best = &c
+		}
+		// 已经是最高优先级，后续候选不可能胜出
+		return best.entry.route.Priority < t.maxPriority
+	})
+	if best == nil {
+		return nil, nil
+	}
+	return best.entry, best.params
+}
+
+// each 按具体程度从高到低遍历所有能匹配 path 的路由，emit 返回 false 时停止
+// 顺序为前缀树的回溯顺序，正则路由插在第一个通配路由之前
+func (t *routeTable) each(path string, accept func(*entry) bool, emit func(candidate) bool) {
+	regexDone := false
+	emitRegexes := func() bool {
+		regexDone = true
+		for _, re := range t.regexes {
+			if !accept(re) {
+				continue
+			}
+			if captures := re.regex.FindStringSubmatch(path); captures != nil {
+				if !emit(candidate{entry: re, params: regexParams(re.regex, captures)}) {
+					return false
+				}
+			}
+		}
+		return true
+	}
+
+	completed := t.root.collect(splitPath(path), 0, nil, accept, func(e *entry, values []string) bool {
+		if e.wildcard() && !regexDone && !emitRegexes() {
+			return false
+		}
+		return emit(candidate{entry: e, params: e.params(values)})
+	})
+	if completed && !regexDone {
+		emitRegexes()
+	}
+}
+
+// regexParams 将捕获组转为参数：编号组以 "1"、"2" 为键，命名组同时以组名为键
+func regexParams(regex *regexp.Regexp, captures []string) map[string]string {
+	params := make(map[string]string, len(captures)-1)
+	for i, name := range regex.SubexpNames() {
+		if i == 0 {
+			continue
+		}
+		params[strconv.Itoa(i)] = captures[i]
+		if name != "" {
+			params[name] = captures[i]
+		}
+	}
+	return params
+}
+
+func (n *node) insert(p *pattern, e *entry) {
+	current := n
+	for _, seg := range p.segments {
+		switch seg.kind {
+		case segmentStatic:
+			if current.static == nil {
+				current.static = make(map[string]*node)
+			}
+			child, ok := current.static[seg.value]
+			if !ok {
+				child = &node{}
+				current.static[seg.value] = child
+			}
+			current = child
+		case segmentParam:
+			e.paramNames = append(e.paramNames, seg.value)
+			if current.param == nil {
+				current.param = &node{}
+			}
+			current = current.param
+		case segmentCatchAll:
+			e.catchAllName = seg.value
+			current.catchAll = insertEntry(current.catchAll, e, nil)
+			return
+		}
+	}
+
+	if p.wildcard {
+		e.prefix = p.prefix
+		current.prefixes = insertEntry(current.prefixes, e, func(a, b *entry) bool {
+			return len(a.prefix) > len(b.prefix)
+		})
+		return
+	}
+	current.entries = insertEntry(current.entries, e, nil)
+}
+
+// insertEntry 按优先级插入：先比较 less（可选），再让指定了 Method 的路由排在不限 Method 的路由之前，
+// 然后附加条件多的路由优先，最后按配置顺序
+func insertEntry(list []*entry, e *entry, less func(a, b *entry) bool) []*entry {
+	idx := len(list)
+	for i, existing := range list {
+		if entryBefore(e, existing, less) {
+			idx = i
+			break
+		}
+	}
+	list = append(list, nil)
+	copy(list[idx+1:], list[idx:])
+	list[idx] = e
+	return list
+}
+
+func entryBefore(a, b *entry, less func(a, b *entry) bool) bool {
+	if less != nil {
+		if less(a, b) {
+			return true
+		}
+		if less(b, a) {
+			return false
+		}
+	}
+	if (a.route.Method != "") != (b.route.Method != "") {
+		return a.route.Method != ""
+	}
+	if ca, cb := a.predicates.count(), b.predicates.count(); ca != cb {
+		return ca > cb
+	}
+	return a.order < b.order
+}
+
+// collect 在树上做回溯遍历，按最具体优先的顺序对每个满足 accept 的路由调用 emit
+// emit 返回 false 时停止遍历，此时 collect 也返回 false
+// values 按位置收集参数值，回溯时会被复用，emit 需要在返回前消费
+func (n *node) collect(segs []string, i int, values []string, accept func(*entry) bool, emit func(*entry, []string) bool) bool {
+	if i == len(segs) {
+		for _, e := range n.entries {
+			if accept(e) && !emit(e, values) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if child, ok := n.static[segs[i]]; ok {
+		if !child.collect(segs, i+1, values, accept, emit) {
+			return false
+		}
+	}
+
+	if n.param != nil && segs[i] != "" {
+		if !n.param.collect(segs, i+1, append(values, segs[i]), accept, emit) {
+			return false
+		}
+	}
+
+	if len(n.catchAll) > 0 || len(n.prefixes) > 0 {
+		rest := strings.Join(segs[i:], "/")
+		for _, e := range n.catchAll {
+			if accept(e) && !emit(e, append(values, rest)) {
+				return false
+			}
+		}
+		for _, e := range n.prefixes {
+			if strings.HasPrefix(rest, e.prefix) && accept(e) && !emit(e, values) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// wildcard 判断是否为通配路由（{name...} 或末尾 *）
+func (e *entry) wildcard() bool {
+	return e.catchAllName != "" || strings.HasSuffix(e.route.Path, "*")
+}
+
+// params 将按位置收集的参数值映射为参数名
+func (e *entry) params(values []string) map[string]string {
+	params := make(map[string]string, len(values))
+	for i, name := range e.paramNames {
+		params[name] = values[i]
+	}
+	if e.catchAllName != "" {
+		params[e.catchAllName] = values[len(values)-1]
+	}
+	return params
+}
+
+// splitPath 去掉开头的 "/" 后按 "/" 切分，保留末尾空段以区分 /a 与 /a/
+func splitPath(path string) []string {
+	return strings.Split(strings.TrimPrefix(path, "/"), "/")
+}
+
+// paramName 解析 :name 或 {name} 形式的路径参数
+func paramName(seg string) (string, bool) {
+	if len(seg) > 1 && seg[0] == ':' {
+		return seg[1:], true
+	}
+	if len(seg) > 2 && seg[0] == '{' && seg[len(seg)-1] == '}' && !strings.HasSuffix(seg, "...}") {
+		return seg[1 : len(seg)-1], true
+	}
+	return "", false
+}
+
+// catchAllName 解析 {name...} 形式的通配参数
+func catchAllName(seg string) (string, bool) {
+	if len(seg) > 5 && seg[0] == '{' && strings.HasSuffix(seg, "...}") {
+		return seg[1 : len(seg)-4], true
+	}
+	return "", false
+}
@@ -0,0 +1,92 @@
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/ruke318/gateway/config"
+)
+
+// TransformHeaders 按 requestHeaders/responseHeaders 配置改写 Header，返回新的 Header，不修改 headers
+// body 供 "$.xxx" 表达式取值；不是 JSON 时 "$.xxx" 取不到值
+func (t *DSLTransformer) TransformHeaders(headers http.Header, cfg *config.HeaderTransformConfig, body []byte, contextData map[string]interface{}) (http.Header, error) {
+	result := headers.Clone()
+	if result == nil {
+		result = make(http.Header)
+	}
+	if cfg == nil {
+		return result, nil
+	}
+
+	for _, name := range cfg.Remove {
+		result.Del(name)
+	}
+
+	// 按名称排序，保证多个 Header 改成同一个名字时结果稳定
+	names := make([]string, 0, len(cfg.Rename))
+	for from := range cfg.Rename {
+		names = append(names, from)
+	}
+	sort.Strings(names)
+	for _, from := range names {
+		to := http.CanonicalHeaderKey(cfg.Rename[from])
+		from = http.CanonicalHeaderKey(from)
+		values, ok := result[from]
+		if !ok || to == from {
+			continue
+		}
+		delete(result, from)
+		result[to] = append(result[to], values...)
+	}
+
+	if len(cfg.Set) == 0 && len(cfg.Append) == 0 {
+		return result, nil
+	}
+
+	var sourceData interface{}
+	if len(body) > 0 {
+		json.Unmarshal(body, &sourceData)
+	}
+	eval := func(name string, expr interface{}) ([]string, error) {
+		value, err := t.processValue(sourceData, expr, contextData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to process header %s: %w", name, err)
+		}
+		values, err := queryValues(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to process header %s: %w", name, err)
+		}
+		for _, v := range values {
+			if strings.ContainsAny(v, "\r\n") {
+				return nil, fmt.Errorf("invalid value for header %s: contains line break", name)
+			}
+		}
+		return values, nil
+	}
+
+	for name, expr := range cfg.Set {
+		values, err := eval(name, expr)
+		if err != nil {
+			return nil, err
+		}
+		if len(values) == 0 {
+			continue
+		}
+		result[http.CanonicalHeaderKey(name)] = values
+	}
+	for name, expr := range cfg.Append {
+		values, err := eval(name, expr)
+		if err != nil {
+			return nil, err
+		}
+		if len(values) == 0 {
+			continue
+		}
+		key := http.CanonicalHeaderKey(name)
+		result[key] = append(result[key], values...)
+	}
+	return result, nil
+}
@@ -0,0 +1,67 @@
+package transform
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/ruke318/gateway/config"
+)
+
+func TestDSLTransformer_TransformHeaders(t *testing.T) {
+	transformer := NewDSLTransformer()
+
+	headers := http.Header{
+		"X-Debug":     {"1"},
+		"X-User":      {"alice"},
+		"Accept":      {"text/html"},
+		"X-Forwarded": {"a", "b"},
+	}
+	body := []byte(`{"tenant": {"id": 42}, "roles": ["admin", "dev"]}`)
+	contextData := map[string]interface{}{"route": map[string]interface{}{"id": "users"}}
+
+	cfg := &config.HeaderTransformConfig{
+		Remove: []string{"x-debug"},
+		Rename: map[string]string{"x-user": "X-Backend-User", "x-forwarded": "X-Trace"},
+		Set: map[string]interface{}{
+			"x-tenant-id": "$.tenant.id",
+			"X-Route":     "@ctx.route.id",
+			"X-Source":    "gateway",
+			"X-Missing":   "$.missing",
+		},
+		Append: map[string]interface{}{
+			"Accept":  "application/json",
+			"X-Roles": "$.roles",
+		},
+	}
+
+	result, err := transformer.TransformHeaders(headers, cfg, body, contextData)
+	if err != nil {
+		t.Fatalf("TransformHeaders failed: %v", err)
+	}
+
+	expected := http.Header{
+		"X-Backend-User": {"alice"},
+		"X-Trace":        {"a", "b"},
+		"X-Tenant-Id":    {"42"},
+		"X-Route":        {"users"},
+		"X-Source":       {"gateway"},
+		"Accept":         {"text/html", "application/json"},
+		"X-Roles":        {"admin", "dev"},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+	if headers.Get("X-Debug") != "1" || len(headers["Accept"]) != 1 {
+		t.Error("Original headers should not be modified")
+	}
+}
+
+func TestDSLTransformer_TransformHeadersRejectsLineBreaks(t *testing.T) {
+	transformer := NewDSLTransformer()
+
+	cfg := &config.HeaderTransformConfig{Set: map[string]interface{}{"X-Name": "$.name"}}
+	if _, err := transformer.TransformHeaders(nil, cfg, []byte(`{"name": "a\r\nX-Injected: 1"}`), nil); err == nil {
+		t.Error("Header values with line breaks should be rejected")
+	}
+}
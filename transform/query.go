@@ -0,0 +1,113 @@
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+
+	"github.com/ruke318/gateway/config"
+)
+
+// TransformQuery 按 queryTransform 配置改写查询参数
+// body 为客户端请求体，供 "$.xxx" 表达式取值；不是 JSON 时 "$.xxx" 取不到值
+func (t *DSLTransformer) TransformQuery(query url.Values, cfg *config.QueryTransformConfig, body []byte, contextData map[string]interface{}) (url.Values, error) {
+	if cfg == nil {
+		return query, nil
+	}
+	result := url.Values{}
+	if cfg.Forward == nil || *cfg.Forward {
+		for k, v := range query {
+			result[k] = append([]string(nil), v...)
+		}
+	}
+
+	for _, name := range cfg.Remove {
+		result.Del(name)
+	}
+
+	// 按名称排序，保证多个参数改成同一个名字时结果稳定
+	names := make([]string, 0, len(cfg.Rename))
+	for from := range cfg.Rename {
+		names = append(names, from)
+	}
+	sort.Strings(names)
+	for _, from := range names {
+		to := cfg.Rename[from]
+		values, ok := result[from]
+		if !ok || to == from {
+			continue
+		}
+		result.Del(from)
+		result[to] = append(result[to], values...)
+	}
+
+	if len(cfg.Set) == 0 {
+		return result, nil
+	}
+
+	var sourceData interface{}
+	if len(body) > 0 {
+		json.Unmarshal(body, &sourceData)
+	}
+	for name, expr := range cfg.Set {
+		value, err := t.processValue(sourceData, expr, contextData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to process query %s: %w", name, err)
+		}
+		values, err := queryValues(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to process query %s: %w", name, err)
+		}
+		if len(values) == 0 {
+			continue
+		}
+		result[name] = values
+	}
+	return result, nil
+}
+
+// Values 计算单个表达式并转为字符串列表，语法与 queryTransform.set 的值相同，取不到值时返回空列表
+func (t *DSLTransformer) Values(expr interface{}, body []byte, contextData map[string]interface{}) ([]string, error) {
+	var sourceData interface{}
+	if len(body) > 0 {
+		json.Unmarshal(body, &sourceData)
+	}
+	value, err := t.processValue(sourceData, expr, contextData)
+	if err != nil {
+		return nil, err
+	}
+	return queryValues(value)
+}
+
+// queryValues 将表达式的值转为查询参数值：数组展开为多个值，对象序列化为 JSON
+func queryValues(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		var values []string
+		for _, item := range v {
+			itemValues, err := queryValues(item)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, itemValues...)
+		}
+		return values, nil
+	case map[string]interface{}:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return []string{string(data)}, nil
+	case float64:
+		// JSON 数字统一解析为 float64，避免大整数输出为科学计数法
+		return []string{strconv.FormatFloat(v, 'f', -1, 64)}, nil
+	default:
+		return []string{fmt.Sprint(v)}, nil
+	}
+}
@@ -0,0 +1,71 @@
+package transform
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/ruke318/gateway/config"
+)
+
+func TestDSLTransformer_TransformQuery(t *testing.T) {
+	transformer := NewDSLTransformer()
+
+	query, _ := url.ParseQuery("q=phone&debug=1&page=2")
+	body := []byte(`{"userId": 10086, "tags": ["a", "b"], "filter": {"type": "blood"}}`)
+	contextData := map[string]interface{}{"tenantId": "tenant-001"}
+
+	cfg := &config.QueryTransformConfig{
+		Remove: []string{"debug"},
+		Rename: map[string]string{"q": "keyword"},
+		Set: map[string]interface{}{
+			"tenant": "@ctx.tenantId",
+			"userId": "$.userId",
+			"tag":    "$.tags",
+			"filter": "$.filter",
+			"source": "gateway",
+			"size":   20,
+			"empty":  "$.missing",
+		},
+	}
+
+	result, err := transformer.TransformQuery(query, cfg, body, contextData)
+	if err != nil {
+		t.Fatalf("TransformQuery failed: %v", err)
+	}
+
+	expected := url.Values{
+		"keyword": {"phone"},
+		"page":    {"2"},
+		"tenant":  {"tenant-001"},
+		"userId":  {"10086"},
+		"tag":     {"a", "b"},
+		"filter":  {`{"type":"blood"}`},
+		"source":  {"gateway"},
+		"size":    {"20"},
+	}
+	if result.Encode() != expected.Encode() {
+		t.Errorf("Expected %s, got %s", expected.Encode(), result.Encode())
+	}
+	if query.Get("debug") != "1" {
+		t.Error("Original query should not be modified")
+	}
+}
+
+func TestDSLTransformer_TransformQueryWithoutForwarding(t *testing.T) {
+	transformer := NewDSLTransformer()
+
+	query, _ := url.ParseQuery("secret=x")
+	forward := false
+	cfg := &config.QueryTransformConfig{
+		Forward: &forward,
+		Set:     map[string]interface{}{"v": "1"},
+	}
+
+	result, err := transformer.TransformQuery(query, cfg, nil, nil)
+	if err != nil {
+		t.Fatalf("TransformQuery failed: %v", err)
+	}
+	if result.Encode() != "v=1" {
+		t.Errorf("Expected only set params, got %s", result.Encode())
+	}
+}